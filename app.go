@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+
+	"learn/internal/agent"
+	"learn/internal/chain"
+	"learn/internal/config"
+	"learn/internal/database"
+	"learn/internal/logger"
+	"learn/internal/metrics"
+	"learn/internal/provider"
+	"learn/internal/trace"
+	"learn/internal/usage"
+	"learn/internal/webhook"
+	"learn/internal/worker"
+)
+
+// app 各命令共用的运行环境
+type app struct {
+	// cfg 启动时的配置，数据库等只在启动时生效的配置项从这里读取
+	cfg     *config.Config
+	db      database.Store
+	closers []func()
+
+	// current 当前配置对应的运行环境，配置文件变化时整体替换
+	current atomic.Pointer[snapshot]
+}
+
+// snapshot 某一时刻的配置及由其创建的模型服务，运行开始时取一次，运行期间不变
+type snapshot struct {
+	cfg      *config.Config
+	provider provider.Provider
+	prompts  map[agent.Role]string
+	models   map[agent.Role]string
+}
+
+// loadConfig 加载配置并初始化日志，配置中的流水线与提示词在加载时校验
+func loadConfig() (*config.Config, error) {
+	m := config.Default()
+	m.AddValidator(validateConfig)
+	cfg, err := m.Load()
+	if err != nil {
+		return nil, fmt.Errorf("初始化配置失败: %w", err)
+	}
+
+	if err := setupLogger(cfg); err != nil {
+		return nil, err
+	}
+	if err := chain.SetPipelines(cfg.Pipelines); err != nil {
+		return nil, err
+	}
+	if err := setRoles(cfg); err != nil {
+		return nil, err
+	}
+	slog.Debug("应用启动配置", "config", cfg.Redacted())
+	return cfg, nil
+}
+
+// setRoles 读取 rolesDir 中的角色定义，替换之前由文件定义的角色
+func setRoles(cfg *config.Config) error {
+	specs, err := agent.LoadRoles(cfg.RolesDir)
+	if err != nil {
+		return err
+	}
+	agent.SetRoles(specs)
+	return nil
+}
+
+// validateConfig 校验依赖其他包的配置项
+func validateConfig(cfg *config.Config) error {
+	specs, err := agent.LoadRoles(cfg.RolesDir)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(agent.RolePromptMap)+len(specs))
+	for role := range agent.RolePromptMap {
+		known[string(role)] = true
+	}
+	for _, spec := range specs {
+		known[string(spec.Name)] = true
+	}
+	for role, prompt := range cfg.Prompts {
+		if !known[role] {
+			return fmt.Errorf("prompts 中的角色不存在: %s", role)
+		}
+		if _, err := agent.RenderPrompt(prompt, agent.PromptData{}); err != nil {
+			return fmt.Errorf("prompts.%s 模板错误: %w", role, err)
+		}
+	}
+	for role := range cfg.Roles {
+		if !known[role] {
+			return fmt.Errorf("roles 中的角色不存在: %s", role)
+		}
+	}
+	// 证书等需要读取文件的配置在加载时就报错
+	if _, err := newProvider(cfg, nil); err != nil {
+		return err
+	}
+	return chain.ValidatePipelines(cfg.Pipelines)
+}
+
+func setupLogger(cfg *config.Config) error {
+	if err := logger.Setup(logger.Options{
+		Level:  cfg.LogLevel,
+		Format: cfg.LogFormat,
+		Redact: cfg.LogRedact,
+	}); err != nil {
+		return fmt.Errorf("初始化日志失败: %w", err)
+	}
+	return nil
+}
+
+// setup 在 loadConfig 的基础上初始化追踪、指标、数据库与模型服务；needDB 为 true 时数据库打开失败视为错误
+func setup(ctx context.Context, needDB bool) (*app, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	usage.SetPrices(cfg.Prices)
+	a := &app{cfg: cfg}
+
+	// 追踪数据写入本地文件
+	if cfg.TraceFile != "" {
+		exporter, err := trace.NewFileExporter(cfg.TraceFile, "llm-chain")
+		if err != nil {
+			slog.Warn("开启追踪失败", "error", err)
+		} else {
+			a.closers = append(a.closers, func() { exporter.Close() })
+			trace.SetExporter(exporter)
+		}
+	}
+
+	// 暴露 Prometheus 指标
+	if cfg.MetricsAddr != "" {
+		metrics.Install()
+		go func() {
+			if err := metrics.Serve(cfg.MetricsAddr); err != nil {
+				slog.Error("指标服务退出", "error", err)
+			}
+		}()
+	}
+
+	// 用量与运行记录写入数据库
+	db, err := database.Open(cfg.DBDriver, cfg.DBDsn)
+	if err == nil {
+		if err = db.Migrate(ctx); err != nil {
+			db.Close()
+		}
+	}
+	switch {
+	case err == nil:
+		a.db = db
+		a.closers = append(a.closers, func() { db.Close() })
+	case needDB:
+		a.close()
+		return nil, fmt.Errorf("打开数据库失败: %w", err)
+	default:
+		slog.Warn("打开数据库失败", "error", err)
+		if cfg.Cache.Enabled {
+			slog.Warn("没有数据库，不开启响应缓存")
+		}
+	}
+
+	// 响应缓存存储在数据库中，模型服务在数据库之后创建
+	s, err := newSnapshot(cfg, nil, a.db)
+	if err != nil {
+		a.close()
+		return nil, err
+	}
+	a.current.Store(s)
+	config.Default().OnChange(a.reload)
+
+	return a, nil
+}
+
+// configure 以当前配置初始化链条，之后的配置变化不影响该链条
+func (a *app) configure(c *chain.Chain) {
+	s := a.current.Load()
+	c.SetProvider(s.provider).SetPrompts(s.prompts).SetModels(s.models).SetLocale(s.cfg.Locale)
+}
+
+// provider 返回当前配置对应的模型服务
+func (a *app) provider() provider.Provider {
+	return a.current.Load().provider
+}
+
+// watch 在后台监听配置文件，变化后的配置只对之后开始的运行生效
+func (a *app) watch(ctx context.Context) {
+	go func() {
+		if err := config.Default().Watch(ctx); err != nil {
+			slog.Warn("未开启配置热加载", "error", err)
+		}
+	}()
+}
+
+// reload 配置文件变化且校验通过后替换运行环境
+func (a *app) reload(old, cfg *config.Config) {
+	if err := setupLogger(cfg); err != nil {
+		slog.Error("更新日志配置失败", "error", err)
+	}
+	usage.SetPrices(cfg.Prices)
+	if err := chain.SetPipelines(cfg.Pipelines); err != nil {
+		slog.Error("更新流水线失败", "error", err)
+	}
+	if err := setRoles(cfg); err != nil {
+		slog.Error("更新角色失败", "error", err)
+	}
+	if s, err := newSnapshot(cfg, a.current.Load(), a.db); err != nil {
+		slog.Error("更新模型服务失败，沿用之前的配置", "error", err)
+	} else {
+		a.current.Store(s)
+	}
+
+	if old.DBDriver != cfg.DBDriver || old.DBDsn != cfg.DBDsn ||
+		old.MetricsAddr != cfg.MetricsAddr || old.TraceFile != cfg.TraceFile {
+		slog.Warn("数据库、指标与追踪配置需重启后生效")
+	}
+}
+
+// newSnapshot 按配置创建运行环境，模型服务配置未变化时沿用 prev 的服务以共享限流额度
+// prev 为空表示首次加载，store 为空时不开启响应缓存
+func newSnapshot(cfg *config.Config, prev *snapshot, store provider.CacheStore) (*snapshot, error) {
+	s := &snapshot{
+		cfg:     cfg,
+		prompts: make(map[agent.Role]string, len(cfg.Prompts)),
+		models:  make(map[agent.Role]string, len(cfg.Roles)),
+	}
+	for role, prompt := range cfg.Prompts {
+		s.prompts[agent.Role(role)] = prompt
+	}
+	for role, alias := range cfg.Roles {
+		s.models[agent.Role(role)] = alias
+	}
+	if prev != nil && sameProviders(prev.cfg, cfg) {
+		s.provider = prev.provider
+		return s, nil
+	}
+	p, err := newProvider(cfg, store)
+	if err != nil {
+		return nil, fmt.Errorf("创建模型服务失败: %w", err)
+	}
+	s.provider = p
+	return s, nil
+}
+
+// close 释放资源
+func (a *app) close() {
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		a.closers[i]()
+	}
+}
+
+// notifier 按配置创建运行结束的通知，未配置 webhook 时返回 nil；close 时等待进行中的投递
+func (a *app) notifier(artifactsDir string) worker.Notifier {
+	if len(a.cfg.Webhooks) == 0 {
+		return nil
+	}
+	d := webhook.New(a.cfg.Webhooks,
+		webhook.WithStore(a.db),
+		webhook.WithBaseURL(a.cfg.PublicUrl),
+		webhook.WithArtifactsDir(artifactsDir),
+	)
+	a.closers = append(a.closers, d.Wait)
+	return d
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"learn/internal/config"
+)
+
+func testConfig(baseURL string) *config.Config {
+	return &config.Config{
+		ApiBaseUrl: baseURL,
+		LogLevel:   "info",
+		LogFormat:  "text",
+		Locale:     "zh-CN",
+	}
+}
+
+func TestReloadSnapshot(t *testing.T) {
+	cfg := testConfig("http://127.0.0.1:11434")
+	s, err := newSnapshot(cfg, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &app{cfg: cfg}
+	a.current.Store(s)
+
+	// 模型服务配置未变化时沿用之前的服务，共享限流额度
+	same := testConfig("http://127.0.0.1:11434")
+	same.Locale = "en-US"
+	a.reload(cfg, same)
+	if a.current.Load().cfg != same || a.provider() != s.provider {
+		t.Error("unchanged providers should be reused")
+	}
+
+	// 服务创建失败时沿用之前的运行环境
+	prev := a.current.Load()
+	broken := testConfig("http://127.0.0.1:11434")
+	broken.Providers = map[string]config.ProviderConfig{
+		"default": {Type: "ollama", BaseURL: "http://127.0.0.1:11434", TLS: config.TLSConfig{CAFile: "missing-ca.pem"}},
+	}
+	a.reload(same, broken)
+	if a.current.Load() != prev {
+		t.Error("snapshot replaced by a config whose provider failed to build")
+	}
+
+	changed := testConfig("http://127.0.0.1:11435")
+	a.reload(same, changed)
+	if a.current.Load().cfg != changed || a.provider() == s.provider {
+		t.Error("changed providers should be rebuilt")
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"learn/internal/batch"
+	"learn/internal/chain"
+)
+
+// batchCmd 批量执行 JSONL 文件中的请求
+func batchCmd(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("batch", flag.ContinueOnError)
+	input := flags.String("i", "", "请求文件 (JSONL)，- 表示标准输入")
+	output := flags.String("o", "", "结果文件 (JSONL)，默认为 <输入文件>.out.jsonl")
+	concurrency := flags.Int("c", 2, "并发数")
+	artifacts := flags.String("artifacts", "", "生成文件的根目录，默认为 <结果文件>.artifacts")
+	resume := flags.Bool("resume", false, "结果文件已存在时跳过已处理的请求并追加结果")
+	retryFailed := flags.Bool("retry-failed", false, "恢复时重新执行失败的请求")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: llm-chain batch -i requests.jsonl [-o results.jsonl] [-c N] [-resume]")
+		fmt.Fprintln(os.Stderr, `每行一个请求: {"id": "...", "prompt": "...", "pipeline": "default", "overrides": {"model": "...", "timeout": "2m", "budget": {"max_tokens": 8000}}}`)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *input == "" || (*input == "-" && *output == "") {
+		flags.Usage()
+		return exitUsage
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(*input, ".jsonl") + ".out.jsonl"
+	}
+	if *artifacts == "" {
+		*artifacts = strings.TrimSuffix(*output, ".jsonl") + ".artifacts"
+	}
+
+	in := os.Stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return fail(err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	// 恢复时读取已有结果，跳过已处理的请求
+	var skip map[string]bool
+	mode := os.O_CREATE | os.O_WRONLY | os.O_EXCL
+	if *resume {
+		if f, err := os.Open(*output); err == nil {
+			skip, err = batch.Done(f, *retryFailed)
+			f.Close()
+			if err != nil {
+				return fail(err)
+			}
+		}
+		mode = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	out, err := os.OpenFile(*output, mode, 0644)
+	if errors.Is(err, os.ErrExist) {
+		fmt.Fprintf(os.Stderr, "结果文件 %s 已存在，使用 -resume 继续或删除后重试\n", *output)
+		return exitUsage
+	}
+	if err != nil {
+		return fail(err)
+	}
+	defer out.Close()
+
+	a, err := setup(ctx, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer a.close()
+
+	runner := batch.NewRunner(
+		batch.WithConcurrency(*concurrency),
+		batch.WithArtifactsDir(*artifacts),
+		batch.WithSkip(skip),
+		batch.WithSetup(func(c *chain.Chain) {
+			a.configure(c)
+			if a.db != nil {
+				c.SetStore(a.db)
+			}
+		}),
+	)
+	summary, err := runner.Run(ctx, in, out)
+	fmt.Fprintf(os.Stderr, "共 %d 条: 完成 %d, 失败 %d, 取消 %d, 跳过 %d, 结果写入 %s\n",
+		summary.Total, summary.Completed, summary.Failed, summary.Cancelled, summary.Skipped, *output)
+
+	switch {
+	case err != nil:
+		return fail(err)
+	case summary.Cancelled > 0:
+		return exitCancelled
+	case summary.Failed > 0:
+		return exitFailed
+	}
+	return exitOK
+}
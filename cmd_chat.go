@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"learn/internal/agent"
+	"learn/internal/provider"
+	"learn/internal/usage"
+	"learn/internal/util"
+)
+
+const chatHelp = `命令:
+  /role [name]    切换角色，不带参数时列出可选角色
+  /model [name]   切换模型，不带参数时输出当前模型
+  /usage          输出上一轮与本次会话的用量
+  /save <file>    保存对话
+  /load <file>    加载对话
+  /code [dir]     将上一轮回复中的代码块写入目录，默认当前目录
+  /clear          清空对话历史
+  /exit           退出`
+
+// chatSession 交互式对话状态，切换角色或模型时重建 Agent 并保留对话历史
+type chatSession struct {
+	role     agent.Role
+	model    string
+	provider provider.Provider
+	prompts  map[agent.Role]string
+	// models 配置中各角色使用的模型，pinned 为 true 时表示已手动指定模型，切换角色时不再跟随配置
+	models map[agent.Role]string
+	pinned bool
+	locale string
+	agent  *agent.Agent
+	// spent 已替换的 Agent 的用量
+	spent usage.Stats
+	last  usage.Stats
+}
+
+// savedChat 保存到文件的对话
+type savedChat struct {
+	Role     agent.Role        `json:"role"`
+	Model    string            `json:"model"`
+	Messages []util.PromptType `json:"messages"`
+}
+
+// useRoleModel 未手动指定模型时使用配置中为当前角色指定的模型，其次为角色定义中的默认模型
+func (s *chatSession) useRoleModel() {
+	if s.pinned {
+		return
+	}
+	if m, ok := s.models[s.role]; ok {
+		s.model = m
+	} else if spec, _ := agent.LookupRole(s.role); spec.Model != "" {
+		s.model = spec.Model
+	}
+}
+
+// chatCmd 与指定角色交互式对话，输入 /exit 或 EOF 结束
+func chatCmd(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("chat", flag.ContinueOnError)
+	role := flags.String("role", string(agent.AssistanceRole), "角色 ("+strings.Join(roleNames(), "|")+")")
+	modelName := flags.String("model", "qwen2.5-coder:1.5b", "模型名称")
+	load := flags.String("load", "", "加载已保存的对话")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	a, err := setup(ctx, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer a.close()
+	// rolesDir 中的角色在加载配置后才可用
+	if !validRole(*role) {
+		fmt.Fprintf(os.Stderr, "未知角色: %s，可选: %s\n", *role, strings.Join(roleNames(), ", "))
+		return exitUsage
+	}
+
+	current := a.current.Load()
+	s := &chatSession{role: agent.Role(*role), model: *modelName, provider: current.provider,
+		prompts: current.prompts, models: current.models, locale: current.cfg.Locale}
+	flags.Visit(func(f *flag.Flag) { s.pinned = s.pinned || f.Name == "model" })
+	s.useRoleModel()
+	s.reset(nil)
+	if *load != "" {
+		if err := s.load(*load); err != nil {
+			return fail(err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "与「%s」对话 (%s)，输入 /help 查看命令\n", s.role, s.model)
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Fprint(os.Stderr, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(os.Stderr)
+			break
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "/") {
+			if quit := s.command(line); quit {
+				return exitOK
+			}
+			continue
+		}
+
+		before := s.agent.Usage()
+		_, err := s.agent.Chat(ctx, s.provider, line)
+		fmt.Println()
+		s.last = subStats(s.agent.Usage(), before)
+		if ctx.Err() != nil {
+			return exitCancelled
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "错误:", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
+
+// reset 以当前角色与模型重建 Agent
+func (s *chatSession) reset(memory []util.PromptType) {
+	if s.agent != nil {
+		s.spent = s.spent.Add(s.agent.Usage())
+	}
+	s.agent = agent.NewAgent(
+		agent.WithAgentName(string(s.role)),
+		agent.WithModel(s.model),
+		agent.WithRole(s.role),
+		agent.WithMemory(memory),
+		agent.WithPromptOverrides(s.prompts),
+		agent.WithPromptData(agent.PromptData{Locale: s.locale}),
+		agent.WithStream(func(delta string) { fmt.Print(delta) }),
+	)
+}
+
+// command 执行斜杠命令，返回是否退出
+func (s *chatSession) command(line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "/exit", "/quit":
+		return true
+	case "/help":
+		fmt.Fprintln(os.Stderr, chatHelp)
+	case "/role":
+		if arg == "" {
+			fmt.Fprintf(os.Stderr, "当前角色: %s，可选: %s\n", s.role, strings.Join(roleNames(), ", "))
+			break
+		}
+		if !validRole(arg) {
+			fmt.Fprintf(os.Stderr, "未知角色: %s\n", arg)
+			break
+		}
+		s.role = agent.Role(arg)
+		s.useRoleModel()
+		s.reset(s.agent.Memory())
+		fmt.Fprintf(os.Stderr, "已切换到「%s」(%s)\n", s.role, s.model)
+	case "/model":
+		if arg == "" {
+			fmt.Fprintf(os.Stderr, "当前模型: %s\n", s.model)
+			break
+		}
+		s.model = arg
+		s.pinned = true
+		s.reset(s.agent.Memory())
+		fmt.Fprintf(os.Stderr, "已切换到 %s\n", s.model)
+	case "/usage":
+		total := s.spent.Add(s.agent.Usage())
+		fmt.Fprintf(os.Stderr, "上一轮: %s\n本次会话: %s\n", formatStats(s.last), formatStats(total))
+	case "/save":
+		if err := s.save(arg); err != nil {
+			fmt.Fprintln(os.Stderr, "错误:", err)
+		}
+	case "/load":
+		if err := s.load(arg); err != nil {
+			fmt.Fprintln(os.Stderr, "错误:", err)
+		}
+	case "/code":
+		if err := s.dumpCode(arg); err != nil {
+			fmt.Fprintln(os.Stderr, "错误:", err)
+		}
+	case "/clear":
+		s.reset(nil)
+		fmt.Fprintln(os.Stderr, "已清空对话历史")
+	default:
+		fmt.Fprintf(os.Stderr, "未知命令: %s，输入 /help 查看命令\n", name)
+	}
+	return false
+}
+
+func (s *chatSession) save(path string) error {
+	if path == "" {
+		return fmt.Errorf("需要指定文件")
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(savedChat{Role: s.role, Model: s.model, Messages: s.agent.Memory()}); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("保存对话失败: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "已保存 %d 条消息到 %s\n", len(s.agent.Memory()), path)
+	return nil
+}
+
+func (s *chatSession) load(path string) error {
+	if path == "" {
+		return fmt.Errorf("需要指定文件")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取对话失败: %w", err)
+	}
+	var saved savedChat
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("解析对话失败: %w", err)
+	}
+	if validRole(string(saved.Role)) {
+		s.role = saved.Role
+	}
+	if saved.Model != "" {
+		s.model = saved.Model
+		s.pinned = true
+	}
+	s.reset(saved.Messages)
+	fmt.Fprintf(os.Stderr, "已加载 %d 条消息，角色「%s」(%s)\n", len(saved.Messages), s.role, s.model)
+	return nil
+}
+
+// dumpCode 将最近一条回复中的代码块写入 dir
+func (s *chatSession) dumpCode(dir string) error {
+	var reply string
+	memory := s.agent.Memory()
+	for i := len(memory) - 1; i >= 0; i-- {
+		if memory[i].Role == "assistant" {
+			reply = memory[i].Content
+			break
+		}
+	}
+	blocks := util.ParseCodeBlocks(reply)
+	if len(blocks) == 0 {
+		return fmt.Errorf("上一轮回复中没有代码块")
+	}
+
+	if dir == "" {
+		dir = "."
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for i, block := range blocks {
+		path := filepath.Join(dir, fmt.Sprintf("block-%d%s", i+1, codeExt(block.Lang)))
+		if err := os.WriteFile(path, []byte(block.Code+"\n"), 0644); err != nil {
+			return fmt.Errorf("写入代码块失败: %w", err)
+		}
+		fmt.Fprintln(os.Stderr, "已写入", path)
+	}
+	return nil
+}
+
+// codeExt 按代码块语言推断文件扩展名
+func codeExt(lang string) string {
+	switch lang {
+	case "javascript", "js":
+		return ".js"
+	case "typescript", "ts":
+		return ".ts"
+	case "python", "py":
+		return ".py"
+	case "shell", "bash", "sh":
+		return ".sh"
+	case "golang", "go":
+		return ".go"
+	case "":
+		return ".txt"
+	}
+	return "." + lang
+}
+
+func formatStats(s usage.Stats) string {
+	return fmt.Sprintf("%d 次请求, 输入 %d / 输出 %d tokens, 费用 %.4f",
+		s.Requests, s.PromptTokens, s.CompletionTokens, s.Cost)
+}
+
+// subStats 返回 a - b
+func subStats(a, b usage.Stats) usage.Stats {
+	return usage.Stats{
+		Requests:         a.Requests - b.Requests,
+		CachedRequests:   a.CachedRequests - b.CachedRequests,
+		PromptTokens:     a.PromptTokens - b.PromptTokens,
+		CompletionTokens: a.CompletionTokens - b.CompletionTokens,
+		Cost:             a.Cost - b.Cost,
+	}
+}
+
+func validRole(role string) bool {
+	_, ok := agent.LookupRole(agent.Role(role))
+	return ok
+}
+
+// roleNames 返回所有角色名称，包括 rolesDir 中定义的角色
+func roleNames() []string {
+	return agent.RoleNames()
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"flag"
+)
+
+// configCmd 输出生效的配置（配置文件、环境变量与默认值合并后的结果）
+func configCmd(_ context.Context, args []string) int {
+	flags := flag.NewFlagSet("config", flag.ContinueOnError)
+	showSecrets := flags.Bool("show-secrets", false, "输出密钥原文")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	if !*showSecrets {
+		cfg = cfg.Redacted()
+	}
+	return printJSON(cfg)
+}
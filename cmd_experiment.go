@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"learn/internal/agent"
+	"learn/internal/chain"
+	"learn/internal/database"
+	"learn/internal/experiment"
+)
+
+// experimentCmd 以两组提示词或模型运行同一批输入并对比评分
+func experimentCmd(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("experiment", flag.ContinueOnError)
+	input := flags.String("i", "", "run 的输入文件 (JSONL，与 batch 格式相同)，- 表示标准输入")
+	name := flags.String("name", "", "实验名称")
+	pipeline := flags.String("pipeline", chain.DefaultPipeline, "流水线")
+	aModel := flags.String("a-model", "", "a 组的模型，为空时使用配置")
+	bModel := flags.String("b-model", "", "b 组的模型，为空时使用配置")
+	var aPrompts, bPrompts []string
+	flags.Func("a-prompt", "a 组的角色文件 (*.yaml|*.md)，可重复", func(s string) error {
+		aPrompts = append(aPrompts, s)
+		return nil
+	})
+	flags.Func("b-prompt", "b 组的角色文件 (*.yaml|*.md)，可重复", func(s string) error {
+		bPrompts = append(bPrompts, s)
+		return nil
+	})
+	judgeModel := flags.String("judge-model", "qwen2.5-coder:1.5b", "评审使用的模型")
+	noJudge := flags.Bool("no-judge", false, "只保存输出，不评分")
+	concurrency := flags.Int("c", 1, "并发数")
+	artifacts := flags.String("artifacts", "experiments", "生成文件的根目录")
+	limit := flags.Int("n", 20, "list 输出的条数")
+	jsonOut := flags.Bool("json", false, "以 JSON 输出")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: llm-chain experiment -i inputs.jsonl [-a-model M] [-a-prompt file] [-b-model M] [-b-prompt file] run")
+		fmt.Fprintln(os.Stderr, "      llm-chain experiment [-n N] list | show <id>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	valid := (args[0] == "run" || args[0] == "list") && len(args) == 1 || args[0] == "show" && len(args) == 2
+	if !valid || args[0] == "run" && *input == "" {
+		flags.Usage()
+		return exitUsage
+	}
+
+	a, err := setup(ctx, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer a.close()
+
+	switch args[0] {
+	case "list":
+		experiments, err := a.db.ListExperiments(ctx, *limit)
+		if err != nil {
+			return fail(err)
+		}
+		if *jsonOut {
+			return printJSON(experiments)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPIPELINE\tEVALUATOR\tCREATED")
+		for _, e := range experiments {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.ID, e.Name, e.Pipeline, e.Evaluator,
+				e.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+		w.Flush()
+		return exitOK
+	case "show":
+		exp, err := a.db.GetExperiment(ctx, args[1])
+		if err != nil {
+			return fail(err)
+		}
+		if exp == nil {
+			return fail(fmt.Errorf("实验不存在: %s", args[1]))
+		}
+		results, err := a.db.ListExperimentResults(ctx, exp.ID)
+		if err != nil {
+			return fail(err)
+		}
+		return printReport(experiment.Summarize(exp, results), *jsonOut, true)
+	}
+
+	// run
+	current := a.current.Load()
+	va, err := newVariant(*aModel, aPrompts, current.prompts)
+	if err != nil {
+		return fail(err)
+	}
+	vb, err := newVariant(*bModel, bPrompts, current.prompts)
+	if err != nil {
+		return fail(err)
+	}
+	if va.Label == vb.Label {
+		return fail(errors.New("两组配置相同，请用 -a-model/-b-model 或 -a-prompt/-b-prompt 指定不同的模型或提示词"))
+	}
+
+	in := os.Stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return fail(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	inputs, err := experiment.ReadInputs(in)
+	if err != nil {
+		return fail(err)
+	}
+
+	opts := []experiment.Option{
+		experiment.WithPipeline(*pipeline),
+		experiment.WithConcurrency(*concurrency),
+		experiment.WithArtifactsDir(*artifacts),
+		experiment.WithSetup(func(c *chain.Chain) {
+			a.configure(c)
+			c.SetStore(a.db)
+		}),
+	}
+	if !*noJudge {
+		opts = append(opts, experiment.WithEvaluator(experiment.NewJudge(current.provider, *judgeModel,
+			agent.WithPromptOverrides(current.prompts))))
+	}
+	report, err := experiment.NewRunner(a.db, opts...).Run(ctx, *name, va, vb, inputs)
+	if report != nil {
+		printReport(report, *jsonOut, false)
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitCancelled
+	case err != nil:
+		return fail(err)
+	}
+	return exitOK
+}
+
+// newVariant 由模型与角色文件构造一组实验配置，角色文件中的提示词覆盖配置中的 prompts
+func newVariant(model string, files []string, prompts map[agent.Role]string) (experiment.Variant, error) {
+	v := experiment.Variant{Model: model, Prompts: maps.Clone(prompts), Versions: make(map[agent.Role]string)}
+	if v.Prompts == nil {
+		v.Prompts = make(map[agent.Role]string)
+	}
+	var labels []string
+	if model != "" {
+		labels = append(labels, "model="+model)
+	}
+	for _, file := range files {
+		spec, err := agent.LoadRoleFile(file)
+		if err != nil {
+			return v, err
+		}
+		if spec.Prompt == "" {
+			return v, fmt.Errorf("角色文件 %s 未填写 prompt", file)
+		}
+		version := agent.PromptVersion(spec.Prompt, spec.Version)
+		v.Prompts[spec.Name] = spec.Prompt
+		v.Versions[spec.Name] = version
+		labels = append(labels, fmt.Sprintf("%s@%s", spec.Name, version))
+	}
+	sort.Strings(labels)
+	v.Label = strings.Join(labels, " ")
+	if v.Label == "" {
+		v.Label = "当前配置"
+	}
+	return v, nil
+}
+
+// printReport 输出实验汇总，pairs 为 true 时同时列出每条输入的分数
+func printReport(r *experiment.Report, jsonOut, pairs bool) int {
+	if jsonOut {
+		return printJSON(r)
+	}
+	fmt.Printf("实验 %s %s (%s, %s)\n", r.Experiment.ID, r.Experiment.Name, r.Experiment.Pipeline, r.Experiment.Evaluator)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VARIANT\tCOMPLETED\tFAILED\tSCORED\tMEAN\tWINS\tCONFIG")
+	fmt.Fprintf(w, "a\t%d\t%d\t%d\t%.2f\t%d\t%s\n", r.A.Completed, r.A.Failed, r.A.Scored, r.A.MeanScore, r.WinsA,
+		variantLabel(r.Experiment.VariantA))
+	fmt.Fprintf(w, "b\t%d\t%d\t%d\t%.2f\t%d\t%s\n", r.B.Completed, r.B.Failed, r.B.Scored, r.B.MeanScore, r.WinsB,
+		variantLabel(r.Experiment.VariantB))
+	w.Flush()
+	fmt.Printf("平局 %d\n", r.Ties)
+	if !pairs {
+		return exitOK
+	}
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INPUT\tA\tB\tWINNER\tA RUN\tB RUN")
+	for _, p := range r.Pairs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", truncate(p.InputID, 30), resultScore(p.A), resultScore(p.B),
+			p.Winner, resultRun(p.A), resultRun(p.B))
+	}
+	w.Flush()
+	return exitOK
+}
+
+// variantLabel 读取实验配置中的标签
+func variantLabel(raw []byte) string {
+	var v experiment.Variant
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return ""
+	}
+	return v.Label
+}
+
+// resultScore 结果的分数，未评分时输出状态
+func resultScore(r *database.ExperimentResult) string {
+	switch {
+	case r == nil:
+		return "-"
+	case r.Score != nil:
+		return fmt.Sprintf("%.1f", *r.Score)
+	}
+	return r.Status
+}
+
+func resultRun(r *database.ExperimentResult) string {
+	if r == nil {
+		return "-"
+	}
+	return r.RunID
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"learn/internal/gen"
+)
+
+// modelsCmd 查看或拉取本地模型
+func modelsCmd(_ context.Context, args []string) int {
+	flags := flag.NewFlagSet("models", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: llm-chain models list | show <name> | pull <name>")
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	if args[0] != "list" && len(args) != 2 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fail(err)
+	}
+	llm := gen.NewLocalLLM(cfg.ApiBaseUrl)
+
+	switch args[0] {
+	case "list":
+		models, err := llm.ModelList()
+		if err != nil {
+			return fail(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSIZE\tPARAMS\tQUANT\tMODIFIED")
+		for _, m := range models {
+			fmt.Fprintf(w, "%s\t%.1f GB\t%s\t%s\t%s\n", m.Name, float64(m.Size)/1e9,
+				m.Details.ParameterSize, m.Details.QuantizationLevel, m.ModifiedAt)
+		}
+		w.Flush()
+	case "show":
+		info, err := llm.ShowModel(args[1])
+		if err != nil {
+			return fail(err)
+		}
+		return printJSON(map[string]any{
+			"details":    info.Details,
+			"parameters": info.Parameters,
+			"template":   info.Template,
+			"model_info": info.ModelInfo,
+		})
+	case "pull":
+		last := ""
+		err := llm.PullModel(args[1], func(status string, completed, total int64) {
+			if total > 0 {
+				fmt.Fprintf(os.Stderr, "\r%s %3d%%", status, completed*100/total)
+				last = status
+				return
+			}
+			if status != last {
+				fmt.Fprintf(os.Stderr, "\n%s", status)
+				last = status
+			}
+		})
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return fail(err)
+		}
+	default:
+		flags.Usage()
+		return exitUsage
+	}
+	return exitOK
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"learn/internal/chain"
+)
+
+// runCmd 执行一次流水线
+func runCmd(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	prompt := flags.String("p", "", "需求内容")
+	file := flags.String("f", "", "从文件读取需求，- 表示标准输入")
+	pipeline := flags.String("pipeline", chain.DefaultPipeline,
+		"流水线名称 ("+strings.Join(chain.Pipelines(), "|")+")")
+	jsonOut := flags.Bool("json", false, "以 JSON 输出结果")
+	timeout := flags.Duration("timeout", 0, "整次运行的超时时间，0 表示不限制")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	message, err := readPrompt(*prompt, *file, flags.Args())
+	if err != nil {
+		return fail(err)
+	}
+	if message == "" {
+		fmt.Fprintln(os.Stderr, "需要通过 -p、-f、参数或标准输入提供需求")
+		return exitUsage
+	}
+
+	ch, err := chain.NewPipeline(*pipeline)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	a, err := setup(ctx, false)
+	if err != nil {
+		return fail(err)
+	}
+	defer a.close()
+
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	request := &chain.Request{Message: message, Data: make(map[string]any)}
+	return execute(ctx, a, ch, request, *jsonOut)
+}
+
+// readPrompt 依次从 -p、-f、位置参数与标准输入读取需求
+func readPrompt(prompt, file string, args []string) (string, error) {
+	switch {
+	case prompt != "":
+		return prompt, nil
+	case file == "-":
+		return readAll(os.Stdin)
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("读取需求文件失败: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	case len(args) > 0:
+		return strings.Join(args, " "), nil
+	}
+
+	// 标准输入被重定向时读取
+	if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice == 0 {
+		return readAll(os.Stdin)
+	}
+	return "", nil
+}
+
+func readAll(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("读取标准输入失败: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// execute 运行链条、输出结果并返回退出码
+func execute(ctx context.Context, a *app, ch *chain.Chain, request *chain.Request, jsonOut bool) int {
+	a.configure(ch)
+	if a.db != nil {
+		ch.SetStore(a.db)
+	}
+
+	result := ch.HandleRequest(request.SetContext(ctx))
+
+	if jsonOut {
+		printJSON(result)
+	} else {
+		printResult(result)
+	}
+	return exitCode(result.Status, result.Err)
+}
+
+// printResult 以文本形式输出结果
+func printResult(result *chain.Result) {
+	fmt.Printf("运行: %s (%s)\n", result.RunID, result.Status)
+	if result.Error != "" {
+		fmt.Printf("错误: %s\n", result.Error)
+	}
+
+	steps := make([]string, 0, len(result.Data))
+	for step := range result.Data {
+		steps = append(steps, step)
+	}
+	sort.Strings(steps)
+	for _, step := range steps {
+		fmt.Printf("\n[%s]\n%s\n", step, stepOutput(result.Data[step]))
+	}
+
+	fmt.Printf("\n用量: %d 次请求, %d tokens, 费用 %.4f\n",
+		result.Usage.Requests, result.Usage.TotalTokens(), result.Usage.Cost)
+}
+
+// stepOutput 提取步骤输出，Agent 步骤取 data 与 err 字段
+func stepOutput(v any) string {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	out, _ := m["data"].(string)
+	if errMsg, ok := m["err"].(string); ok {
+		out = strings.TrimSpace(out + "\n错误: " + errMsg)
+	}
+	return out
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"learn/internal/chain"
+	"learn/internal/database"
+	"learn/internal/model"
+)
+
+// runsCmd 查看或恢复已保存的运行
+func runsCmd(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("runs", flag.ContinueOnError)
+	limit := flags.Int("n", 20, "list 输出的条数")
+	jsonOut := flags.Bool("json", false, "以 JSON 输出")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: llm-chain runs [-n N] [-json] list | show <run_id> | resume <run_id>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	if args[0] != "list" && len(args) != 2 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	a, err := setup(ctx, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer a.close()
+
+	switch args[0] {
+	case "list":
+		runs, err := a.db.ListRuns(ctx, *limit)
+		if err != nil {
+			return fail(err)
+		}
+		if *jsonOut {
+			return printJSON(runs)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "RUN ID\tPIPELINE\tSTATUS\tSTEPS\tCREATED\tMESSAGE")
+		for _, r := range runs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", r.RunID, r.Pipeline, r.Status, len(r.Steps),
+				r.CreatedAt.Format("2006-01-02 15:04:05"), truncate(r.Message, 40))
+		}
+		w.Flush()
+	case "show":
+		record, err := getRun(ctx, a.db, args[1])
+		if err != nil {
+			return fail(err)
+		}
+		records, err := a.db.ListUsage(ctx, record.RunID)
+		if err != nil {
+			return fail(err)
+		}
+		deliveries, err := a.db.ListDeliveries(ctx, record.RunID)
+		if err != nil {
+			return fail(err)
+		}
+		prompts, err := a.db.ListPrompts(ctx, record.RunID)
+		if err != nil {
+			return fail(err)
+		}
+		return printJSON(map[string]any{"run": record, "usage": records, "prompts": prompts, "webhooks": deliveries})
+	case "resume":
+		record, err := getRun(ctx, a.db, args[1])
+		if err != nil {
+			return fail(err)
+		}
+		if record.Status == string(model.StatusCompleted) {
+			fmt.Fprintf(os.Stderr, "运行 %s 已完成，无需恢复\n", record.RunID)
+			return exitOK
+		}
+		ch, err := chain.NewPipeline(record.Pipeline)
+		if err != nil {
+			return fail(err)
+		}
+		request, err := chain.ResumeRequest(record)
+		if err != nil {
+			return fail(err)
+		}
+		return execute(ctx, a, ch, request, *jsonOut)
+	default:
+		flags.Usage()
+		return exitUsage
+	}
+	return exitOK
+}
+
+// getRun 读取运行记录，不存在时返回错误
+func getRun(ctx context.Context, db database.Store, runID string) (*database.RunRecord, error) {
+	record, err := db.GetRun(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, fmt.Errorf("运行不存在: %s", runID)
+	}
+	return record, nil
+}
+
+// truncate 截断过长的文本，用于表格输出
+func truncate(s string, n int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"learn/internal/config"
+)
+
+// secretsCmd 管理加密密钥文件中的条目，口令由 secretsPassphrase 提供
+func secretsCmd(_ context.Context, args []string) int {
+	flags := flag.NewFlagSet("secrets", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: llm-chain secrets list | set <name> | rm <name>")
+		fmt.Fprintln(os.Stderr, "set 从标准输入读取密钥，末尾的换行会被去掉")
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	if (args[0] != "list" || len(args) != 1) && ((args[0] != "set" && args[0] != "rm") || len(args) != 2) {
+		flags.Usage()
+		return exitUsage
+	}
+
+	vault, err := config.Default().Vault()
+	if err != nil {
+		return fail(err)
+	}
+	switch args[0] {
+	case "list":
+		for _, name := range vault.Names() {
+			fmt.Println(name)
+		}
+		return exitOK
+	case "set":
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fail(fmt.Errorf("读取密钥失败: %w", err))
+		}
+		value := strings.TrimRight(string(data), "\r\n")
+		if value == "" {
+			return fail(errors.New("密钥不能为空"))
+		}
+		vault.Set(args[1], value)
+	case "rm":
+		if !vault.Delete(args[1]) {
+			return fail(fmt.Errorf("密钥不存在: %s", args[1]))
+		}
+	}
+	if err := vault.Save(); err != nil {
+		return fail(err)
+	}
+	fmt.Fprintf(os.Stderr, "已更新 %s，配置中以 secret:%s 引用\n", vault.Path(), args[1])
+	return exitOK
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"learn/internal/chain"
+	"learn/internal/server"
+	"learn/internal/worker"
+)
+
+// serveCmd 启动 HTTP API 服务
+func serveCmd(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", ":8080", "监听地址")
+	workers := flags.Int("workers", 2, "进程内并发执行的运行数，0 表示只接收请求，由 worker 进程执行")
+	attempts := flags.Int("max-attempts", worker.DefaultMaxAttempts, "每次运行最多执行的次数")
+	visibility := flags.Duration("visibility", 30*time.Second, "任务租约时长")
+	artifacts := flags.String("artifacts", "artifacts", "生成文件的根目录")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	a, err := setup(ctx, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer a.close()
+
+	srv := server.New(a.db,
+		server.WithWorkers(*workers),
+		server.WithMaxAttempts(*attempts),
+		server.WithNotifier(a.notifier(*artifacts)),
+		server.WithWorkerOptions(worker.WithVisibility(*visibility)),
+		server.WithArtifactsDir(*artifacts),
+		server.WithSetup(func(c *chain.Chain) {
+			a.configure(c)
+		}),
+	)
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	a.watch(runCtx)
+	srv.Start(runCtx)
+
+	httpServer := &http.Server{Addr: *addr, Handler: srv.Handler()}
+	errc := make(chan error, 1)
+	go func() {
+		slog.Info("API 服务已启动", "addr", *addr)
+		errc <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err = httpServer.Shutdown(shutdownCtx)
+		cancel()
+	}
+	// 取消运行中的任务并归还队列，等待其写入状态
+	stop()
+	srv.Wait()
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fail(err)
+	}
+	return exitOK
+}
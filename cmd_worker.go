@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"learn/internal/chain"
+	"learn/internal/model"
+	"learn/internal/worker"
+)
+
+// workerCmd 从持久化队列领取并执行运行，可在多台机器上共用同一 MySQL 启动多个进程
+func workerCmd(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("worker", flag.ContinueOnError)
+	concurrency := flags.Int("c", 2, "并发执行的运行数")
+	visibility := flags.Duration("visibility", 30*time.Second, "任务租约时长，进程崩溃后任务在租约过期时被重新领取")
+	artifacts := flags.String("artifacts", "artifacts", "生成文件的根目录，与 serve 共用时 API 才能下载")
+	id := flags.String("id", "", "进程标识，默认为主机名与进程号")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	a, err := setup(ctx, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer a.close()
+
+	opts := []worker.Option{
+		worker.WithConcurrency(*concurrency),
+		worker.WithVisibility(*visibility),
+		worker.WithArtifactsDir(*artifacts),
+		worker.WithNotifier(a.notifier(*artifacts)),
+		worker.WithSetup(func(c *chain.Chain) {
+			a.configure(c)
+		}),
+	}
+	if *id != "" {
+		opts = append(opts, worker.WithID(*id))
+	}
+	a.watch(ctx)
+	// 收到中断信号后取消运行中的任务并归还队列
+	if err := worker.New(a.db, opts...).Run(ctx); err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
+
+// jobsCmd 查看任务队列，将死信任务重新加入队列
+func jobsCmd(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("jobs", flag.ContinueOnError)
+	status := flags.String("status", "", "list 按状态过滤 (queued|leased|done|dead|cancelled)")
+	limit := flags.Int("n", 20, "list 输出的条数")
+	jsonOut := flags.Bool("json", false, "以 JSON 输出")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: llm-chain jobs [-status S] [-n N] [-json] list | retry <run_id>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	if (args[0] != "list" || len(args) != 1) && (args[0] != "retry" || len(args) != 2) {
+		flags.Usage()
+		return exitUsage
+	}
+
+	a, err := setup(ctx, true)
+	if err != nil {
+		return fail(err)
+	}
+	defer a.close()
+
+	if args[0] == "retry" {
+		if err := a.db.RetryJob(ctx, args[1]); err != nil {
+			return fail(err)
+		}
+		record, err := getRun(ctx, a.db, args[1])
+		if err != nil {
+			return fail(err)
+		}
+		record.Status, record.Error = string(model.StatusPending), ""
+		if err := a.db.SaveRun(ctx, record); err != nil {
+			return fail(err)
+		}
+		fmt.Fprintf(os.Stderr, "任务 %s 已重新加入队列\n", args[1])
+		return exitOK
+	}
+
+	jobs, err := a.db.ListJobs(ctx, *status, *limit)
+	if err != nil {
+		return fail(err)
+	}
+	if *jsonOut {
+		return printJSON(jobs)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN ID\tSTATUS\tATTEMPTS\tOWNER\tUPDATED\tERROR")
+	for _, j := range jobs {
+		fmt.Fprintf(w, "%s\t%s\t%d/%d\t%s\t%s\t%s\n", j.ID, j.Status, j.Attempts, j.MaxAttempts, j.LeaseOwner,
+			j.UpdatedAt.Format("2006-01-02 15:04:05"), truncate(j.LastError, 40))
+	}
+	w.Flush()
+	return exitOK
+}
@@ -1,24 +1,27 @@
 package agent
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"learn/internal/config"
+	"learn/internal/interfaces"
+	"learn/internal/logger"
 	"learn/internal/model"
+	"learn/internal/provider"
+	"learn/internal/trace"
+	"learn/internal/usage"
 	"learn/internal/util"
-	"strings"
+	"log/slog"
 	"time"
-
-	"log"
-
-	"github.com/tidwall/gjson"
-	"resty.dev/v3"
 )
 
 // Agent 代表一个代理，用于执行特定的任务
 type Agent struct {
-	client *resty.Client
 	config AConfig
+	usage  usage.Stats
+	// resolved 服务返回的实际模型，模型为别名时与 config.Model 不同
+	resolved string
 }
 
 // State 状态
@@ -43,14 +46,35 @@ type AConfig struct {
 	Context      []map[string]string
 	EnableSearch bool
 	CurrentState State
+	// SearchProvider 本地搜索工具，配合 EnableSearch 使用
+	SearchProvider interfaces.ISearchProvider
+	RetryPolicy    RetryPolicy
+	// Options 生成参数，如 temperature
+	Options map[string]any
+	// Guard 预算检查，每次请求前执行
+	Guard *usage.Guard
+	// Memory 多轮对话历史，位于系统提示词之后，由 Chat 维护
+	Memory []util.PromptType
+	// OnDelta 流式输出回调，不支持流式的服务商会在响应后一次性回调
+	OnDelta func(delta string)
+	// Hooks 只对该 Agent 生效的回调
+	Hooks []Hooks
+	// PromptOverrides 覆盖角色的系统提示词，未覆盖的角色使用角色定义中的提示词
+	PromptOverrides map[Role]string
+	// PromptVersions PromptOverrides 中提示词的版本，未设置时按内容计算
+	PromptVersions map[Role]string
+	// PromptData 渲染系统提示词的变量
+	PromptData PromptData
+	// PromptTemplate 与 PromptVersion 为渲染前的系统提示词及其版本，由 NewAgent 设置
+	PromptTemplate string
+	PromptVersion  string
+	// Format 输出格式，为 FormatJSON 时要求响应为合法 JSON
+	Format string
 }
 
 // Option 定义 with 选项函数类型
 type Option func(*AConfig)
 
-// AdapterFunc 适配器承载不同模型对接
-type AdapterFunc func(body map[string]any) (*resty.Response, error)
-
 // WithTaskID 设置 TaskID
 func WithTaskID(taskID string) Option {
 	return func(cfg *AConfig) {
@@ -100,6 +124,79 @@ func WithEnableSearch(enableSearch bool) Option {
 	}
 }
 
+// WithSearchProvider 设置搜索工具，开启 EnableSearch 时由 Agent 以工具调用的方式使用
+func WithSearchProvider(provider interfaces.ISearchProvider) Option {
+	return func(cfg *AConfig) {
+		cfg.SearchProvider = provider
+	}
+}
+
+// WithTemperature 设置 temperature，为 0 时响应可被缓存
+func WithTemperature(temperature float64) Option {
+	return func(cfg *AConfig) {
+		if cfg.Options == nil {
+			cfg.Options = map[string]any{}
+		}
+		cfg.Options["temperature"] = temperature
+	}
+}
+
+// WithGuard 设置预算检查
+func WithGuard(guard *usage.Guard) Option {
+	return func(cfg *AConfig) {
+		cfg.Guard = guard
+	}
+}
+
+// WithRetryPolicy 设置重试策略
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(cfg *AConfig) {
+		cfg.RetryPolicy = policy
+	}
+}
+
+// WithMemory 设置对话历史，用于切换角色或模型时保留上下文
+func WithMemory(memory []util.PromptType) Option {
+	return func(cfg *AConfig) {
+		cfg.Memory = append([]util.PromptType(nil), memory...)
+	}
+}
+
+// WithStream 设置流式输出回调
+func WithStream(onDelta func(delta string)) Option {
+	return func(cfg *AConfig) {
+		cfg.OnDelta = onDelta
+	}
+}
+
+// WithPromptOverrides 设置角色系统提示词的覆盖，通常来自配置文件
+func WithPromptOverrides(prompts map[Role]string) Option {
+	return func(cfg *AConfig) {
+		cfg.PromptOverrides = prompts
+	}
+}
+
+// WithPromptVersions 设置覆盖的系统提示词的版本
+func WithPromptVersions(versions map[Role]string) Option {
+	return func(cfg *AConfig) {
+		cfg.PromptVersions = versions
+	}
+}
+
+// WithPromptData 设置渲染系统提示词的变量
+func WithPromptData(data PromptData) Option {
+	return func(cfg *AConfig) {
+		cfg.PromptData = data
+	}
+}
+
+// WithFormat 设置输出格式，覆盖角色定义中的 outputFormat
+func WithFormat(format string) Option {
+	return func(cfg *AConfig) {
+		cfg.Format = format
+	}
+}
+
 // WithStatus 设置 Status
 func WithStatus(status model.Status) Option {
 	return func(cfg *AConfig) {
@@ -109,30 +206,50 @@ func WithStatus(status model.Status) Option {
 
 // NewAgent 创建一个新的Agent
 func NewAgent(opts ...Option) *Agent {
-	client := resty.New()
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		log.Fatalf("加载配置失败: %v", err)
-	}
-	client.SetBaseURL(cfg.ApiBaseUrl)
-
 	agent := &Agent{
-		client: client,
 		config: AConfig{
-			Model:  "qwen-max",
-			Status: model.StatusPending,
+			Model:       "qwen-max",
+			Status:      model.StatusPending,
+			RetryPolicy: DefaultRetryPolicy(),
 		},
 	}
 
 	for _, opt := range opts {
 		opt(&agent.config)
 	}
-
-	agent.config.SystemPrompt = GetAgentPrompt(agent.config.Role)
+	agent.applyRole()
 
 	return agent
 }
 
+// applyRole 按角色定义设置系统提示词，以及选项中未设置的温度、工具与输出格式
+func (a *Agent) applyRole() {
+	cfg := &a.config
+	spec, _ := LookupRole(cfg.Role)
+	prompt, version := spec.Prompt, spec.Version
+	if override := cfg.PromptOverrides[cfg.Role]; override != "" {
+		prompt, version = override, cfg.PromptVersions[cfg.Role]
+	}
+	cfg.PromptTemplate = prompt
+	cfg.PromptVersion = PromptVersion(prompt, version)
+	rendered, err := RenderPrompt(prompt, cfg.PromptData)
+	if err != nil {
+		slog.Warn("渲染系统提示词失败，使用原文", "role", cfg.Role, "error", err)
+		rendered = prompt
+	}
+	cfg.SystemPrompt = rendered
+
+	if _, ok := cfg.Options["temperature"]; !ok && spec.Temperature != nil {
+		WithTemperature(*spec.Temperature)(cfg)
+	}
+	if spec.hasTool(SearchToolName) {
+		cfg.EnableSearch = true
+	}
+	if cfg.Format == "" {
+		cfg.Format = spec.OutputFormat
+	}
+}
+
 func (a *Agent) EchoRoleInfo() (string, string) {
 	return a.config.AgentName, a.config.SystemPrompt
 }
@@ -149,40 +266,58 @@ func (a *Agent) GetStatus() model.Status {
 	return a.config.Status
 }
 
-func (a *Agent) setStatus(status model.Status) {
-	a.config.Status = status
+func (a *Agent) GetModel() string {
+	return a.config.Model
 }
 
-func (a *Agent) extractContent(res *resty.Response) string {
-	if strings.Contains(res.Request.URL, config.OllamaUrl) {
-		return gjson.GetBytes(res.Bytes(), "message.content").String()
+// ResolvedModel 返回最近一次响应的实际模型，尚无响应或服务未返回时为配置的模型
+func (a *Agent) ResolvedModel() string {
+	if a.resolved != "" {
+		return a.resolved
 	}
-	return gjson.GetBytes(res.Bytes(), "choices.0.message.content").String()
+	return a.config.Model
 }
 
-func (a *Agent) checkError(res *resty.Response) (string, error) {
-	if res.IsError() {
-		a.setStatus(model.StatusFailed)
-		bodyString := string(res.Bytes())
-		log.Printf("请求失败: %s, Body: %s\n", res.Status(), bodyString)
-		return "", fmt.Errorf("request failed: %s", res.Status())
-	}
+func (a *Agent) GetRole() Role {
+	return a.config.Role
+}
+
+// GetPrompt 返回渲染前的系统提示词及其版本
+func (a *Agent) GetPrompt() (template, version string) {
+	return a.config.PromptTemplate, a.config.PromptVersion
+}
+
+// Usage 返回该 Agent 累计的用量，包括重试与工具调用轮次
+func (a *Agent) Usage() usage.Stats {
+	return a.usage
+}
+
+// Memory 返回对话历史的副本
+func (a *Agent) Memory() []util.PromptType {
+	return append([]util.PromptType(nil), a.config.Memory...)
+}
+
+func (a *Agent) setStatus(status model.Status) {
+	a.config.Status = status
+}
 
-	content := a.extractContent(res)
-	if content == "" {
+// checkResponse 检查响应内容并更新任务状态
+func (a *Agent) checkResponse(resp *provider.ChatResponse) (string, error) {
+	if resp.Content == "" {
 		a.setStatus(model.StatusFailed)
 		return "", fmt.Errorf("empty content from API")
 	}
 
 	a.setStatus(model.StatusCompleted)
-	return content, nil
+	return resp.Content, nil
 }
 
-// parseRequestBody 构造请求体
-func (a *Agent) parseRequestBody(more ...util.PromptType) map[string]any {
-	messages := []util.PromptType{
-		util.AppendSystemPrompt(a.config.SystemPrompt),
-		util.AppendUserPrompt(a.config.UserPrompt),
+// buildRequest 构造请求
+func (a *Agent) buildRequest(more ...util.PromptType) *provider.ChatRequest {
+	messages := []util.PromptType{util.AppendSystemPrompt(a.config.SystemPrompt)}
+	messages = append(messages, a.config.Memory...)
+	if a.config.UserPrompt != "" {
+		messages = append(messages, util.AppendUserPrompt(a.config.UserPrompt))
 	}
 
 	messages = append(messages, more...)
@@ -197,112 +332,209 @@ func (a *Agent) parseRequestBody(more ...util.PromptType) map[string]any {
 		})
 	}
 
-	fmt.Println(messages)
+	req := &provider.ChatRequest{
+		Model:    a.config.Model,
+		Messages: messages,
+		Options:  a.config.Options,
+		OnDelta:  a.config.OnDelta,
+	}
+	if a.config.Format == FormatJSON {
+		req.Format = FormatJSON
+	}
 
-	return map[string]any{
-		"messages":      messages,
-		"stream":        false,
-		"model":         a.config.Model,
-		"enable_search": a.config.EnableSearch,
+	// 配置了本地搜索工具时不再依赖服务端的 enable_search
+	if a.searchEnabled() {
+		req.Tools = []map[string]any{searchToolSchema()}
+	} else {
+		req.EnableSearch = a.config.EnableSearch
 	}
+	return req
 }
 
-// RateLimiter 速率限制器
-type RateLimiter struct {
-	bucketSize int
-	refillRate float64
-	tokens     float64
-	lastRefill time.Time
+// ToolCall 工具调用信息
+type ToolCall = provider.ToolCall
+
+// ExecuteTask 执行任务并发送请求
+func (a *Agent) ExecuteTask(p provider.Provider, more ...util.PromptType) ([]ToolCall, string, error) {
+	return a.ExecuteTaskContext(context.Background(), p, more...)
 }
 
-// NewRateLimiter 创建新的速率限制器
-func NewRateLimiter(bucketSize int, refillRate float64) *RateLimiter {
-	return &RateLimiter{
-		bucketSize: bucketSize,
-		refillRate: refillRate,
-		tokens:     float64(bucketSize),
-		lastRefill: time.Now(),
+// Chat 多轮对话：以 message 作为本轮输入执行任务，成功后将本轮问答追加到对话历史
+func (a *Agent) Chat(ctx context.Context, p provider.Provider, message string) (string, error) {
+	a.config.UserPrompt = message
+	defer func() { a.config.UserPrompt = "" }()
+
+	_, reply, err := a.ExecuteTaskContext(ctx, p)
+	if err != nil {
+		return "", err
 	}
+	a.config.Memory = append(a.config.Memory,
+		util.AppendUserPrompt(message),
+		util.AppendAssistantPrompt(reply),
+	)
+	return reply, nil
 }
 
-// Allow 检查是否允许请求
-func (rl *RateLimiter) Allow() bool {
-	now := time.Now()
-	elapsed := now.Sub(rl.lastRefill).Seconds()
-	rl.tokens += elapsed * rl.refillRate
-	if rl.tokens > float64(rl.bucketSize) {
-		rl.tokens = float64(rl.bucketSize)
+// ExecuteTaskContext 执行任务，ctx 取消时中止请求与重试
+func (a *Agent) ExecuteTaskContext(ctx context.Context, p provider.Provider, more ...util.PromptType) ([]ToolCall, string, error) {
+	var toolCalls []ToolCall
+	more = append([]util.PromptType(nil), more...)
+	ctx = logger.With(ctx, "agent", a.config.AgentName, "task_id", a.config.TaskID)
+
+	ctx, span := trace.Start(ctx, "agent.execute")
+	span.Set("agent", a.config.AgentName).Set("model", a.config.Model).Set("provider", p.Name())
+	start := time.Now()
+	finish := func(err error) {
+		a.emitTask(ctx, TaskEvent{
+			Agent:    a.config.AgentName,
+			Model:    a.config.Model,
+			Provider: p.Name(),
+			Status:   a.config.Status,
+			Usage:    a.usage,
+			Duration: time.Since(start),
+			Err:      err,
+		})
+		span.Set("requests", a.usage.Requests).
+			Set("prompt_tokens", a.usage.PromptTokens).
+			Set("completion_tokens", a.usage.CompletionTokens).
+			Set("tool_calls", len(toolCalls)).
+			Set("status", string(a.config.Status))
+		span.Finish(err)
 	}
-	rl.lastRefill = now
 
-	if rl.tokens >= 1 {
-		rl.tokens--
-		return true
+	for round := 0; ; round++ {
+		resp, err := a.send(ctx, p, more)
+		if err != nil {
+			a.setStatus(model.StatusFailed)
+			finish(err)
+			return toolCalls, "", err
+		}
+		toolCalls = append(toolCalls, resp.ToolCalls...)
+
+		if !a.searchEnabled() || len(resp.ToolCalls) == 0 || round >= maxToolRounds {
+			content, err := a.checkResponse(resp)
+			finish(err)
+			return toolCalls, content, err
+		}
+
+		// 执行工具并将结果回传给模型，进入下一轮
+		more = append(more, util.PromptType{
+			Role:      "assistant",
+			Content:   resp.Content,
+			ToolCalls: resp.RawToolCalls,
+		})
+		for _, call := range resp.ToolCalls {
+			slog.InfoContext(ctx, "执行工具调用", "tool", call.ToolName, "round", round+1)
+			a.emitToolCall(ctx, ToolCallEvent{
+				Agent:  a.config.AgentName,
+				Tool:   call.ToolName,
+				Params: call.Params,
+				Round:  round + 1,
+			})
+			more = append(more, util.AppendToolPrompt(a.runTool(ctx, call), call.ID))
+		}
 	}
-	return false
 }
 
-// ToolCall 工具调用信息
-type ToolCall struct {
-	ToolName string                 `json:"tool_name"`
-	Params   map[string]interface{} `json:"params"`
-}
+// send 发送一次请求，按重试策略处理失败；限流由服务提供方自身负责（见 provider.Limited）
+func (a *Agent) send(ctx context.Context, p provider.Provider, more []util.PromptType) (*provider.ChatResponse, error) {
+	policy := a.config.RetryPolicy
+	attempts := max(policy.MaxAttempts, 1)
 
-// ExecuteTask 执行任务并发送请求
-func (a *Agent) ExecuteTask(callBack AdapterFunc, more ...util.PromptType) ([]ToolCall, string, error) {
-	var res *resty.Response
 	var err error
-	var toolCalls []ToolCall
+	for i := 0; i < attempts; i++ {
+		req := a.buildRequest(more...)
+		// 预算超限时直接返回，不再重试
+		if a.config.Guard != nil {
+			if budgetErr := a.config.Guard.Check(a.usage, provider.EstimateTokens(req)); budgetErr != nil {
+				return nil, budgetErr
+			}
+		}
 
-	// 实现速率限制
-	rateLimiter := NewRateLimiter(10, 1.0) // 每秒最多10个请求
+		logger.Payload(ctx, "发送模型请求", "messages", req.Messages)
 
-	// 实现指数退避重试机制
-	retryCount := 3
-	retryInterval := 1 * time.Second
+		attemptCtx, span := trace.Start(ctx, "agent.attempt")
+		span.Set("attempt", i+1).Set("model", req.Model).Set("provider", p.Name())
 
-	for i := 0; i < retryCount; i++ {
-		if !rateLimiter.Allow() {
-			time.Sleep(100 * time.Millisecond)
-			continue
+		// 缓存命中或不支持流式时没有增量输出，响应后一次性回调
+		streamed := false
+		if onDelta := req.OnDelta; onDelta != nil {
+			req.OnDelta = func(delta string) {
+				streamed = true
+				onDelta(delta)
+			}
 		}
 
-		reqBody := a.parseRequestBody(more...)
-
-		// 添加工具调用信息
-		reqBody["tool_calls"] = []ToolCall{
-			{
-				ToolName: "code_editor",
-				Params: map[string]interface{}{
-					"action":  "edit",
-					"file":    "main.go",
-					"line":    10,
-					"content": "fmt.Println(\"Hello, World!\")",
-				},
-			},
+		var resp *provider.ChatResponse
+		attemptStart := time.Now()
+		resp, err = p.Chat(attemptCtx, req)
+		if err == nil && !streamed && resp.Content != "" && a.config.OnDelta != nil {
+			a.config.OnDelta(resp.Content)
 		}
-
-		// call interface
-		res, err = callBack(reqBody)
+		if err == nil {
+			// 按实际模型计费，别名不在单价表中
+			if resp.Model != "" {
+				a.resolved = resp.Model
+			}
+			a.usage = a.usage.Add(usage.FromResponse(a.ResolvedModel(), resp))
+			logger.Payload(ctx, "收到模型响应", "content", resp.Content)
+			span.Set("prompt_tokens", resp.Usage.PromptTokens).
+				Set("completion_tokens", resp.Usage.CompletionTokens).
+				Set("cached", resp.Cached)
+		} else {
+			a.usage.Requests++
+		}
+		if err == nil && resp.Content == "" && len(resp.ToolCalls) == 0 {
+			err = &provider.Error{Provider: p.Name(), Class: provider.ClassEmptyContent, Err: provider.ErrEmptyContent}
+		}
+		if err == nil && a.config.Format == FormatJSON && len(resp.ToolCalls) == 0 && !json.Valid([]byte(resp.Content)) {
+			err = &provider.Error{Provider: p.Name(), Class: provider.ClassInvalidJSON,
+				Err: fmt.Errorf("response is not valid JSON: %.200s", resp.Content)}
+		}
+		if err != nil {
+			span.Set("error.class", string(provider.Classify(err)))
+		}
+		span.Finish(err)
+
+		// 已输出的分段无法撤回，重试会让调用方在部分内容之后再收到完整内容
+		retrying := err != nil && !streamed && i < attempts-1 && policy.shouldRetry(err)
+		event := AttemptEvent{
+			Agent:    a.config.AgentName,
+			Model:    req.Model,
+			Provider: p.Name(),
+			Attempt:  i + 1,
+			Duration: time.Since(attemptStart),
+			Err:      err,
+			Retrying: retrying,
+		}
+		if resp != nil {
+			event.Usage, event.Cached = resp.Usage, resp.Cached
+		}
+		a.emitAttempt(ctx, event)
 
 		if err == nil {
+			return resp, nil
+		}
+		if err != nil && streamed {
+			return nil, fmt.Errorf("stream interrupted after partial output: %w", err)
+		}
+		if !retrying {
 			break
 		}
-
-		time.Sleep(retryInterval)
-		retryInterval *= 2 // 指数退避
-	}
-
-	if err != nil {
-		return toolCalls, "", fmt.Errorf("failed to send request after %d retries: %w", retryCount, err)
+		delay := policy.delay(i, err)
+		slog.WarnContext(ctx, "模型请求失败，准备重试",
+			"attempt", i+1, "class", provider.Classify(err), "delay", delay, "error", err)
+		if sleepErr := sleep(ctx, delay); sleepErr != nil {
+			return nil, sleepErr
+		}
 	}
 
-	// 解析工具调用信息
-	toolCallsJSON := gjson.GetBytes(res.Bytes(), "tool_calls").String()
-	if err := json.Unmarshal([]byte(toolCallsJSON), &toolCalls); err != nil {
-		return toolCalls, "", fmt.Errorf("failed to parse tool calls: %w", err)
-	}
+	return nil, fmt.Errorf("request failed after retries: %w", err)
+}
 
-	content, err := a.checkError(res)
-	return toolCalls, content, err
+// asProviderError 提取分类错误
+func asProviderError(err error) (*provider.Error, bool) {
+	var pe *provider.Error
+	ok := errors.As(err, &pe)
+	return pe, ok
 }
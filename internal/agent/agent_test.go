@@ -0,0 +1,234 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"learn/internal/config"
+	"learn/internal/interfaces"
+	"learn/internal/model"
+	"learn/internal/provider"
+	"learn/internal/usage"
+	"learn/internal/util"
+)
+
+func TestUsagePricedOnResolvedAlias(t *testing.T) {
+	usage.SetPrices(map[string]config.ModelPrice{"gpt-4o": {Prompt: 1, Completion: 2}})
+	defer usage.SetPrices(nil)
+
+	mock := provider.NewMock(provider.MockResponse{
+		Content: "ok",
+		Usage:   provider.Usage{PromptTokens: 1000, CompletionTokens: 1000},
+	})
+	p := provider.NewAliases("models", nil, map[string]provider.Alias{
+		"smart": {Provider: mock, Model: "gpt-4o"},
+	})
+
+	a := NewAgent(WithModel("smart"), WithRole(DemandAnalysisRole))
+	if _, _, err := a.ExecuteTaskContext(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	if got := mock.Call(0).Model; got != "gpt-4o" {
+		t.Errorf("request model = %q, want gpt-4o", got)
+	}
+	if got := a.ResolvedModel(); got != "gpt-4o" {
+		t.Errorf("ResolvedModel() = %q, want gpt-4o", got)
+	}
+	if got := a.Usage().Cost; got != 3 {
+		t.Errorf("cost = %g, want 3", got)
+	}
+}
+
+type fakeSearch struct {
+	queries []string
+}
+
+func (s *fakeSearch) Name() string {
+	return "fake"
+}
+
+func (s *fakeSearch) Search(_ context.Context, query string, _ int) ([]interfaces.SearchResult, error) {
+	s.queries = append(s.queries, query)
+	return []interfaces.SearchResult{{Title: "Go 1.23 发布说明", URL: "https://go.dev/doc/go1.23", Content: "range over func"}}, nil
+}
+
+// noDelay 立即重试，避免测试等待
+func noDelay() RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.BaseDelay, policy.MaxDelay, policy.Jitter = 0, 0, 0
+	return policy
+}
+
+func TestExecuteTaskMessageOrder(t *testing.T) {
+	mock := provider.NewMock().Reply("完成")
+	a := NewAgent(
+		WithModel("m"),
+		WithRole(DemandAnalysisRole),
+		WithMemory([]util.PromptType{util.AppendUserPrompt("上一轮"), util.AppendAssistantPrompt("好的")}),
+		WithUserPrompt("写一个登录页"),
+	)
+
+	_, content, err := a.ExecuteTaskContext(context.Background(), mock, util.AppendUserPrompt("补充说明"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "完成" || !a.IsFinished() {
+		t.Errorf("content = %q, finished = %v", content, a.IsFinished())
+	}
+
+	_, prompt := a.EchoRoleInfo()
+	want := []util.PromptType{
+		util.AppendSystemPrompt(prompt),
+		util.AppendUserPrompt("上一轮"),
+		util.AppendAssistantPrompt("好的"),
+		util.AppendUserPrompt("写一个登录页"),
+		util.AppendUserPrompt("补充说明"),
+	}
+	assertMessages(t, mock.Messages(0), want)
+}
+
+func TestExecuteTaskToolRounds(t *testing.T) {
+	mock := provider.NewMock(
+		provider.MockResponse{ToolCalls: []provider.ToolCall{{ID: "call_1", ToolName: SearchToolName, Params: map[string]any{"query": "go 1.23"}}}},
+		provider.MockResponse{Content: "Go 1.23 支持 range over func"},
+	)
+	search := &fakeSearch{}
+	a := NewAgent(WithModel("m"), WithRole(DemandAnalysisRole), WithUserPrompt("Go 1.23 有什么新特性"),
+		WithEnableSearch(true), WithSearchProvider(search))
+
+	calls, content, err := a.ExecuteTaskContext(context.Background(), mock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "Go 1.23 支持 range over func" || len(calls) != 1 {
+		t.Errorf("content = %q, tool calls = %d", content, len(calls))
+	}
+	if len(search.queries) != 1 || search.queries[0] != "go 1.23" {
+		t.Errorf("search queries = %v", search.queries)
+	}
+	if len(mock.Calls()) != 2 || len(mock.Call(0).Tools) != 1 {
+		t.Fatalf("calls = %d, want 2 with the search tool", len(mock.Calls()))
+	}
+
+	// 第二轮在原消息后追加模型的工具调用与工具结果
+	second := mock.Messages(1)
+	if len(second) != 4 {
+		t.Fatalf("second round messages = %+v", second)
+	}
+	assertMessages(t, second[:2], mock.Messages(0))
+	assistant, tool := second[2], second[3]
+	if assistant.Role != "assistant" || !json.Valid(assistant.ToolCalls) ||
+		!strings.Contains(string(assistant.ToolCalls), `"name":"search"`) {
+		t.Errorf("assistant message = %+v (tool_calls %s)", assistant, assistant.ToolCalls)
+	}
+	if tool.Role != "tool" || tool.ToolCallID != "call_1" || !strings.Contains(tool.Content, "Go 1.23 发布说明") {
+		t.Errorf("tool message = %+v", tool)
+	}
+}
+
+func TestExecuteTaskRetry(t *testing.T) {
+	mock := provider.NewMock(
+		provider.MockResponse{StatusCode: 503},
+		provider.MockResponse{Content: ""},
+		provider.MockResponse{Content: "ok"},
+	)
+	a := NewAgent(WithModel("m"), WithRole(DemandAnalysisRole), WithUserPrompt("hi"), WithRetryPolicy(noDelay()))
+
+	_, content, err := a.ExecuteTaskContext(context.Background(), mock)
+	if err != nil || content != "ok" {
+		t.Fatalf("content = %q, err = %v", content, err)
+	}
+	if len(mock.Calls()) != 3 || a.Usage().Requests != 3 {
+		t.Errorf("calls = %d, requests = %d, want 3", len(mock.Calls()), a.Usage().Requests)
+	}
+	// 重试发送相同的消息
+	assertMessages(t, mock.Messages(2), mock.Messages(0))
+}
+
+func TestExecuteTaskNoRetryOnClientError(t *testing.T) {
+	mock := provider.NewMock(provider.MockResponse{StatusCode: 400}, provider.MockResponse{Content: "ok"})
+	a := NewAgent(WithModel("m"), WithRole(DemandAnalysisRole), WithUserPrompt("hi"), WithRetryPolicy(noDelay()))
+
+	if _, _, err := a.ExecuteTaskContext(context.Background(), mock); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(mock.Calls()) != 1 || mock.Remaining() != 1 {
+		t.Errorf("calls = %d, remaining = %d", len(mock.Calls()), mock.Remaining())
+	}
+	if a.GetStatus() != model.StatusFailed {
+		t.Errorf("status = %s", a.GetStatus())
+	}
+}
+
+func TestExecuteTaskBudget(t *testing.T) {
+	mock := provider.NewMock(
+		provider.MockResponse{ToolCalls: []provider.ToolCall{{ID: "call_1", ToolName: SearchToolName, Params: map[string]any{"query": "q"}}}},
+		provider.MockResponse{Content: "不应发送"},
+	)
+	budgets := &usage.Budgets{Step: usage.Budget{MaxRequests: 1}}
+	a := NewAgent(WithModel("m"), WithRole(DemandAnalysisRole), WithUserPrompt("hi"),
+		WithEnableSearch(true), WithSearchProvider(&fakeSearch{}),
+		WithGuard(usage.NewGuard("step", budgets, nil, time.Now())))
+
+	_, _, err := a.ExecuteTaskContext(context.Background(), mock)
+	var budgetErr *usage.BudgetExceededError
+	if !errors.As(err, &budgetErr) || budgetErr.Kind != usage.KindRequests || budgetErr.Scope != "step:step" {
+		t.Fatalf("err = %v, want step request budget exceeded", err)
+	}
+	// 预算在发送前检查，第二轮不会发出
+	if len(mock.Calls()) != 1 || mock.Remaining() != 1 {
+		t.Errorf("calls = %d, remaining = %d", len(mock.Calls()), mock.Remaining())
+	}
+}
+
+func assertMessages(t *testing.T, got, want []util.PromptType) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("messages = %d, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i].Role != want[i].Role || got[i].Content != want[i].Content {
+			t.Errorf("message %d = %s %q, want %s %q", i, got[i].Role, got[i].Content, want[i].Role, want[i].Content)
+		}
+	}
+}
+
+func TestExecuteTaskNoRetryAfterPartialStream(t *testing.T) {
+	mock := provider.NewMock(
+		provider.MockResponse{Chunks: []string{"部分"}, StatusCode: 503},
+		provider.MockResponse{Chunks: []string{"完整"}},
+	)
+	var streamed strings.Builder
+	a := NewAgent(WithModel("m"), WithRole(DemandAnalysisRole), WithUserPrompt("hi"), WithRetryPolicy(noDelay()),
+		WithStream(func(delta string) { streamed.WriteString(delta) }))
+
+	_, _, err := a.ExecuteTaskContext(context.Background(), mock)
+	if provider.Classify(err) != provider.ClassServer {
+		t.Fatalf("err = %v, want classified server error", err)
+	}
+	if streamed.String() != "部分" {
+		t.Errorf("streamed = %q, want only the partial output", streamed.String())
+	}
+	if len(mock.Calls()) != 1 || mock.Remaining() != 1 {
+		t.Errorf("calls = %d, remaining = %d", len(mock.Calls()), mock.Remaining())
+	}
+}
+
+func TestExecuteTaskRetryBeforeStream(t *testing.T) {
+	mock := provider.NewMock(
+		provider.MockResponse{StatusCode: 503},
+		provider.MockResponse{Chunks: []string{"完", "整"}},
+	)
+	var streamed strings.Builder
+	a := NewAgent(WithModel("m"), WithRole(DemandAnalysisRole), WithUserPrompt("hi"), WithRetryPolicy(noDelay()),
+		WithStream(func(delta string) { streamed.WriteString(delta) }))
+
+	_, content, err := a.ExecuteTaskContext(context.Background(), mock)
+	if err != nil || content != "完整" || streamed.String() != "完整" {
+		t.Errorf("content = %q, streamed = %q, err = %v", content, streamed.String(), err)
+	}
+}
@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"learn/internal/model"
+	"learn/internal/provider"
+	"learn/internal/usage"
+)
+
+// AttemptEvent 一次模型请求结束
+type AttemptEvent struct {
+	Agent    string
+	Model    string
+	Provider string
+	Attempt  int
+	Duration time.Duration
+	Usage    provider.Usage
+	Cached   bool
+	Err      error
+	// Retrying 失败后是否会重试
+	Retrying bool
+}
+
+// TaskEvent 一次任务执行结束
+type TaskEvent struct {
+	Agent    string
+	Model    string
+	Provider string
+	Status   model.Status
+	Usage    usage.Stats
+	Duration time.Duration
+	Err      error
+}
+
+// ToolCallEvent 模型发起一次工具调用
+type ToolCallEvent struct {
+	Agent  string
+	Tool   string
+	Params map[string]any
+	// Round 工具调用轮次，从 1 开始
+	Round int
+}
+
+// Hooks Agent 事件回调，未设置的字段会被忽略
+type Hooks struct {
+	OnAttempt  func(ctx context.Context, e AttemptEvent)
+	OnTask     func(ctx context.Context, e TaskEvent)
+	OnToolCall func(ctx context.Context, e ToolCallEvent)
+}
+
+var (
+	hooksMu sync.RWMutex
+	hooks   []Hooks
+)
+
+// AddHooks 注册全局回调，对所有 Agent 生效
+func AddHooks(h Hooks) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, h)
+}
+
+// WithHooks 设置只对该 Agent 生效的回调，在全局回调之后调用
+func WithHooks(h Hooks) Option {
+	return func(cfg *AConfig) {
+		cfg.Hooks = append(cfg.Hooks, h)
+	}
+}
+
+// hooks 返回全局回调与 Agent 自身的回调
+func (a *Agent) hooks() []Hooks {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	return append(slices.Clone(hooks), a.config.Hooks...)
+}
+
+func (a *Agent) emitAttempt(ctx context.Context, e AttemptEvent) {
+	for _, h := range a.hooks() {
+		if h.OnAttempt != nil {
+			h.OnAttempt(ctx, e)
+		}
+	}
+}
+
+func (a *Agent) emitTask(ctx context.Context, e TaskEvent) {
+	for _, h := range a.hooks() {
+		if h.OnTask != nil {
+			h.OnTask(ctx, e)
+		}
+	}
+}
+
+func (a *Agent) emitToolCall(ctx context.Context, e ToolCallEvent) {
+	for _, h := range a.hooks() {
+		if h.OnToolCall != nil {
+			h.OnToolCall(ctx, e)
+		}
+	}
+}
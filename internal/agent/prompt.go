@@ -12,9 +12,10 @@ const (
 	AssistanceRole     Role = "协助"
 	MonitoringRole     Role = "监控"
 	ResultFeedbackRole Role = "结果反馈"
+	EvaluatorRole      Role = "评审"
 )
 
-// RolePromptMap 存储 Agent 角色和对应的 Prompt 字符串
+// RolePromptMap 存储内置 Agent 角色和对应的 Prompt 字符串，文件定义的角色见 LoadRoles
 var RolePromptMap = map[Role]string{
 	DemandAnalysisRole: prompts.DemandAnalysisPrompt,
 	FrontEndRole:       prompts.FrontEndPrompt,
@@ -22,9 +23,11 @@ var RolePromptMap = map[Role]string{
 	AssistanceRole:     prompts.AssistancePrompt,
 	MonitoringRole:     prompts.MonitoringPrompt,
 	ResultFeedbackRole: prompts.ResultFeedbackPrompt,
+	EvaluatorRole:      prompts.EvaluatorPrompt,
 }
 
-// GetAgentPrompt 获取 Agent 的 Prompt
+// GetAgentPrompt 获取 Agent 的 Prompt（未渲染），文件中的定义优先
 func GetAgentPrompt(role Role) string {
-	return RolePromptMap[role]
+	spec, _ := LookupRole(role)
+	return spec.Prompt
 }
@@ -0,0 +1,254 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 角色的输出格式
+const (
+	FormatText = "text"
+	// FormatJSON 请求服务端的 JSON 模式，响应不是合法 JSON 时按 invalid_json 错误重试
+	FormatJSON = "json"
+)
+
+// RoleSpec 角色定义，内置角色来自 RolePromptMap，也可以由 YAML 或 Markdown 文件定义
+type RoleSpec struct {
+	Name Role `yaml:"name" json:"name"`
+	// Prompt 系统提示词，按 text/template 渲染，可用变量见 PromptData
+	Prompt string `yaml:"prompt" json:"prompt"`
+	// Model 默认模型或模型别名，请求与配置中为角色指定的模型优先
+	Model string `yaml:"model" json:"model,omitempty"`
+	// Temperature 为空时不设置
+	Temperature *float64 `yaml:"temperature" json:"temperature,omitempty"`
+	// Tools 可用的工具，目前只有 search
+	Tools []string `yaml:"tools" json:"tools,omitempty"`
+	// OutputFormat 输出格式 text|json，默认 text
+	OutputFormat string `yaml:"outputFormat" json:"outputFormat,omitempty"`
+	// Version 提示词版本，随每个步骤记录；为空时按提示词内容计算，见 PromptVersion
+	Version string `yaml:"version" json:"version,omitempty"`
+	// Source 定义所在的文件，内置角色为空
+	Source string `yaml:"-" json:"source,omitempty"`
+}
+
+// PromptData 渲染系统提示词时可用的变量，如 {{.Request}}、{{index .Steps "Requester"}}、{{.Locale}}
+type PromptData struct {
+	// Request 用户需求
+	Request string
+	// Steps 已完成步骤的输出，key 为步骤名
+	Steps map[string]string
+	// Locale 输出语言，如 zh-CN
+	Locale string
+}
+
+var (
+	rolesMu sync.RWMutex
+	// fileRoles 由文件定义的角色，与内置角色同名时覆盖其中已填写的字段
+	fileRoles = map[Role]RoleSpec{}
+)
+
+// LookupRole 返回角色定义，文件中的定义与内置角色合并
+func LookupRole(role Role) (RoleSpec, bool) {
+	rolesMu.RLock()
+	defer rolesMu.RUnlock()
+	return lookupRole(role, fileRoles)
+}
+
+func lookupRole(role Role, defined map[Role]RoleSpec) (RoleSpec, bool) {
+	spec, ok := defined[role]
+	prompt, builtin := RolePromptMap[role]
+	if !builtin {
+		return spec, ok
+	}
+	if !ok {
+		return RoleSpec{Name: role, Prompt: prompt}, true
+	}
+	if spec.Prompt == "" {
+		spec.Prompt = prompt
+		spec.Version = ""
+	}
+	return spec, true
+}
+
+// PromptVersion 返回提示词的版本：显式声明的版本优先，否则为提示词模板内容哈希的前 12 位
+func PromptVersion(prompt, declared string) string {
+	if declared != "" {
+		return declared
+	}
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:6])
+}
+
+// RoleNames 返回全部角色名
+func RoleNames() []string {
+	rolesMu.RLock()
+	defer rolesMu.RUnlock()
+	names := make([]string, 0, len(RolePromptMap)+len(fileRoles))
+	for role := range RolePromptMap {
+		names = append(names, string(role))
+	}
+	for role := range fileRoles {
+		if _, ok := RolePromptMap[role]; !ok {
+			names = append(names, string(role))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetRoles 替换由文件定义的角色，通常在加载配置时调用
+func SetRoles(specs []RoleSpec) {
+	next := make(map[Role]RoleSpec, len(specs))
+	for _, spec := range specs {
+		next[spec.Name] = spec
+	}
+	rolesMu.Lock()
+	defer rolesMu.Unlock()
+	fileRoles = next
+}
+
+// LoadRoles 读取目录中的角色定义（*.yaml、*.yml、*.md），目录不存在时返回空
+// Markdown 文件以 --- 包围的 YAML 头部定义其他字段，正文作为系统提示词；未填写 name 时使用文件名
+func LoadRoles(dir string) ([]RoleSpec, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取角色目录失败: %w", err)
+	}
+
+	var specs []RoleSpec
+	seen := make(map[Role]string)
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".md") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		spec, err := LoadRoleFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if prev, ok := seen[spec.Name]; ok {
+			return nil, fmt.Errorf("角色 %s 在 %s 与 %s 中重复定义", spec.Name, prev, path)
+		}
+		seen[spec.Name] = path
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// LoadRoleFile 读取并校验单个角色文件
+func LoadRoleFile(path string) (RoleSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RoleSpec{}, fmt.Errorf("读取角色文件失败: %w", err)
+	}
+
+	var spec RoleSpec
+	if strings.EqualFold(filepath.Ext(path), ".md") {
+		header, body := splitFrontMatter(string(data))
+		if err := yaml.Unmarshal([]byte(header), &spec); err != nil {
+			return RoleSpec{}, fmt.Errorf("解析角色文件 %s 失败: %w", path, err)
+		}
+		spec.Prompt = strings.TrimSpace(body)
+	} else if err := yaml.Unmarshal(data, &spec); err != nil {
+		return RoleSpec{}, fmt.Errorf("解析角色文件 %s 失败: %w", path, err)
+	}
+	if spec.Name == "" {
+		spec.Name = Role(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)))
+	}
+	spec.Source = path
+
+	if err := validateRole(spec); err != nil {
+		return RoleSpec{}, fmt.Errorf("角色文件 %s: %w", path, err)
+	}
+	return spec, nil
+}
+
+// splitFrontMatter 拆分 Markdown 的 YAML 头部与正文，没有头部时整个文件都是正文
+func splitFrontMatter(text string) (header, body string) {
+	text = strings.TrimPrefix(text, "\ufeff")
+	if !strings.HasPrefix(text, "---") {
+		return "", text
+	}
+	rest := strings.TrimLeft(text[3:], " \t")
+	rest = strings.TrimPrefix(strings.TrimPrefix(rest, "\r"), "\n")
+	end := strings.Index(rest, "\n---")
+	if end < 0 {
+		return "", text
+	}
+	header = rest[:end]
+	body = rest[end+len("\n---"):]
+	if i := strings.IndexByte(body, '\n'); i >= 0 {
+		body = body[i+1:]
+	} else {
+		body = ""
+	}
+	return header, body
+}
+
+// validateRole 校验角色定义，内置角色可以只覆盖部分字段
+func validateRole(spec RoleSpec) error {
+	if _, builtin := RolePromptMap[spec.Name]; !builtin && strings.TrimSpace(spec.Prompt) == "" {
+		return errors.New("prompt 不能为空")
+	}
+	if _, err := parsePrompt(spec.Prompt); err != nil {
+		return fmt.Errorf("prompt 模板错误: %w", err)
+	}
+	for _, tool := range spec.Tools {
+		if tool != SearchToolName {
+			return fmt.Errorf("未知工具: %s", tool)
+		}
+	}
+	switch spec.OutputFormat {
+	case "", FormatText, FormatJSON:
+	default:
+		return fmt.Errorf("outputFormat 必须为 %s|%s", FormatText, FormatJSON)
+	}
+	if spec.Temperature != nil && (*spec.Temperature < 0 || *spec.Temperature > 2) {
+		return errors.New("temperature 必须在 0~2 之间")
+	}
+	return nil
+}
+
+func parsePrompt(text string) (*template.Template, error) {
+	return template.New("prompt").Option("missingkey=zero").Parse(text)
+}
+
+// RenderPrompt 按 text/template 渲染提示词，不含模板语法时原样返回
+func RenderPrompt(text string, data PromptData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := parsePrompt(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// hasTool 角色是否声明了工具
+func (s RoleSpec) hasTool(name string) bool {
+	return slices.Contains(s.Tools, name)
+}
@@ -0,0 +1,173 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeRoleFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadRoles(t *testing.T) {
+	dir := writeRoleFiles(t, map[string]string{
+		"reviewer.yaml": `
+name: 代码评审
+prompt: "评审 {{.Request}}"
+model: coder
+temperature: 0.2
+tools: [search]
+outputFormat: json
+version: v2
+`,
+		"翻译.md": "---\ntemperature: 0\n---\n把 {{index .Steps \"Requester\"}} 翻译为 {{.Locale}}\n",
+		// 内置角色只覆盖模型，提示词沿用内置定义
+		"demand.yml": "name: 需求分析\nmodel: planner\n",
+		"notes.txt":  "不是角色定义",
+	})
+
+	specs, err := LoadRoles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[Role]RoleSpec)
+	for _, spec := range specs {
+		byName[spec.Name] = spec
+	}
+	if len(specs) != 3 {
+		t.Fatalf("loaded %d roles: %+v", len(specs), specs)
+	}
+
+	reviewer := byName["代码评审"]
+	if reviewer.Prompt != "评审 {{.Request}}" || reviewer.Model != "coder" || *reviewer.Temperature != 0.2 ||
+		!reviewer.hasTool(SearchToolName) || reviewer.OutputFormat != FormatJSON || reviewer.Version != "v2" {
+		t.Errorf("yaml role = %+v", reviewer)
+	}
+	// Markdown 未填写 name 时使用文件名，正文作为提示词
+	translator, ok := byName["翻译"]
+	if !ok || translator.Prompt != `把 {{index .Steps "Requester"}} 翻译为 {{.Locale}}` || *translator.Temperature != 0 {
+		t.Errorf("markdown role = %+v", translator)
+	}
+	if translator.Source != filepath.Join(dir, "翻译.md") {
+		t.Errorf("source = %s", translator.Source)
+	}
+
+	if specs, err := LoadRoles(filepath.Join(dir, "missing")); err != nil || specs != nil {
+		t.Errorf("missing dir: specs = %v, err = %v", specs, err)
+	}
+}
+
+func TestLoadRolesInvalid(t *testing.T) {
+	tests := map[string]struct {
+		files map[string]string
+		want  string
+	}{
+		"duplicate": {map[string]string{"a.yaml": "name: x\nprompt: a", "b.md": "---\nname: x\n---\nb"}, "重复定义"},
+		"no prompt": {map[string]string{"a.yaml": "name: x"}, "prompt 不能为空"},
+		"template":  {map[string]string{"a.yaml": "prompt: '{{.Request'"}, "模板错误"},
+		"tool":      {map[string]string{"a.yaml": "prompt: a\ntools: [shell]"}, "未知工具"},
+		"format":    {map[string]string{"a.yaml": "prompt: a\noutputFormat: xml"}, "outputFormat"},
+		"temp":      {map[string]string{"a.yaml": "prompt: a\ntemperature: 3"}, "temperature"},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := LoadRoles(writeRoleFiles(t, tt.files))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupRoleMergesBuiltin(t *testing.T) {
+	temperature := 0.0
+	SetRoles([]RoleSpec{
+		{Name: DemandAnalysisRole, Model: "planner", Version: "ignored"},
+		{Name: FrontEndRole, Prompt: "自定义 {{.Locale}}", Version: "v3"},
+		{Name: "代码评审", Prompt: "评审 {{.Request}}", Temperature: &temperature},
+	})
+	t.Cleanup(func() { SetRoles(nil) })
+
+	demand, ok := LookupRole(DemandAnalysisRole)
+	if !ok || demand.Prompt != RolePromptMap[DemandAnalysisRole] || demand.Model != "planner" {
+		t.Errorf("demand = %+v", demand)
+	}
+	// 沿用内置提示词时版本按内容计算
+	if demand.Version != "" {
+		t.Errorf("demand version = %q, want computed from builtin prompt", demand.Version)
+	}
+	if frontEnd, _ := LookupRole(FrontEndRole); frontEnd.Prompt != "自定义 {{.Locale}}" || frontEnd.Version != "v3" {
+		t.Errorf("front end = %+v", frontEnd)
+	}
+	if _, ok := LookupRole("不存在"); ok {
+		t.Error("unknown role found")
+	}
+
+	names := strings.Join(RoleNames(), ",")
+	if !strings.Contains(names, "代码评审") || strings.Count(names, string(DemandAnalysisRole)) != 1 {
+		t.Errorf("names = %s", names)
+	}
+}
+
+func TestRenderPrompt(t *testing.T) {
+	data := PromptData{
+		Request: "做一个登录页",
+		Steps:   map[string]string{"Requester": "需求文档"},
+		Locale:  "en-US",
+	}
+	tests := map[string]string{
+		`需求：{{.Request}}，分析：{{index .Steps "Requester"}}，语言：{{.Locale}}`: "需求：做一个登录页，分析：需求文档，语言：en-US",
+		// 尚未执行的步骤为空
+		`{{index .Steps "Thinker"}}|`: "|",
+		"没有模板 {.Request}":             "没有模板 {.Request}",
+	}
+	for text, want := range tests {
+		got, err := RenderPrompt(text, data)
+		if err != nil || got != want {
+			t.Errorf("RenderPrompt(%q) = %q, %v, want %q", text, got, err, want)
+		}
+	}
+}
+
+func TestAgentAppliesRoleSpec(t *testing.T) {
+	temperature := 0.0
+	SetRoles([]RoleSpec{{
+		Name:         "代码评审",
+		Prompt:       `评审 {{.Request}}，参考 {{index .Steps "Requester"}}，使用 {{.Locale}}`,
+		Temperature:  &temperature,
+		Tools:        []string{SearchToolName},
+		OutputFormat: FormatJSON,
+	}})
+	t.Cleanup(func() { SetRoles(nil) })
+
+	a := NewAgent(WithRole("代码评审"), WithPromptData(PromptData{
+		Request: "登录页",
+		Steps:   map[string]string{"Requester": "需求文档"},
+		Locale:  "zh-CN",
+	}))
+	if _, prompt := a.EchoRoleInfo(); prompt != "评审 登录页，参考 需求文档，使用 zh-CN" {
+		t.Errorf("system prompt = %q", prompt)
+	}
+	template, version := a.GetPrompt()
+	if !strings.HasPrefix(template, "评审 {{.Request}}") || version != PromptVersion(template, "") {
+		t.Errorf("template = %q, version = %q", template, version)
+	}
+	if a.config.Options["temperature"] != 0.0 || !a.config.EnableSearch || a.config.Format != FormatJSON {
+		t.Errorf("options = %v, search = %v, format = %q", a.config.Options, a.config.EnableSearch, a.config.Format)
+	}
+
+	// 选项中指定的温度与格式优先于角色定义
+	a = NewAgent(WithRole("代码评审"), WithTemperature(0.7), WithFormat(FormatText))
+	if a.config.Options["temperature"] != 0.7 || a.config.Format != FormatText {
+		t.Errorf("options = %v, format = %q", a.config.Options, a.config.Format)
+	}
+}
@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"learn/internal/provider"
+)
+
+// RetryPolicy 重试策略
+type RetryPolicy struct {
+	// MaxAttempts 最大尝试次数（含首次）
+	MaxAttempts int
+	// BaseDelay 首次重试前的等待时间，之后按指数增长，最长 MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter 随机抖动比例，取值 0~1
+	Jitter float64
+	// RetryOn 允许重试的错误分类
+	RetryOn []provider.ErrorClass
+}
+
+// DefaultRetryPolicy 默认重试策略
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   1 * time.Second,
+		MaxDelay:    30 * time.Second,
+		Jitter:      0.2,
+		RetryOn: []provider.ErrorClass{
+			provider.ClassTransport,
+			provider.ClassRateLimited,
+			provider.ClassServer,
+			provider.ClassEmptyContent,
+			provider.ClassInvalidJSON,
+		},
+	}
+}
+
+// shouldRetry 判断错误是否可以重试
+func (p RetryPolicy) shouldRetry(err error) bool {
+	return slices.Contains(p.RetryOn, provider.Classify(err))
+}
+
+// delay 计算第 attempt 次失败后的等待时间，优先采用服务端的 Retry-After
+func (p RetryPolicy) delay(attempt int, err error) time.Duration {
+	if pe, ok := asProviderError(err); ok && pe.RetryAfter > 0 {
+		return pe.RetryAfter
+	}
+
+	d := p.BaseDelay << attempt
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// sleep 等待指定时间，ctx 取消时提前返回
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
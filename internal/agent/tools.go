@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+const (
+	// SearchToolName 搜索工具名称
+	SearchToolName = "search"
+	// maxToolRounds 单次任务最多进行的工具调用轮数
+	maxToolRounds = 3
+	// searchResultLimit 每次搜索返回的结果条数
+	searchResultLimit = 5
+)
+
+// searchToolSchema 搜索工具定义，兼容 Ollama 与 OpenAI 的 function 格式
+func searchToolSchema() map[string]any {
+	return map[string]any{
+		"type": "function",
+		"function": map[string]any{
+			"name":        SearchToolName,
+			"description": "检索团队文档或外部资料，返回与查询相关的片段",
+			"parameters": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"query": map[string]any{
+						"type":        "string",
+						"description": "搜索关键词",
+					},
+				},
+				"required": []string{"query"},
+			},
+		},
+	}
+}
+
+// searchEnabled 是否由本地搜索工具承接 EnableSearch
+func (a *Agent) searchEnabled() bool {
+	return a.config.EnableSearch && a.config.SearchProvider != nil
+}
+
+// runTool 执行工具调用并返回交给模型的文本结果
+func (a *Agent) runTool(ctx context.Context, call ToolCall) string {
+	if call.ToolName != SearchToolName || !a.searchEnabled() {
+		return fmt.Sprintf("未知工具: %s", call.ToolName)
+	}
+
+	query, _ := call.Params["query"].(string)
+	if query == "" {
+		return "缺少搜索关键词"
+	}
+
+	results, err := a.config.SearchProvider.Search(ctx, query, searchResultLimit)
+	if err != nil {
+		slog.WarnContext(ctx, "搜索失败", "query", query, "error", err)
+		return fmt.Sprintf("搜索失败: %s", err)
+	}
+	if len(results) == 0 {
+		return "未找到相关结果"
+	}
+
+	var sb strings.Builder
+	for i, r := range results {
+		fmt.Fprintf(&sb, "[%d] %s\n%s\n%s\n\n", i+1, r.Title, r.URL, r.Content)
+	}
+	return strings.TrimSpace(sb.String())
+}
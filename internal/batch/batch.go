@@ -0,0 +1,278 @@
+package batch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"learn/internal/chain"
+	"learn/internal/model"
+	"learn/internal/usage"
+	"learn/internal/util"
+)
+
+// 单行输入的最大长度
+const maxLine = 4 << 20
+
+// Item 批量文件中的一行请求
+type Item struct {
+	// ID 请求 ID，为空时使用 line-<行号>，恢复批次时据此跳过已处理的请求
+	ID        string          `json:"id,omitempty"`
+	Prompt    string          `json:"prompt"`
+	Pipeline  string          `json:"pipeline,omitempty"`
+	Overrides chain.Overrides `json:"overrides,omitempty"`
+}
+
+// Output 每条请求对应的一行结果
+type Output struct {
+	ID       string       `json:"id"`
+	Line     int          `json:"line"`
+	RunID    string       `json:"run_id,omitempty"`
+	Pipeline string       `json:"pipeline,omitempty"`
+	Status   model.Status `json:"status"`
+	// Outputs 各步骤的输出
+	Outputs   map[string]string `json:"outputs,omitempty"`
+	Artifacts []string          `json:"artifacts,omitempty"`
+	Usage     usage.Stats       `json:"usage"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// Summary 批次统计
+type Summary struct {
+	Total     int `json:"total"`
+	Skipped   int `json:"skipped"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+	Cancelled int `json:"cancelled"`
+}
+
+// Runner 批量执行器
+type Runner struct {
+	concurrency  int
+	artifactsDir string
+	setup        func(c *chain.Chain)
+	skip         map[string]bool
+}
+
+// Option 定义 with 选项函数类型
+type Option func(*Runner)
+
+// WithConcurrency 设置并发数，默认 1
+func WithConcurrency(n int) Option {
+	return func(r *Runner) {
+		r.concurrency = n
+	}
+}
+
+// WithArtifactsDir 设置生成文件的根目录，每条请求写入 <dir>/<id>
+func WithArtifactsDir(dir string) Option {
+	return func(r *Runner) {
+		r.artifactsDir = dir
+	}
+}
+
+// WithSetup 设置链条初始化函数，用于注入模型服务、存储与预算
+func WithSetup(setup func(c *chain.Chain)) Option {
+	return func(r *Runner) {
+		r.setup = setup
+	}
+}
+
+// WithSkip 设置需要跳过的请求 ID，通常由 Done 读取已有结果得到
+func WithSkip(ids map[string]bool) Option {
+	return func(r *Runner) {
+		r.skip = ids
+	}
+}
+
+// NewRunner 创建批量执行器
+func NewRunner(opts ...Option) *Runner {
+	r := &Runner{concurrency: 1}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.concurrency = max(r.concurrency, 1)
+	return r
+}
+
+// Run 逐行读取 in 中的请求并发执行，每条请求完成后向 out 写入一行结果
+// ctx 取消后不再开始新的请求，未开始的请求不会写入结果，可在恢复时继续处理
+func (r *Runner) Run(ctx context.Context, in io.Reader, out io.Writer) (Summary, error) {
+	var (
+		summary Summary
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, r.concurrency)
+		enc     = json.NewEncoder(out)
+		werr    error
+	)
+	enc.SetEscapeHTML(false)
+
+	write := func(o *Output) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch o.Status {
+		case model.StatusCompleted:
+			summary.Completed++
+		case model.StatusCancelled:
+			summary.Cancelled++
+		default:
+			summary.Failed++
+		}
+		if err := enc.Encode(o); err != nil && werr == nil {
+			werr = fmt.Errorf("写入结果失败: %w", err)
+		}
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64<<10), maxLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		mu.Lock()
+		summary.Total++
+		mu.Unlock()
+
+		item, err := parseItem(text, line)
+		if r.skip[item.ID] {
+			mu.Lock()
+			summary.Skipped++
+			mu.Unlock()
+			continue
+		}
+		if err != nil {
+			write(&Output{ID: item.ID, Line: line, Status: model.StatusFailed, Error: err.Error()})
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(item Item, line int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			write(r.runItem(ctx, item, line))
+		}(item, line)
+	}
+	wg.Wait()
+
+	if err := scanner.Err(); err != nil {
+		return summary, fmt.Errorf("读取批量文件失败: %w", err)
+	}
+	if werr != nil {
+		return summary, werr
+	}
+	return summary, ctx.Err()
+}
+
+// parseItem 解析一行请求，失败时返回的 Item 仍带有 ID
+func parseItem(text string, line int) (Item, error) {
+	var item Item
+	err := json.Unmarshal([]byte(text), &item)
+	if item.ID == "" {
+		item.ID = fmt.Sprintf("line-%d", line)
+	}
+	if err != nil {
+		return item, fmt.Errorf("解析请求失败: %w", err)
+	}
+	if item.Prompt == "" {
+		return item, fmt.Errorf("缺少 prompt")
+	}
+	if item.Pipeline == "" {
+		item.Pipeline = chain.DefaultPipeline
+	}
+	return item, nil
+}
+
+// runItem 执行单条请求
+func (r *Runner) runItem(ctx context.Context, item Item, line int) *Output {
+	out := &Output{ID: item.ID, Line: line, Pipeline: item.Pipeline, Status: model.StatusFailed}
+
+	ch, err := chain.NewPipeline(item.Pipeline)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	if r.setup != nil {
+		r.setup(ch)
+	}
+
+	request := &chain.Request{Message: item.Prompt, Data: make(map[string]any)}
+	timeout, err := item.Overrides.Apply(request)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if r.artifactsDir != "" {
+		request.ArtifactDir = filepath.Join(r.artifactsDir, util.SafeName(item.ID))
+	}
+
+	result := ch.HandleRequest(request.SetContext(ctx))
+	out.RunID = result.RunID
+	out.Status = result.Status
+	out.Error = result.Error
+	out.Usage = result.Usage
+	out.Artifacts = result.Artifacts
+	out.Outputs = make(map[string]string, len(result.Data))
+	for step, v := range result.Data {
+		out.Outputs[step] = stepOutput(v)
+	}
+	return out
+}
+
+// stepOutput 提取步骤输出，Agent 步骤取 data 字段
+func stepOutput(v any) string {
+	if m, ok := v.(map[string]any); ok {
+		s, _ := m["data"].(string)
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// Done 读取已有的结果文件，返回无需再次执行的请求 ID
+// 已取消的请求总会重新执行，retryFailed 为 true 时失败的请求也会重新执行；同一 ID 以最后一行为准
+func Done(r io.Reader, retryFailed bool) (map[string]bool, error) {
+	done := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxLine)
+	for scanner.Scan() {
+		var out Output
+		if err := json.Unmarshal(scanner.Bytes(), &out); err != nil || out.ID == "" {
+			// 中断时可能留下不完整的最后一行
+			continue
+		}
+		switch out.Status {
+		case model.StatusCompleted:
+			done[out.ID] = true
+		case model.StatusFailed:
+			done[out.ID] = !retryFailed
+		default:
+			done[out.ID] = false
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取结果文件失败: %w", err)
+	}
+	return done, nil
+}
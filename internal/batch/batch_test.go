@@ -0,0 +1,114 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"learn/internal/chain"
+	"learn/internal/model"
+	"learn/internal/provider"
+)
+
+// previous 上一次批次写入的结果文件，包含重复 ID 与中断留下的不完整行
+const previous = `{"id":"done","line":1,"status":"已完成"}
+{"id":"failed","line":2,"status":"失败","error":"boom"}
+{"id":"cancelled","line":3,"status":"已取消"}
+{"id":"fixed","line":4,"status":"失败"}
+{"id":"fixed","line":4,"status":"已完成"}
+{"id":"regressed","line":5,"status":"已完成"}
+{"id":"regressed","line":5,"status":"失败"}
+{"id":"trunc`
+
+func TestDone(t *testing.T) {
+	tests := []struct {
+		retryFailed bool
+		want        map[string]bool
+	}{
+		{false, map[string]bool{"done": true, "failed": true, "cancelled": false, "fixed": true, "regressed": true}},
+		{true, map[string]bool{"done": true, "failed": false, "cancelled": false, "fixed": true, "regressed": false}},
+	}
+	for _, tt := range tests {
+		got, err := Done(strings.NewReader(previous), tt.retryFailed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("retryFailed=%v: Done = %v, want %v", tt.retryFailed, got, tt.want)
+		}
+		for id, want := range tt.want {
+			if got[id] != want {
+				t.Errorf("retryFailed=%v: Done[%s] = %v, want %v", tt.retryFailed, id, got[id], want)
+			}
+		}
+	}
+}
+
+func TestRunResume(t *testing.T) {
+	done, err := Done(strings.NewReader(previous), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := strings.Join([]string{
+		`{"id":"done","prompt":"p1","pipeline":"analyze"}`,
+		`{"id":"failed","prompt":"p2","pipeline":"analyze"}`,
+		`{"id":"cancelled","prompt":"p3","pipeline":"analyze"}`,
+		`{"id":"fixed","prompt":"p4","pipeline":"analyze"}`,
+		`{"id":"done","prompt":"p1 again","pipeline":"analyze"}`,
+	}, "\n")
+	mock := provider.NewMock().Reply("r2").Reply("r3")
+	r := NewRunner(WithSkip(done), WithSetup(func(c *chain.Chain) { c.SetProvider(mock) }))
+
+	var out bytes.Buffer
+	summary, err := r.Run(context.Background(), strings.NewReader(input), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Summary{Total: 5, Skipped: 3, Completed: 2}
+	if summary != want {
+		t.Errorf("summary = %+v, want %+v", summary, want)
+	}
+
+	var ids []string
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var o Output
+		if err := json.Unmarshal(scanner.Bytes(), &o); err != nil {
+			t.Fatal(err)
+		}
+		if o.Status != model.StatusCompleted {
+			t.Errorf("%s status = %s (%s)", o.ID, o.Status, o.Error)
+		}
+		ids = append(ids, o.ID)
+	}
+	if strings.Join(ids, ",") != "failed,cancelled" {
+		t.Errorf("executed = %v, want failed and cancelled only", ids)
+	}
+	if mock.Remaining() != 0 {
+		t.Errorf("remaining = %d", mock.Remaining())
+	}
+}
+
+func TestRunCancelledLeavesRemainingUnwritten(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var out bytes.Buffer
+	summary, err := NewRunner().Run(ctx, strings.NewReader(`{"id":"a","prompt":"p"}`), &out)
+	if err != context.Canceled {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if out.Len() != 0 || summary.Completed+summary.Failed+summary.Cancelled != 0 {
+		t.Errorf("summary = %+v, output = %q", summary, out.String())
+	}
+
+	// 未写入结果的请求在恢复时会重新执行
+	done, err := Done(&out, false)
+	if err != nil || len(done) != 0 {
+		t.Errorf("Done = %v, err = %v", done, err)
+	}
+}
@@ -1,14 +1,74 @@
 package chain
 
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"learn/internal/agent"
+	"learn/internal/database"
+	"learn/internal/logger"
+	"learn/internal/model"
+	"learn/internal/provider"
+	"learn/internal/trace"
+	"learn/internal/usage"
+	"learn/internal/util"
+)
+
 // Result 处理结果
 type Result struct {
-	Data map[string]interface{}
+	RunID    string                 `json:"run_id"`
+	Pipeline string                 `json:"pipeline,omitempty"`
+	Status   model.Status           `json:"status"`
+	Error    string                 `json:"error,omitempty"`
+	Data     map[string]interface{} `json:"data"`
+	// Usage 整个运行的用量，Steps 为各步骤用量
+	Usage usage.Stats       `json:"usage"`
+	Steps []usage.StepUsage `json:"steps"`
+	// Output 最后一个 Producer 步骤的输出，作为整个链条的输出
+	Output string `json:"output,omitempty"`
+	// Artifacts 本次运行生成的文件
+	Artifacts []string `json:"artifacts,omitempty"`
+	// Prompts 本次执行的各步骤使用的提示词版本，恢复运行时不包含已跳过的步骤
+	Prompts []database.PromptRecord `json:"prompts,omitempty"`
+	// Err 导致运行中止或失败的原始错误，可用 errors.As 判断是否为 *usage.BudgetExceededError
+	Err error `json:"-"`
+}
+
+// UsageStore 用量存储
+type UsageStore interface {
+	SaveUsage(ctx context.Context, records ...database.UsageRecord) error
+}
+
+// RunStore 运行记录存储，用于查看与恢复运行
+type RunStore interface {
+	SaveRun(ctx context.Context, r *database.RunRecord) error
+}
+
+// PromptStore 提示词版本存储，记录每个步骤使用的提示词
+type PromptStore interface {
+	SavePrompts(ctx context.Context, records ...database.PromptRecord) error
 }
 
 // Chain 责任链
 type Chain struct {
-	head Handler
-	tail Handler
+	head     Handler
+	tail     Handler
+	handlers []Handler
+	// pipeline 流水线名称，恢复运行时据此重建链条
+	pipeline string
+	provider provider.Provider
+	store    UsageStore
+	runs     RunStore
+	versions PromptStore
+	budgets  *usage.Budgets
+	prompts  map[agent.Role]string
+	models   map[agent.Role]string
+	locale   string
 }
 
 // NewChain 创建责任链
@@ -25,14 +85,259 @@ func (c *Chain) AddHandler(handler Handler) *Chain {
 		c.tail.SetNext(handler)
 		c.tail = handler
 	}
+	c.handlers = append(c.handlers, handler)
+	return c
+}
+
+// OutputStep 返回产生链条输出的步骤，即最后一个 Producer，不存在时为空
+func (c *Chain) OutputStep() string {
+	if p := c.producer(); p != nil {
+		return p.GetName()
+	}
+	return ""
+}
+
+func (c *Chain) producer() Producer {
+	for i := len(c.handlers) - 1; i >= 0; i-- {
+		if p, ok := c.handlers[i].(Producer); ok {
+			return p
+		}
+	}
+	return nil
+}
+
+// Pipeline 返回流水线名称，通过 NewChain 创建时为空
+func (c *Chain) Pipeline() string {
+	return c.pipeline
+}
+
+// SetProvider 设置链条默认使用的模型服务，请求未指定时生效
+func (c *Chain) SetProvider(p provider.Provider) *Chain {
+	c.provider = p
+	return c
+}
+
+// SetStore 设置用量存储，运行结束后写入各步骤用量；store 同时实现 RunStore、PromptStore 时也会保存运行记录与提示词版本
+func (c *Chain) SetStore(store UsageStore) *Chain {
+	c.store = store
+	c.runs, _ = store.(RunStore)
+	c.versions, _ = store.(PromptStore)
+	return c
+}
+
+// SetPrompts 设置角色系统提示词的覆盖，请求未指定时生效
+func (c *Chain) SetPrompts(prompts map[agent.Role]string) *Chain {
+	c.prompts = prompts
+	return c
+}
+
+// SetModels 设置角色使用的模型，请求未指定时生效
+func (c *Chain) SetModels(models map[agent.Role]string) *Chain {
+	c.models = models
+	return c
+}
+
+// SetLocale 设置输出语言，请求未指定时生效
+func (c *Chain) SetLocale(locale string) *Chain {
+	c.locale = locale
+	return c
+}
+
+// SetBudgets 设置默认预算，请求未指定时生效
+func (c *Chain) SetBudgets(budgets *usage.Budgets) *Chain {
+	c.budgets = budgets
 	return c
 }
 
 // HandleRequest 处理请求
 func (c *Chain) HandleRequest(request *Request) *Result {
-	if c.head == nil {
-		return &Result{Data: request.Data}
+	if request.Provider == nil {
+		request.Provider = c.provider
+	}
+	if request.RunID == "" {
+		request.RunID = util.NewID()
+	}
+	if request.Usage == nil {
+		request.Usage = usage.NewTracker()
+	}
+	if request.Budgets == nil {
+		request.Budgets = c.budgets
+	}
+	if request.Prompts == nil {
+		request.Prompts = c.prompts
+	}
+	if request.Models == nil {
+		request.Models = c.models
+	}
+	if request.Locale == "" {
+		request.Locale = c.locale
+	}
+	if request.Data == nil {
+		request.Data = make(map[string]any)
+	}
+	request.start = time.Now()
+	if request.createdAt.IsZero() {
+		request.createdAt = request.start
+	}
+
+	ctx, span := trace.Start(request.Context(), "chain.run")
+	span.Set("run_id", request.RunID)
+	request.SetContext(logger.With(ctx, "run_id", request.RunID, "trace_id", span.TraceID))
+	slog.InfoContext(request.Context(), "开始运行")
+	emitRunStart(request.Context(), request.RunID)
+	request.emit(Event{Type: EventRunStart})
+	running := &Result{RunID: request.RunID, Status: model.StatusRunning}
+	request.checkpoint = func() { c.saveRun(request.Context(), request, running) }
+	request.checkpoint()
+
+	if head := c.resumeFrom(request); head != nil {
+		if len(request.Completed) > 0 {
+			slog.InfoContext(request.Context(), "恢复运行", "from", head.GetName(), "completed", request.Completed)
+		}
+		head.Handle(request)
+	}
+	// 中途取消时后续步骤的失败不应被视为运行失败
+	if err := request.Context().Err(); err != nil && request.Err == nil {
+		request.Abort(err)
+	}
+
+	result := &Result{
+		RunID:     request.RunID,
+		Pipeline:  c.pipeline,
+		Status:    model.StatusCompleted,
+		Data:      request.Data,
+		Usage:     request.Usage.Total(),
+		Steps:     request.Usage.Steps(),
+		Err:       request.Err,
+		Artifacts: request.Artifacts,
+		Prompts:   request.prompts,
+	}
+	if p := c.producer(); p != nil {
+		result.Output = p.Output(request)
+	}
+	if result.Err == nil {
+		result.Err = request.stepErr
+	}
+	if result.Err != nil {
+		result.Status = model.StatusFailed
+		if errors.Is(result.Err, context.Canceled) {
+			result.Status = model.StatusCancelled
+		}
+		result.Error = result.Err.Error()
+	}
+	slog.InfoContext(request.Context(), "运行结束",
+		"status", result.Status, "requests", result.Usage.Requests,
+		"tokens", result.Usage.TotalTokens(), "cost", result.Usage.Cost,
+		"elapsed", time.Since(request.start))
+	span.Set("status", string(result.Status)).
+		Set("requests", result.Usage.Requests).
+		Set("tokens", result.Usage.TotalTokens()).
+		Set("cost", result.Usage.Cost)
+	span.Finish(result.Err)
+	emitRunEnd(request.Context(), result, time.Since(request.start))
+
+	// 取消后仍需写入记录
+	saveCtx := context.WithoutCancel(request.Context())
+	c.saveRun(saveCtx, request, result)
+	c.saveUsage(saveCtx, result)
+	c.savePrompts(saveCtx, result)
+
+	// 记录写入后再通知结束，接收方可立即查询完整结果
+	if result.Err != nil {
+		request.emit(Event{Type: EventError, Error: result.Error})
+	}
+	request.emit(Event{Type: EventRunEnd, Status: result.Status, Error: result.Error})
+	return result
+}
+
+// resumeFrom 返回第一个未完成的处理类，全部完成时返回 nil
+// 其后的步骤依赖它的输出，会被重新执行，因此只保留它之前的已完成步骤
+func (c *Chain) resumeFrom(request *Request) Handler {
+	for i, h := range c.handlers {
+		if !slices.Contains(request.Completed, h.GetName()) {
+			request.Completed = request.Completed[:0]
+			for _, done := range c.handlers[:i] {
+				request.Completed = append(request.Completed, done.GetName())
+			}
+			return h
+		}
+	}
+	return nil
+}
+
+// saveRun 写入运行记录
+func (c *Chain) saveRun(ctx context.Context, request *Request, result *Result) {
+	if c.runs == nil {
+		return
+	}
+
+	record := &database.RunRecord{
+		RunID:     request.RunID,
+		Pipeline:  c.pipeline,
+		Message:   request.Message,
+		Status:    string(result.Status),
+		Error:     result.Error,
+		Steps:     request.Completed,
+		CreatedAt: request.createdAt,
+	}
+	data, err := json.Marshal(request.Data)
+	if err != nil {
+		slog.WarnContext(ctx, "运行数据无法序列化", "error", err)
+	} else {
+		record.Data = data
+	}
+	if err := c.runs.SaveRun(ctx, record); err != nil {
+		slog.ErrorContext(ctx, "保存运行记录失败", "error", err)
+	}
+}
+
+// ResumeRequest 由运行记录构造请求，已完成的步骤在处理时会被跳过
+func ResumeRequest(record *database.RunRecord) (*Request, error) {
+	request := &Request{
+		Message:   record.Message,
+		Data:      make(map[string]any),
+		RunID:     record.RunID,
+		Completed: append([]string(nil), record.Steps...),
+		createdAt: record.CreatedAt,
+	}
+	if len(record.Data) > 0 {
+		if err := json.Unmarshal(record.Data, &request.Data); err != nil {
+			return nil, fmt.Errorf("解析运行数据失败: %w", err)
+		}
+	}
+	return request, nil
+}
+
+// saveUsage 写入用量记录
+func (c *Chain) saveUsage(ctx context.Context, result *Result) {
+	if c.store == nil || len(result.Steps) == 0 {
+		return
+	}
+
+	records := make([]database.UsageRecord, 0, len(result.Steps))
+	for _, s := range result.Steps {
+		records = append(records, database.UsageRecord{
+			RunID:            result.RunID,
+			Step:             s.Step,
+			Model:            s.Model,
+			Requests:         s.Requests,
+			CachedRequests:   s.CachedRequests,
+			PromptTokens:     s.PromptTokens,
+			CompletionTokens: s.CompletionTokens,
+			Cost:             s.Cost,
+		})
+	}
+	if err := c.store.SaveUsage(ctx, records...); err != nil {
+		slog.ErrorContext(ctx, "保存用量失败", "error", err)
+	}
+}
+
+// savePrompts 写入各步骤使用的提示词版本
+func (c *Chain) savePrompts(ctx context.Context, result *Result) {
+	if c.versions == nil || len(result.Prompts) == 0 {
+		return
+	}
+	if err := c.versions.SavePrompts(ctx, result.Prompts...); err != nil {
+		slog.ErrorContext(ctx, "保存提示词版本失败", "error", err)
 	}
-	c.head.Handle(request)
-	return &Result{Data: request.Data}
 }
@@ -0,0 +1,60 @@
+package chain
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"learn/internal/config"
+	"learn/internal/model"
+	"learn/internal/provider"
+)
+
+// 设置了 LLM_RECORD=1 时向本地 Ollama 录制，否则离线回放，录制文件不存在时失败
+func TestRequesterThinkerReplay(t *testing.T) {
+	p, err := provider.NewCassette(provider.NewOllama("ollama", config.OllamaUrl), "testdata/requester_thinker.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewChain().SetProvider(p)
+	c.AddHandler(NewRequester())
+	c.AddHandler(NewThinker())
+
+	dir := t.TempDir()
+	result := c.HandleRequest(&Request{Message: "帮我做一个待办清单网页", ArtifactDir: dir})
+	if result.Err != nil {
+		t.Fatalf("run failed: %v", result.Err)
+	}
+	if result.Status != model.StatusCompleted {
+		t.Errorf("status = %s, want %s", result.Status, model.StatusCompleted)
+	}
+
+	request := &Request{Data: result.Data}
+	if got := agentOutput(request, "Requester"); !strings.Contains(got, "待办清单") {
+		t.Errorf("Requester output = %q", got)
+	}
+	thinker := agentOutput(request, "Thinker")
+	if !strings.HasPrefix(thinker, "```html") {
+		t.Errorf("Thinker output = %q", thinker)
+	}
+	if result.Output != thinker {
+		t.Errorf("Output = %q, want Thinker output", result.Output)
+	}
+
+	if result.Usage.Requests != 2 {
+		t.Errorf("requests = %d, want 2", result.Usage.Requests)
+	}
+	if len(result.Steps) != 2 || result.Steps[0].Step != "Requester" || result.Steps[1].Step != "Thinker" {
+		t.Errorf("steps = %+v", result.Steps)
+	}
+
+	html, err := os.ReadFile(filepath.Join(dir, "demo.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(html), "<title>待办清单</title>") {
+		t.Errorf("demo.html = %q", html)
+	}
+}
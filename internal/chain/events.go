@@ -0,0 +1,81 @@
+package chain
+
+import (
+	"context"
+	"time"
+
+	"learn/internal/agent"
+	"learn/internal/model"
+)
+
+// EventType 运行事件类型
+type EventType string
+
+const (
+	EventRunStart   EventType = "run-start"
+	EventStepStart  EventType = "step-start"
+	EventStepEnd    EventType = "step-end"
+	EventTaskStatus EventType = "task-status"
+	EventToolCall   EventType = "tool-call"
+	EventDelta      EventType = "delta"
+	EventError      EventType = "error"
+	EventRunEnd     EventType = "run-end"
+)
+
+// Event 单次运行的进度事件，通过 Request.OnEvent 接收
+type Event struct {
+	Type  EventType `json:"type"`
+	RunID string    `json:"run_id"`
+	Step  string    `json:"step,omitempty"`
+	Agent string    `json:"agent,omitempty"`
+	// Status 任务或运行的状态，用于 task-status 与 run-end
+	Status model.Status `json:"status,omitempty"`
+	// Tool 与 Params 用于 tool-call
+	Tool   string         `json:"tool,omitempty"`
+	Params map[string]any `json:"params,omitempty"`
+	// Delta 模型流式输出的增量文本
+	Delta string    `json:"delta,omitempty"`
+	Error string    `json:"error,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// emit 发送事件，未设置 OnEvent 时忽略
+func (r *Request) emit(e Event) {
+	if r.OnEvent == nil {
+		return
+	}
+	e.RunID = r.RunID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	r.OnEvent(e)
+}
+
+// agentOptions 返回步骤中 Agent 的公共选项：提示词覆盖与模板变量，以及将流式输出、任务状态与工具调用转为运行事件
+func (r *Request) agentOptions(step string) []agent.Option {
+	opts := []agent.Option{agent.WithPromptData(r.promptData())}
+	if len(r.Prompts) > 0 {
+		opts = append(opts, agent.WithPromptOverrides(r.Prompts), agent.WithPromptVersions(r.PromptVersions))
+	}
+	if r.OnEvent == nil {
+		return opts
+	}
+	return append(opts,
+		agent.WithStream(func(delta string) {
+			r.emit(Event{Type: EventDelta, Step: step, Delta: delta})
+		}),
+		agent.WithHooks(agent.Hooks{
+			OnAttempt: func(_ context.Context, e agent.AttemptEvent) {
+				if e.Err != nil {
+					r.emit(Event{Type: EventError, Step: step, Agent: e.Agent, Error: e.Err.Error()})
+				}
+			},
+			OnTask: func(_ context.Context, e agent.TaskEvent) {
+				r.emit(Event{Type: EventTaskStatus, Step: step, Agent: e.Agent, Status: e.Status})
+			},
+			OnToolCall: func(_ context.Context, e agent.ToolCallEvent) {
+				r.emit(Event{Type: EventToolCall, Step: step, Agent: e.Agent, Tool: e.Tool, Params: e.Params})
+			},
+		}),
+	)
+}
@@ -1,18 +1,185 @@
 package chain
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"learn/internal/agent"
-	"learn/internal/gen"
+	"learn/internal/config"
+	"learn/internal/database"
+	"learn/internal/logger"
+	"learn/internal/provider"
+	"learn/internal/trace"
+	"learn/internal/usage"
 	"learn/internal/util"
-	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"time"
 )
 
 // Request 请求上下文
 type Request struct {
 	Message string
 	Data    map[string]any
+	// Provider 本次请求使用的模型服务，为空时使用本地 Ollama
+	Provider provider.Provider
+	// RunID 运行 ID，为空时由 Chain 生成
+	RunID string
+	// Usage 各步骤用量汇总
+	Usage *usage.Tracker
+	// Budgets 预算，为空时使用 Chain 的设置
+	Budgets *usage.Budgets
+	// Model 覆盖各 Agent 步骤使用的模型，为空时按 Models 选择
+	Model string
+	// Models 角色使用的模型（可为别名），未配置的角色使用步骤的默认模型；为空时使用 Chain 的设置
+	Models map[agent.Role]string
+	// ArtifactDir 步骤生成文件的目录，为空时写入当前目录
+	ArtifactDir string
+	// Artifacts 本次运行生成的文件
+	Artifacts []string
+	// Prompts 覆盖角色的系统提示词，为空时使用 Chain 的设置
+	Prompts map[agent.Role]string
+	// PromptVersions Prompts 中提示词的版本，未设置时按内容计算
+	PromptVersions map[agent.Role]string
+	// Locale 输出语言，渲染提示词时作为 {{.Locale}}，为空时使用 Chain 的设置
+	Locale string
+	// OnEvent 接收运行进度事件，包括模型的流式输出；在运行所在的 goroutine 中同步调用
+	OnEvent func(e Event)
+	// Err 导致链条中止的错误
+	Err error
+	// Completed 已成功完成的步骤，恢复运行时会被跳过
+	Completed []string
+
+	ctx       context.Context
+	start     time.Time
+	createdAt time.Time
+	// stepErr 第一个失败步骤的错误，步骤失败不会中止链条，但运行状态为失败
+	stepErr error
+	// checkpoint 每个步骤开始前保存进度，由 Chain 设置
+	checkpoint func()
+	// prompts 本次运行各步骤使用的提示词版本
+	prompts []database.PromptRecord
+}
+
+// Context 返回请求的 ctx，未设置时为 context.Background()
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// SetContext 设置请求的 ctx，用于取消与传递日志属性
+func (r *Request) SetContext(ctx context.Context) *Request {
+	r.ctx = ctx
+	return r
+}
+
+// beginStep 开始一个步骤，返回带有步骤日志属性与追踪跨度的 ctx，以及结束步骤的函数
+func (r *Request) beginStep(step string) (context.Context, func(err error)) {
+	// 此时前面步骤的输出已写入 Data
+	if r.checkpoint != nil {
+		r.checkpoint()
+	}
+	ctx, span := trace.Start(r.Context(), "chain.step")
+	span.Set("step", step).Set("run_id", r.RunID)
+	ctx = logger.With(ctx, "step", step)
+
+	slog.InfoContext(ctx, "开始处理")
+	emitStepStart(ctx, StepEvent{RunID: r.RunID, Step: step})
+	r.emit(Event{Type: EventStepStart, Step: step})
+
+	start := time.Now()
+	return ctx, func(err error) {
+		slog.InfoContext(ctx, "处理完成", "error", err)
+		if err == nil {
+			r.Completed = append(r.Completed, step)
+		} else if r.stepErr == nil {
+			r.stepErr = fmt.Errorf("%s: %w", step, err)
+		}
+		span.Finish(err)
+		emitStepEnd(ctx, StepEvent{RunID: r.RunID, Step: step, Duration: time.Since(start), Err: err})
+		end := Event{Type: EventStepEnd, Step: step}
+		if err != nil {
+			end.Error = err.Error()
+		}
+		r.emit(end)
+	}
+}
+
+// Abort 中止链条，后续处理类不再执行
+func (r *Request) Abort(err error) {
+	r.Err = err
+}
+
+// guard 返回步骤的预算检查，未设置预算时返回 nil
+func (r *Request) guard(step string) *usage.Guard {
+	if r.Budgets == nil {
+		return nil
+	}
+	return usage.NewGuard(step, r.Budgets, r.Usage, r.start)
+}
+
+// abortOnBudget 预算超限时中止链条
+func (r *Request) abortOnBudget(ctx context.Context, err error) bool {
+	var budgetErr *usage.BudgetExceededError
+	if errors.As(err, &budgetErr) {
+		slog.WarnContext(ctx, "预算超限，中止运行",
+			"scope", budgetErr.Scope, "kind", budgetErr.Kind, "limit", budgetErr.Limit, "used", budgetErr.Used)
+		r.Abort(err)
+		return true
+	}
+	return false
+}
+
+// provider 返回本次请求使用的模型服务
+func (r *Request) provider() provider.Provider {
+	if r.Provider != nil {
+		return r.Provider
+	}
+	return defaultProvider
+}
+
+// model 返回角色使用的模型：运行时指定的模型优先，其次为角色配置的模型，再次为角色定义中的默认模型
+func (r *Request) model(role agent.Role, defaultModel string) string {
+	if r.Model != "" {
+		return r.Model
+	}
+	if m := r.Models[role]; m != "" {
+		return m
+	}
+	if spec, ok := agent.LookupRole(role); ok && spec.Model != "" {
+		return spec.Model
+	}
+	return defaultModel
+}
+
+// promptData 返回渲染提示词的变量，Steps 为已完成步骤的输出
+func (r *Request) promptData() agent.PromptData {
+	data := agent.PromptData{Request: r.Message, Locale: r.Locale, Steps: make(map[string]string, len(r.Completed))}
+	for _, step := range r.Completed {
+		if out := agentOutput(r, step); out != "" {
+			data.Steps[step] = out
+		}
+	}
+	return data
+}
+
+// writeArtifact 将步骤生成的文件写入 ArtifactDir 并记录路径
+func (r *Request) writeArtifact(name string, data []byte) (string, error) {
+	path := name
+	if r.ArtifactDir != "" {
+		if err := os.MkdirAll(r.ArtifactDir, 0755); err != nil {
+			return "", err
+		}
+		path = filepath.Join(r.ArtifactDir, name)
+	}
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		return "", err
+	}
+	r.Artifacts = append(r.Artifacts, path)
+	return path, nil
 }
 
 // Handler 处理接口
@@ -22,6 +189,47 @@ type Handler interface {
 	GetName() string
 }
 
+// Producer 调用模型产生输出的处理类，链条的输出取最后一个 Producer 的结果
+type Producer interface {
+	Handler
+	Output(request *Request) string
+}
+
+// agentOutput 读取 Agent 步骤写入 Data 的输出
+func agentOutput(request *Request, step string) string {
+	if m, ok := request.Data[step].(map[string]interface{}); ok {
+		s, _ := m["data"].(string)
+		return s
+	}
+	return ""
+}
+
+// recordUsage 记录步骤用量
+func (r *Request) recordUsage(ctx context.Context, step string, app *agent.Agent) {
+	if r.Usage == nil {
+		r.Usage = usage.NewTracker()
+	}
+	stats := app.Usage()
+	r.Usage.Add(step, app.ResolvedModel(), stats)
+	prompt, version := app.GetPrompt()
+	r.prompts = append(r.prompts, database.PromptRecord{
+		RunID:   r.RunID,
+		Step:    step,
+		Role:    string(app.GetRole()),
+		Version: version,
+		Model:   app.GetModel(),
+		Prompt:  prompt,
+	})
+
+	if span := trace.FromContext(ctx); span != nil {
+		span.Set("model", app.GetModel()).
+			Set("prompt_version", version).
+			Set("requests", stats.Requests).
+			Set("prompt_tokens", stats.PromptTokens).
+			Set("completion_tokens", stats.CompletionTokens)
+	}
+}
+
 // BaseHandler 基础处理类
 type BaseHandler struct {
 	next Handler
@@ -38,7 +246,7 @@ func (h *BaseHandler) GetName() string {
 }
 
 func (h *BaseHandler) Handle(request *Request) *Request {
-	if h.next != nil {
+	if h.next != nil && request.Err == nil {
 		return h.next.Handle(request)
 	}
 	return request
@@ -60,22 +268,32 @@ func NewRequester() *Requester {
 }
 
 var (
-	// 新建模型
-	ollama = gen.NewLocalLargeModelClient()
+	// 默认模型服务，使用默认限流
+	defaultProvider provider.Provider = provider.NewLimited(
+		provider.NewOllama("ollama", config.OllamaUrl),
+		provider.DefaultLimits,
+	)
 )
 
 func (h *Requester) Handle(request *Request) *Request {
-	app := agent.NewAgent(
+	ctx, endStep := request.beginStep(h.GetName())
+	app := agent.NewAgent(append([]agent.Option{
 		agent.WithTaskID("1"),
 		agent.WithAgentName("需求分析者"),
-		agent.WithModel("qwen2.5-coder:1.5b"),
+		agent.WithModel(request.model(agent.DemandAnalysisRole, "qwen2.5-coder:1.5b")),
 		agent.WithRole(agent.DemandAnalysisRole),
 		agent.WithUserPrompt(request.Message),
-	)
+		agent.WithGuard(request.guard(h.GetName())),
+	}, request.agentOptions(h.GetName())...)...)
 
-	fmt.Println(h.GetName(), "处理请求:", request.Message)
+	logger.Payload(ctx, "用户需求", "message", request.Message)
 
-	toolCalls, result, err := app.ExecuteTask(ollama.Client)
+	toolCalls, result, err := app.ExecuteTaskContext(ctx, request.provider())
+	request.recordUsage(ctx, h.GetName(), app)
+	endStep(err)
+	if request.abortOnBudget(ctx, err) {
+		return request
+	}
 
 	request.Data["Requester"] = map[string]interface{}{
 		"tool_calls": toolCalls,
@@ -86,14 +304,18 @@ func (h *Requester) Handle(request *Request) *Request {
 		if reqMap, ok := request.Data["Requester"].(map[string]interface{}); ok {
 			reqMap["err"] = err.Error()
 		} else {
-			log.Printf("Requester数据格式错误: %T", request.Data["Requester"])
+			slog.ErrorContext(ctx, "Requester数据格式错误", "type", fmt.Sprintf("%T", request.Data["Requester"]))
 		}
 	}
 
-	log.Printf("处理完成: %s\n", request.Message)
 	return h.BaseHandler.Handle(request)
 }
 
+// Output 返回需求分析结果
+func (h *Requester) Output(request *Request) string {
+	return agentOutput(request, h.GetName())
+}
+
 type Thinker struct {
 	BaseHandler
 }
@@ -103,17 +325,31 @@ func NewThinker() *Thinker {
 }
 
 func (h *Thinker) Handle(request *Request) *Request {
-	app := agent.NewAgent(
+	ctx, endStep := request.beginStep(h.GetName())
+	// 配置的流水线可能不包含需求分析，缺少输入时步骤失败而不是继续请求模型
+	demand := agentOutput(request, "Requester")
+	if demand == "" {
+		err := errors.New("缺少 Requester 步骤的输出")
+		request.Data["Thinker"] = map[string]interface{}{"err": err.Error()}
+		endStep(err)
+		return h.BaseHandler.Handle(request)
+	}
+
+	app := agent.NewAgent(append([]agent.Option{
 		agent.WithTaskID("2"),
 		agent.WithAgentName("前端工程师"),
-		agent.WithModel("qwen2.5-coder:1.5b"),
+		agent.WithModel(request.model(agent.FrontEndRole, "qwen2.5-coder:1.5b")),
 		agent.WithRole(agent.FrontEndRole),
 		agent.WithUserPrompt("请给我完整代码，不允许省略。"),
-	)
-
-	toolCalls, result, err := app.ExecuteTask(ollama.Client, util.AppendUserPrompt(
-		request.Data["Requester"].(map[string]interface{})["data"].(string),
-	))
+		agent.WithGuard(request.guard(h.GetName())),
+	}, request.agentOptions(h.GetName())...)...)
+
+	toolCalls, result, err := app.ExecuteTaskContext(ctx, request.provider(), util.AppendUserPrompt(demand))
+	request.recordUsage(ctx, h.GetName(), app)
+	if request.abortOnBudget(ctx, err) {
+		endStep(err)
+		return request
+	}
 
 	request.Data["Thinker"] = map[string]interface{}{
 		"tool_calls": toolCalls,
@@ -124,23 +360,28 @@ func (h *Thinker) Handle(request *Request) *Request {
 		if thinkMap, ok := request.Data["Thinker"].(map[string]interface{}); ok {
 			thinkMap["err"] = err.Error()
 		} else {
-			log.Printf("Thinker数据格式错误: %T", request.Data["Thinker"])
+			slog.ErrorContext(ctx, "Thinker数据格式错误", "type", fmt.Sprintf("%T", request.Data["Thinker"]))
 		}
 	}
 
-	fmt.Println("前端工程师", "处理结果:", result)
+	logger.Payload(ctx, "处理结果", "result", result)
 	codeBlocks := util.ExtractCodeBlocks(result)
 	if len(codeBlocks) > 0 {
-		err := os.WriteFile("demo.html", []byte(codeBlocks[0]), 0666)
-		if err != nil {
-			log.Printf("写入文件失败: %s\n", err)
+		if _, err := request.writeArtifact("demo.html", []byte(codeBlocks[0])); err != nil {
+			slog.ErrorContext(ctx, "写入文件失败", "error", err)
 		}
 	} else {
-		log.Println("未找到代码块")
+		slog.WarnContext(ctx, "未找到代码块")
 	}
+	endStep(err)
 	return h.BaseHandler.Handle(request)
 }
 
+// Output 返回生成的前端代码
+func (h *Thinker) Output(request *Request) string {
+	return agentOutput(request, h.GetName())
+}
+
 type TaskPublisher struct {
 	BaseHandler
 }
@@ -150,8 +391,9 @@ func NewTaskPublisher() *TaskPublisher {
 }
 
 func (h *TaskPublisher) Handle(request *Request) *Request {
-	fmt.Println(h.GetName(), "处理请求:", request.Message)
+	_, endStep := request.beginStep(h.GetName())
 	request.Data["TaskPublisher"] = "处理成功"
+	endStep(nil)
 	return h.BaseHandler.Handle(request)
 }
 
@@ -164,8 +406,9 @@ func NewTaskExecutor() *TaskExecutor {
 }
 
 func (h *TaskExecutor) Handle(request *Request) *Request {
-	fmt.Println(h.GetName(), "处理请求:", request.Message)
+	_, endStep := request.beginStep(h.GetName())
 	request.Data["TaskExecutor"] = "处理成功"
+	endStep(nil)
 	return h.BaseHandler.Handle(request)
 }
 
@@ -178,7 +421,8 @@ func NewTaskCollector() *TaskCollector {
 }
 
 func (h *TaskCollector) Handle(request *Request) *Request {
-	fmt.Println(h.GetName(), "处理请求:", request.Message)
+	_, endStep := request.beginStep(h.GetName())
 	request.Data["TaskCollector"] = "处理成功"
+	endStep(nil)
 	return h.BaseHandler.Handle(request)
 }
@@ -0,0 +1,80 @@
+package chain
+
+import (
+	"errors"
+	"testing"
+
+	"learn/internal/provider"
+	"learn/internal/usage"
+	"learn/internal/util"
+)
+
+func newTestChain(p provider.Provider, handlers ...Handler) *Chain {
+	c := NewChain().SetProvider(p)
+	for _, h := range handlers {
+		c.AddHandler(h)
+	}
+	return c
+}
+
+func sameMessage(a, b util.PromptType) bool {
+	return a.Role == b.Role && a.Content == b.Content
+}
+
+func TestThinkerUsesRequesterOutput(t *testing.T) {
+	mock := provider.NewMock().Reply("需求：登录页，包含用户名与密码").Reply("```html\n<form></form>\n```")
+	c := newTestChain(mock, NewRequester(), NewThinker())
+
+	result := c.HandleRequest(&Request{Message: "做一个登录页", ArtifactDir: t.TempDir()})
+	if result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if len(mock.Calls()) != 2 {
+		t.Fatalf("calls = %d, want 2", len(mock.Calls()))
+	}
+
+	requester := mock.Messages(0)
+	if last := requester[len(requester)-1]; !sameMessage(last, util.AppendUserPrompt("做一个登录页")) {
+		t.Errorf("Requester last message = %+v", last)
+	}
+	thinker := mock.Messages(1)
+	if len(thinker) != 3 || thinker[0].Role != "system" ||
+		!sameMessage(thinker[1], util.AppendUserPrompt("请给我完整代码，不允许省略。")) ||
+		!sameMessage(thinker[2], util.AppendUserPrompt("需求：登录页，包含用户名与密码")) {
+		t.Errorf("Thinker messages = %+v", thinker)
+	}
+	if result.Output != "```html\n<form></form>\n```" {
+		t.Errorf("Output = %q", result.Output)
+	}
+}
+
+func TestRunBudgetAbortsChain(t *testing.T) {
+	mock := provider.NewMock().Reply("需求").Reply("不应发送")
+	c := newTestChain(mock, NewRequester(), NewThinker()).
+		SetBudgets(&usage.Budgets{Run: usage.Budget{MaxRequests: 1}})
+
+	result := c.HandleRequest(&Request{Message: "做一个登录页", ArtifactDir: t.TempDir()})
+	var budgetErr *usage.BudgetExceededError
+	if !errors.As(result.Err, &budgetErr) || budgetErr.Scope != "run" {
+		t.Fatalf("err = %v, want run budget exceeded", result.Err)
+	}
+	if len(mock.Calls()) != 1 || mock.Remaining() != 1 {
+		t.Errorf("calls = %d, remaining = %d", len(mock.Calls()), mock.Remaining())
+	}
+	if _, ok := result.Data["Thinker"]; ok {
+		t.Errorf("Thinker output recorded after budget abort: %v", result.Data["Thinker"])
+	}
+}
+
+func TestThinkerWithoutRequester(t *testing.T) {
+	mock := provider.NewMock()
+	c := newTestChain(mock, NewThinker())
+
+	result := c.HandleRequest(&Request{Message: "做一个登录页"})
+	if result.Err == nil {
+		t.Fatal("expected step error")
+	}
+	if len(mock.Calls()) != 0 {
+		t.Errorf("calls = %d, want 0", len(mock.Calls()))
+	}
+}
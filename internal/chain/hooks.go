@@ -0,0 +1,77 @@
+package chain
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// StepEvent 步骤开始或结束
+type StepEvent struct {
+	RunID string
+	Step  string
+	// Duration 与 Err 仅在步骤结束时有值
+	Duration time.Duration
+	Err      error
+}
+
+// Hooks 链条事件回调，未设置的字段会被忽略
+type Hooks struct {
+	OnRunStart  func(ctx context.Context, runID string)
+	OnRunEnd    func(ctx context.Context, result *Result, elapsed time.Duration)
+	OnStepStart func(ctx context.Context, e StepEvent)
+	OnStepEnd   func(ctx context.Context, e StepEvent)
+}
+
+var (
+	hooksMu sync.RWMutex
+	hooks   []Hooks
+)
+
+// AddHooks 注册全局回调，对所有链条生效
+func AddHooks(h Hooks) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, h)
+}
+
+// emit 依次调用已注册的回调
+func emit(fn func(h Hooks)) {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	for _, h := range hooks {
+		fn(h)
+	}
+}
+
+func emitRunStart(ctx context.Context, runID string) {
+	emit(func(h Hooks) {
+		if h.OnRunStart != nil {
+			h.OnRunStart(ctx, runID)
+		}
+	})
+}
+
+func emitRunEnd(ctx context.Context, result *Result, elapsed time.Duration) {
+	emit(func(h Hooks) {
+		if h.OnRunEnd != nil {
+			h.OnRunEnd(ctx, result, elapsed)
+		}
+	})
+}
+
+func emitStepStart(ctx context.Context, e StepEvent) {
+	emit(func(h Hooks) {
+		if h.OnStepStart != nil {
+			h.OnStepStart(ctx, e)
+		}
+	})
+}
+
+func emitStepEnd(ctx context.Context, e StepEvent) {
+	emit(func(h Hooks) {
+		if h.OnStepEnd != nil {
+			h.OnStepEnd(ctx, e)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package chain
+
+import (
+	"fmt"
+	"time"
+
+	"learn/internal/usage"
+)
+
+// Overrides 单次运行的覆盖项，批量文件与 HTTP 接口共用
+type Overrides struct {
+	// Model 覆盖各 Agent 步骤使用的模型
+	Model string `json:"model,omitempty"`
+	// Timeout 运行超时，如 "2m"
+	Timeout string `json:"timeout,omitempty"`
+	// Budget 整次运行的预算
+	Budget *usage.Budget `json:"budget,omitempty"`
+}
+
+// Apply 将覆盖项写入请求，返回运行超时，未设置时为 0
+func (o Overrides) Apply(request *Request) (time.Duration, error) {
+	var timeout time.Duration
+	if o.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(o.Timeout); err != nil {
+			return 0, fmt.Errorf("timeout 格式错误: %w", err)
+		}
+	}
+	if o.Model != "" {
+		request.Model = o.Model
+	}
+	if o.Budget != nil {
+		request.Budgets = &usage.Budgets{Run: *o.Budget}
+	}
+	return timeout, nil
+}
@@ -0,0 +1,135 @@
+package chain
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// DefaultPipeline 默认流水线名称
+const DefaultPipeline = "default"
+
+var (
+	pipelinesMu sync.RWMutex
+	pipelines   = map[string]func() []Handler{
+		// 需求分析 -> 前端实现 -> 任务发布 -> 执行 -> 汇总
+		DefaultPipeline: func() []Handler {
+			return []Handler{
+				NewRequester(),
+				NewThinker(),
+				NewTaskPublisher(),
+				NewTaskExecutor(),
+				NewTaskCollector(),
+			}
+		},
+		// 只做需求分析
+		"analyze": func() []Handler {
+			return []Handler{NewRequester()}
+		},
+	}
+	// configured 由配置定义的流水线，与注册的流水线同名时优先
+	configured = map[string][]string{}
+
+	// handlers 可在配置中引用的步骤，key 为 Handler.GetName()
+	handlers = map[string]func() Handler{
+		"Requester":     func() Handler { return NewRequester() },
+		"Thinker":       func() Handler { return NewThinker() },
+		"TaskPublisher": func() Handler { return NewTaskPublisher() },
+		"TaskExecutor":  func() Handler { return NewTaskExecutor() },
+		"TaskCollector": func() Handler { return NewTaskCollector() },
+	}
+)
+
+// RegisterPipeline 注册流水线，同名时覆盖；build 每次调用都应返回新的处理类
+func RegisterPipeline(name string, build func() []Handler) {
+	pipelinesMu.Lock()
+	defer pipelinesMu.Unlock()
+	pipelines[name] = build
+}
+
+// RegisterHandler 注册可在配置的流水线中引用的步骤，build 每次调用都应返回新的处理类
+func RegisterHandler(name string, build func() Handler) {
+	pipelinesMu.Lock()
+	defer pipelinesMu.Unlock()
+	handlers[name] = build
+}
+
+// ValidatePipelines 校验流水线定义引用的步骤都已注册
+func ValidatePipelines(defs map[string][]string) error {
+	pipelinesMu.RLock()
+	defer pipelinesMu.RUnlock()
+	for name, steps := range defs {
+		if len(steps) == 0 {
+			return fmt.Errorf("流水线 %s 没有步骤", name)
+		}
+		for _, step := range steps {
+			if _, ok := handlers[step]; !ok {
+				return fmt.Errorf("流水线 %s 引用了未知的步骤: %s", name, step)
+			}
+		}
+	}
+	return nil
+}
+
+// SetPipelines 以配置中的定义整体替换由配置定义的流水线，只影响之后创建的链条
+func SetPipelines(defs map[string][]string) error {
+	if err := ValidatePipelines(defs); err != nil {
+		return err
+	}
+	next := make(map[string][]string, len(defs))
+	for name, steps := range defs {
+		next[name] = append([]string(nil), steps...)
+	}
+
+	pipelinesMu.Lock()
+	defer pipelinesMu.Unlock()
+	configured = next
+	return nil
+}
+
+// Pipelines 返回可用的流水线名称
+func Pipelines() []string {
+	pipelinesMu.RLock()
+	defer pipelinesMu.RUnlock()
+	names := make([]string, 0, len(pipelines)+len(configured))
+	for name := range pipelines {
+		names = append(names, name)
+	}
+	for name := range configured {
+		if _, ok := pipelines[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewPipeline 按名称创建链条
+func NewPipeline(name string) (*Chain, error) {
+	pipelinesMu.RLock()
+	build, ok := pipelines[name]
+	if steps, found := configured[name]; found {
+		builders := make([]func() Handler, len(steps))
+		for i, step := range steps {
+			builders[i] = handlers[step]
+		}
+		build, ok = func() []Handler {
+			hs := make([]Handler, len(builders))
+			for i, b := range builders {
+				hs[i] = b()
+			}
+			return hs
+		}, true
+	}
+	pipelinesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("未知的流水线: %s", name)
+	}
+
+	c := NewChain()
+	c.pipeline = name
+	for _, h := range build() {
+		c.AddHandler(h)
+	}
+	return c, nil
+}
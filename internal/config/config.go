@@ -2,18 +2,208 @@ package config
 
 import (
 	"fmt"
-	"log"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 // Config 系统配置
 type Config struct {
-	ApiBaseUrl string `mapstructure:"apiBaseUrl"`
-	ApiBaseKey string `mapstructure:"apiBaseKey"`
-	Prefix     string `mapstructure:"prefix"`
-	LogLevel   string `mapstructure:"logLevel"`
+	ApiBaseUrl string `mapstructure:"apiBaseUrl" json:"apiBaseUrl"`
+	// ApiBaseKey 与 providers 的 apiKey、headers 以及 webhooks 的 secret 都可以写成
+	// env:NAME、file:/path 或 secret:name 引用，加载时解析
+	ApiBaseKey string `mapstructure:"apiBaseKey" json:"apiBaseKey"`
+	Prefix     string `mapstructure:"prefix" json:"prefix"`
+	LogLevel   string `mapstructure:"logLevel" json:"logLevel"`
+	LogFormat  string `mapstructure:"logFormat" json:"logFormat"`
+	LogRedact  bool   `mapstructure:"logRedact" json:"logRedact"`
+	// TraceFile 追踪数据的输出文件（OTLP JSON），为空时不开启追踪
+	TraceFile string `mapstructure:"traceFile" json:"traceFile"`
+	// MetricsAddr /metrics 监听地址，为空时不开启
+	MetricsAddr string `mapstructure:"metricsAddr" json:"metricsAddr"`
+	DBDriver   string `mapstructure:"dbDriver" json:"dbDriver"`
+	DBDsn      string `mapstructure:"dbDsn" json:"dbDsn"`
+	// Prices 模型单价表，key 为模型名或模型名前缀
+	Prices map[string]ModelPrice `mapstructure:"prices" json:"prices"`
+	// Webhooks 队列中的运行结束时通知的地址
+	Webhooks []Webhook `mapstructure:"webhooks" json:"webhooks"`
+	// PublicUrl API 服务的对外地址，用于生成通知中的下载链接
+	PublicUrl string `mapstructure:"publicUrl" json:"publicUrl"`
+	// Prompts 覆盖角色的系统提示词，key 为角色名
+	Prompts map[string]string `mapstructure:"prompts" json:"prompts"`
+	// Pipelines 流水线定义，key 为流水线名，value 为按顺序执行的步骤名；与内置流水线同名时覆盖
+	Pipelines map[string][]string `mapstructure:"pipelines" json:"pipelines"`
+
+	// RolesDir 角色定义目录（*.yaml、*.yml、*.md），与内置角色合并，随配置重新加载
+	RolesDir string `mapstructure:"rolesDir" json:"rolesDir"`
+	// Locale 输出语言，渲染提示词时作为 {{.Locale}}
+	Locale string `mapstructure:"locale" json:"locale"`
+
+	// SecretsFile 以口令加密的密钥文件，secret:name 引用从中读取
+	SecretsFile string `mapstructure:"secretsFile" json:"secretsFile"`
+	// SecretsPassphrase 解锁密钥文件的口令，默认读取环境变量 APP_SECRETS_PASSPHRASE
+	SecretsPassphrase string `mapstructure:"secretsPassphrase" json:"secretsPassphrase"`
+
+	// Providers 命名的模型服务，key 为服务名；apiBaseUrl、apiBaseKey 与 prefix 定义名为 default 的服务
+	Providers map[string]ProviderConfig `mapstructure:"providers" json:"providers"`
+	// Routers 组合多个服务的路由，key 为路由名；provider 与 models 可以像服务名一样引用路由
+	Routers map[string]RouterConfig `mapstructure:"routers" json:"routers"`
+	// Provider 模型名不是别名时使用的服务或路由，默认 default
+	Provider string `mapstructure:"provider" json:"provider"`
+	// Models 模型别名，key 为别名，Agent 可以像模型名一样使用别名
+	Models map[string]ModelAlias `mapstructure:"models" json:"models"`
+	// Roles 角色使用的模型别名，key 为角色名；运行时指定的模型优先
+	Roles map[string]string `mapstructure:"roles" json:"roles"`
+	// Cache 模型响应缓存，存储在数据库中
+	Cache CacheConfig `mapstructure:"cache" json:"cache"`
+}
+
+// CacheConfig 响应缓存配置，开启后每个命名服务各自缓存
+type CacheConfig struct {
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// TTL 缓存有效期，如 "24h"，为 "0" 时永不过期
+	TTL string `mapstructure:"ttl" json:"ttl"`
+	// Force 未设置 temperature 或 temperature > 0 的请求也使用缓存
+	Force    bool                `mapstructure:"force" json:"force"`
+	Semantic SemanticCacheConfig `mapstructure:"semantic" json:"semantic"`
+}
+
+// SemanticCacheConfig 语义缓存配置，Model 为空时只使用精确缓存
+type SemanticCacheConfig struct {
+	// Provider 计算向量的 ollama 服务，默认为 provider 指定的服务
+	Provider string `mapstructure:"provider" json:"provider"`
+	// Model 向量模型，如 nomic-embed-text
+	Model string `mapstructure:"model" json:"model"`
+	// Threshold 余弦相似度不低于该值时视为命中，不大于 0 时不开启
+	Threshold float64 `mapstructure:"threshold" json:"threshold"`
+}
+
+// EmbedProvider 返回语义缓存计算向量使用的服务名
+func (c CacheConfig) EmbedProvider(cfg *Config) string {
+	if c.Semantic.Provider == "" {
+		return cfg.DefaultProvider()
+	}
+	return c.Semantic.Provider
+}
+
+// DefaultProviderName 由 apiBaseUrl、apiBaseKey 与 prefix 定义的服务名
+const DefaultProviderName = "default"
+
+// ProviderConfig 模型服务配置
+type ProviderConfig struct {
+	// Type 服务类型 ollama|openai，openai 适用于所有 OpenAI 兼容接口
+	Type    string `mapstructure:"type" json:"type"`
+	BaseURL string `mapstructure:"baseUrl" json:"baseUrl"`
+	APIKey  string `mapstructure:"apiKey" json:"apiKey"`
+	// Path 对话接口路径，仅 openai 类型使用，默认 /v1/chat/completions
+	Path string `mapstructure:"path" json:"path"`
+	// Headers 每个请求附带的请求头
+	Headers map[string]string `mapstructure:"headers" json:"headers"`
+	// Timeout 单次请求超时，如 "2m"，为空时使用服务类型的默认值
+	Timeout string    `mapstructure:"timeout" json:"timeout"`
+	TLS     TLSConfig `mapstructure:"tls" json:"tls"`
+
+	// RPS 每秒请求数，Burst 为允许的突发请求数，TPM 为每分钟 token 数，MaxInFlight 为最大并发数；
+	// 为 0 时使用默认值（rps 1、burst 10、maxInFlight 4，tpm 不限制）；rps、tpm 与 maxInFlight 为负数时不限制
+	RPS         float64 `mapstructure:"rps" json:"rps"`
+	Burst       int     `mapstructure:"burst" json:"burst"`
+	TPM         int     `mapstructure:"tpm" json:"tpm"`
+	MaxInFlight int     `mapstructure:"maxInFlight" json:"maxInFlight"`
+}
+
+// TLSConfig 访问模型服务的 TLS 配置
+type TLSConfig struct {
+	// CAFile 额外信任的 CA 证书
+	CAFile string `mapstructure:"caFile" json:"caFile"`
+	// CertFile 与 KeyFile 为双向认证的客户端证书
+	CertFile           string `mapstructure:"certFile" json:"certFile"`
+	KeyFile            string `mapstructure:"keyFile" json:"keyFile"`
+	ServerName         string `mapstructure:"serverName" json:"serverName"`
+	InsecureSkipVerify bool   `mapstructure:"insecureSkipVerify" json:"insecureSkipVerify"`
+}
+
+// RouterConfig 路由配置，先按规则匹配，未命中时按策略在成员之间选择；成员与规则只能引用 providers 中的服务
+type RouterConfig struct {
+	// Strategy 成员选择策略 fallback|roundRobin，默认 fallback（按顺序降级）
+	Strategy string         `mapstructure:"strategy" json:"strategy"`
+	Members  []RouterMember `mapstructure:"members" json:"members"`
+	// Rules 路由规则，按顺序匹配
+	Rules []RouteRule `mapstructure:"rules" json:"rules"`
+	// MaxFailures 连续失败多少次后暂时摘除成员，默认 3
+	MaxFailures int `mapstructure:"maxFailures" json:"maxFailures"`
+	// Cooldown 摘除时长，如 "1m"，默认 30s
+	Cooldown string `mapstructure:"cooldown" json:"cooldown"`
+}
+
+// RouterMember 路由成员
+type RouterMember struct {
+	Provider string `mapstructure:"provider" json:"provider"`
+	// Weight 权重，仅 roundRobin 策略使用，默认 1
+	Weight int `mapstructure:"weight" json:"weight"`
+}
+
+// RouteRule 路由规则，ModelPrefix 与 MinPromptTokens 只能配置一个
+type RouteRule struct {
+	// ModelPrefix 模型名前缀
+	ModelPrefix string `mapstructure:"modelPrefix" json:"modelPrefix"`
+	// MinPromptTokens 估算的提示词 token 数不少于该值时命中
+	MinPromptTokens int    `mapstructure:"minPromptTokens" json:"minPromptTokens"`
+	Provider        string `mapstructure:"provider" json:"provider"`
+}
+
+// ModelAlias 模型别名指向的服务与实际模型名
+type ModelAlias struct {
+	Provider string `mapstructure:"provider" json:"provider"`
+	Model    string `mapstructure:"model" json:"model"`
+}
+
+// ProviderConfigs 返回全部命名的服务，包括由 apiBaseUrl 等定义的 default 服务（未在 providers 中覆盖时）
+func (c *Config) ProviderConfigs() map[string]ProviderConfig {
+	providers := make(map[string]ProviderConfig, len(c.Providers)+1)
+	for name, p := range c.Providers {
+		providers[name] = p
+	}
+	if _, ok := providers[DefaultProviderName]; !ok {
+		p := ProviderConfig{Type: "openai", BaseURL: c.ApiBaseUrl, APIKey: c.ApiBaseKey, Path: c.Prefix}
+		if c.Prefix == "" || strings.HasPrefix(c.Prefix, OllamaPrefix) {
+			p = ProviderConfig{Type: "ollama", BaseURL: c.ApiBaseUrl}
+		}
+		providers[DefaultProviderName] = p
+	}
+	return providers
+}
+
+// hasProvider 名称是否为已定义的服务或路由
+func (c *Config) hasProvider(name string, providers map[string]ProviderConfig) bool {
+	_, ok := providers[name]
+	if !ok {
+		_, ok = c.Routers[name]
+	}
+	return ok
+}
+
+// DefaultProvider 返回模型名不是别名时使用的服务名
+func (c *Config) DefaultProvider() string {
+	if c.Provider == "" {
+		return DefaultProviderName
+	}
+	return c.Provider
+}
+
+// Webhook 运行结束的通知地址
+type Webhook struct {
+	URL string `mapstructure:"url" json:"url"`
+	// Events 订阅的事件 run.completed|run.failed|run.cancelled，为空时订阅全部
+	Events []string `mapstructure:"events" json:"events"`
+	// Secret 签名密钥，为空时不签名
+	Secret string `mapstructure:"secret" json:"secret"`
+}
+
+// ModelPrice 模型单价，单位为每千 token 的费用
+type ModelPrice struct {
+	Prompt     float64 `mapstructure:"prompt" json:"prompt"`
+	Completion float64 `mapstructure:"completion" json:"completion"`
 }
 
 var v *viper.Viper
@@ -36,28 +226,31 @@ func init() {
 	v.SetDefault("apiBaseKey", "sk-xxx")
 	v.SetDefault("prefix", "/api/chat")
 	v.SetDefault("logLevel", "info")
-}
+	v.SetDefault("logFormat", "text")
+	v.SetDefault("dbDriver", "sqlite3")
+	v.SetDefault("dbDsn", "llm.db")
+	v.SetDefault("rolesDir", "roles")
+	v.SetDefault("locale", "zh-CN")
+	v.SetDefault("secretsFile", "")
+	v.SetDefault("secretsPassphrase", "env:APP_SECRETS_PASSPHRASE")
+	v.SetDefault("cache.ttl", "24h")
+	v.SetDefault("cache.semantic.threshold", 0.95)
 
-// LoadConfig 加载并验证配置
-func LoadConfig() (*Config, error) {
-	if err := v.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return nil, fmt.Errorf("读取配置文件失败: %w", err)
-		}
-		log.Println("使用默认配置和环境变量")
-	}
+	defaultManager = &Manager{v: v}
+}
 
-	var cfg Config
-	if err := v.Unmarshal(&cfg); err != nil {
-		return nil, fmt.Errorf("配置解析失败: %w", err)
-	}
+// SetConfigFile 指定配置文件路径，替代默认的搜索路径
+func SetConfigFile(path string) {
+	v.SetConfigFile(path)
+}
 
-	if err := validateConfig(&cfg); err != nil {
-		return nil, fmt.Errorf("配置验证失败: %w", err)
+// LoadConfig 返回默认配置管理的当前配置，只在第一次调用时读取
+// 需要监听配置变化时使用 Default()
+func LoadConfig() (*Config, error) {
+	if cfg := defaultManager.Current(); cfg != nil {
+		return cfg, nil
 	}
-
-	log.Printf("加载配置成功: ApiBaseUrl=%s, LogLevel=%s\n", cfg.ApiBaseUrl, cfg.LogLevel)
-	return &cfg, nil
+	return defaultManager.Load()
 }
 
 // validateConfig 验证配置合法性
@@ -68,6 +261,135 @@ func validateConfig(cfg *Config) error {
 	if !strings.HasPrefix(cfg.ApiBaseUrl, "http") {
 		return fmt.Errorf("apiBaseUrl 必须以 http 或 https 开头")
 	}
+	switch strings.ToLower(cfg.LogLevel) {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("logLevel 必须为 debug|info|warn|error")
+	}
+	switch strings.ToLower(cfg.LogFormat) {
+	case "text", "json":
+	default:
+		return fmt.Errorf("logFormat 必须为 text|json")
+	}
+	if err := validateProviders(cfg); err != nil {
+		return err
+	}
+	for i, h := range cfg.Webhooks {
+		if !strings.HasPrefix(h.URL, "http") {
+			return fmt.Errorf("webhooks[%d].url 必须以 http 或 https 开头", i)
+		}
+		for _, e := range h.Events {
+			switch e {
+			case "run.completed", "run.failed", "run.cancelled":
+			default:
+				return fmt.Errorf("webhooks[%d].events 不支持的事件: %s", i, e)
+			}
+		}
+	}
+	return nil
+}
+
+// validateProviders 校验模型服务与别名，确保引用的服务都存在
+func validateProviders(cfg *Config) error {
+	providers := cfg.ProviderConfigs()
+	for name, p := range providers {
+		switch p.Type {
+		case "ollama", "openai":
+		default:
+			return fmt.Errorf("providers.%s.type 必须为 ollama|openai", name)
+		}
+		if !strings.HasPrefix(p.BaseURL, "http") {
+			return fmt.Errorf("providers.%s.baseUrl 必须以 http 或 https 开头", name)
+		}
+		if p.Timeout != "" {
+			if _, err := time.ParseDuration(p.Timeout); err != nil {
+				return fmt.Errorf("providers.%s.timeout 格式错误: %w", name, err)
+			}
+		}
+		if (p.TLS.CertFile == "") != (p.TLS.KeyFile == "") {
+			return fmt.Errorf("providers.%s.tls 的 certFile 与 keyFile 必须同时配置", name)
+		}
+	}
+	if err := validateRouters(cfg, providers); err != nil {
+		return err
+	}
+	if !cfg.hasProvider(cfg.DefaultProvider(), providers) {
+		return fmt.Errorf("provider 引用了不存在的服务: %s", cfg.Provider)
+	}
+	for alias, m := range cfg.Models {
+		if !cfg.hasProvider(m.Provider, providers) {
+			return fmt.Errorf("models.%s 引用了不存在的服务: %s", alias, m.Provider)
+		}
+		if m.Model == "" {
+			return fmt.Errorf("models.%s.model 不能为空", alias)
+		}
+	}
+	for role, alias := range cfg.Roles {
+		if _, ok := cfg.Models[alias]; !ok {
+			return fmt.Errorf("roles.%s 引用了不存在的模型别名: %s", role, alias)
+		}
+	}
+	return validateCache(cfg, providers)
+}
+
+// validateCache 校验响应缓存，语义缓存只支持 ollama 服务计算向量
+func validateCache(cfg *Config, providers map[string]ProviderConfig) error {
+	c := cfg.Cache
+	if !c.Enabled {
+		return nil
+	}
+	if c.TTL != "" {
+		if _, err := time.ParseDuration(c.TTL); err != nil {
+			return fmt.Errorf("cache.ttl 格式错误: %w", err)
+		}
+	}
+	if c.Semantic.Model == "" {
+		return nil
+	}
+	name := c.EmbedProvider(cfg)
+	p, ok := providers[name]
+	if !ok {
+		return fmt.Errorf("cache.semantic.provider 引用了不存在的服务: %s", name)
+	}
+	if p.Type != "ollama" {
+		return fmt.Errorf("cache.semantic.provider 必须为 ollama 服务: %s", name)
+	}
+	return nil
+}
+
+// validateRouters 校验路由，成员与规则必须引用已定义的服务
+func validateRouters(cfg *Config, providers map[string]ProviderConfig) error {
+	for name, r := range cfg.Routers {
+		if _, ok := providers[name]; ok {
+			return fmt.Errorf("routers.%s 与 providers 中的服务同名", name)
+		}
+		switch r.Strategy {
+		case "", "fallback", "roundRobin":
+		default:
+			return fmt.Errorf("routers.%s.strategy 必须为 fallback|roundRobin", name)
+		}
+		if len(r.Members) == 0 {
+			return fmt.Errorf("routers.%s.members 不能为空", name)
+		}
+		for i, m := range r.Members {
+			if _, ok := providers[m.Provider]; !ok {
+				return fmt.Errorf("routers.%s.members[%d] 引用了不存在的服务: %s", name, i, m.Provider)
+			}
+		}
+		for i, rule := range r.Rules {
+			if (rule.ModelPrefix == "") == (rule.MinPromptTokens <= 0) {
+				return fmt.Errorf("routers.%s.rules[%d] 必须且只能配置 modelPrefix 或 minPromptTokens", name, i)
+			}
+			if _, ok := providers[rule.Provider]; !ok {
+				return fmt.Errorf("routers.%s.rules[%d] 引用了不存在的服务: %s", name, i, rule.Provider)
+			}
+		}
+		if r.Cooldown != "" {
+			if _, err := time.ParseDuration(r.Cooldown); err != nil {
+				return fmt.Errorf("routers.%s.cooldown 格式错误: %w", name, err)
+			}
+		}
+	}
 	return nil
 }
 
@@ -83,4 +405,7 @@ var DefaultConfig = Config{
 	ApiBaseKey: "sk-xxxx",
 	Prefix:     "/api/chat",
 	LogLevel:   "info",
+	LogFormat:  "text",
+	DBDriver:   "sqlite3",
+	DBDsn:      "llm.db",
 }
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// Manager 配置管理：启动时读取一次，监听配置文件变化，校验通过后原子替换当前配置
+// Current 返回的配置视为只读快照，运行开始时取一次，运行期间配置变化不影响该运行
+type Manager struct {
+	v       *viper.Viper
+	current atomic.Pointer[Config]
+
+	// mu 串行化读取与通知，viper 本身不是并发安全的
+	mu         sync.Mutex
+	validators []func(cfg *Config) error
+	listeners  []func(old, cfg *Config)
+}
+
+var defaultManager *Manager
+
+// Default 返回使用默认搜索路径与 APP_ 环境变量的配置管理
+func Default() *Manager {
+	return defaultManager
+}
+
+// AddValidator 添加校验，配置文件变化后任一校验失败时保留原配置
+// 用于校验依赖其他包的配置项，如流水线步骤是否存在
+func (m *Manager) AddValidator(fn func(cfg *Config) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.validators = append(m.validators, fn)
+}
+
+// OnChange 添加配置替换后的回调，按添加顺序在 Reload 的 goroutine 中调用
+func (m *Manager) OnChange(fn func(old, cfg *Config)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, fn)
+}
+
+// Current 返回当前配置，未加载时为 nil
+func (m *Manager) Current() *Config {
+	return m.current.Load()
+}
+
+// Load 读取并校验配置，作为当前配置；不会触发 OnChange
+func (m *Manager) Load() (*Config, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cfg, err := m.read()
+	if err != nil {
+		return nil, err
+	}
+	m.current.Store(cfg)
+	slog.Debug("加载配置成功", "file", m.v.ConfigFileUsed(), "apiBaseUrl", cfg.ApiBaseUrl, "logLevel", cfg.LogLevel)
+	return cfg, nil
+}
+
+// Reload 重新读取配置，校验通过后替换当前配置并通知回调；失败时保留原配置
+func (m *Manager) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cfg, err := m.read()
+	if err != nil {
+		return err
+	}
+	old := m.current.Swap(cfg)
+	for _, fn := range m.listeners {
+		fn(old, cfg)
+	}
+	return nil
+}
+
+// readFile 读取配置文件，需持有锁
+func (m *Manager) readFile() error {
+	if err := m.v.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			return fmt.Errorf("读取配置文件失败: %w", err)
+		}
+		slog.Info("未找到配置文件，使用默认配置和环境变量")
+	}
+	return nil
+}
+
+// read 读取、解析并校验配置，需持有锁
+func (m *Manager) read() (*Config, error) {
+	if err := m.readFile(); err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := m.v.Unmarshal(&cfg); err != nil {
+		return nil, fmt.Errorf("配置解析失败: %w", err)
+	}
+	if err := resolveSecrets(&cfg); err != nil {
+		return nil, fmt.Errorf("解析密钥失败: %w", err)
+	}
+	if err := validateConfig(&cfg); err != nil {
+		return nil, fmt.Errorf("配置验证失败: %w", err)
+	}
+	for _, fn := range m.validators {
+		if err := fn(&cfg); err != nil {
+			return nil, fmt.Errorf("配置验证失败: %w", err)
+		}
+	}
+	return &cfg, nil
+}
+
+// Watch 监听配置文件变化并调用 Reload，直到 ctx 取消
+// 监听所在目录而不是文件本身，编辑器保存时的重命名与 Kubernetes ConfigMap 的符号链接替换都能被发现
+func (m *Manager) Watch(ctx context.Context) error {
+	m.mu.Lock()
+	file := m.v.ConfigFileUsed()
+	m.mu.Unlock()
+	if file == "" {
+		return errors.New("未使用配置文件，无法监听")
+	}
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	realFile, _ := filepath.EvalSymlinks(file)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("监听配置文件失败: %w", err)
+	}
+	defer watcher.Close()
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		return fmt.Errorf("监听配置文件失败: %w", err)
+	}
+	slog.Info("开始监听配置文件", "file", file)
+
+	// 一次保存往往触发多个事件，合并为一次重新加载
+	const debounce = 200 * time.Millisecond
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	for {
+		select {
+		case e, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			current, _ := filepath.EvalSymlinks(file)
+			if filepath.Clean(e.Name) != file && current == realFile {
+				continue
+			}
+			if !e.Has(fsnotify.Write) && !e.Has(fsnotify.Create) && !e.Has(fsnotify.Rename) {
+				continue
+			}
+			realFile = current
+			timer.Reset(debounce)
+		case <-timer.C:
+			if err := m.Reload(); err != nil {
+				slog.Error("配置文件变化未生效，继续使用原配置", "error", err)
+			} else {
+				slog.Info("配置已重新加载", "file", file)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Warn("监听配置文件出错", "error", err)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
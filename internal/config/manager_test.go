@@ -0,0 +1,153 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const baseConfig = `
+apiBaseUrl: http://127.0.0.1:11434
+logLevel: info
+logFormat: text
+`
+
+// newTestManager 使用临时配置文件创建配置管理，返回配置文件路径
+func newTestManager(t *testing.T, content string) (*Manager, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, content)
+	v := viper.New()
+	v.SetConfigFile(path)
+	return &Manager{v: v}, path
+}
+
+func writeConfig(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManagerReload(t *testing.T) {
+	m, path := newTestManager(t, baseConfig)
+	first, err := m.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var changes [][2]*Config
+	m.OnChange(func(old, cfg *Config) { changes = append(changes, [2]*Config{old, cfg}) })
+
+	writeConfig(t, path, baseConfig+"locale: en-US\n")
+	if err := m.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Current().Locale != "en-US" {
+		t.Errorf("locale = %q, want en-US", m.Current().Locale)
+	}
+	if len(changes) != 1 || changes[0][0] != first || changes[0][1] != m.Current() {
+		t.Errorf("changes = %v, want one change from the loaded config", changes)
+	}
+	// 已取走的配置不受影响
+	if first.Locale != "" {
+		t.Errorf("previous config modified: locale = %q", first.Locale)
+	}
+}
+
+func TestManagerReloadRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"log level", "apiBaseUrl: http://127.0.0.1:11434\nlogLevel: verbose\nlogFormat: text\n", "logLevel"},
+		{"yaml syntax", baseConfig + "providers: [\n", "读取配置文件失败"},
+		{"unknown provider", baseConfig + "provider: missing\n", "provider 引用了不存在的服务"},
+		{"router member", baseConfig + "routers:\n  main: {members: [{provider: missing}]}\n", "routers.main.members[0]"},
+		{"router rule", baseConfig + "routers:\n  main:\n    members: [{provider: default}]\n    rules: [{provider: default}]\n", "modelPrefix 或 minPromptTokens"},
+		{"semantic cache provider", baseConfig + "providers:\n  qwen: {type: openai, baseUrl: \"https://example.com\"}\ncache:\n  enabled: true\n  semantic: {provider: qwen, model: nomic-embed-text}\n", "必须为 ollama 服务"},
+		{"cache ttl", baseConfig + "cache: {enabled: true, ttl: forever}\n", "cache.ttl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, path := newTestManager(t, baseConfig)
+			prev, err := m.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			called := false
+			m.OnChange(func(old, cfg *Config) { called = true })
+
+			writeConfig(t, path, tt.content)
+			err = m.Reload()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want %q", err, tt.want)
+			}
+			if m.Current() != prev || called {
+				t.Error("invalid config replaced the previous one")
+			}
+		})
+	}
+}
+
+func TestManagerValidator(t *testing.T) {
+	m, path := newTestManager(t, baseConfig)
+	m.AddValidator(func(cfg *Config) error {
+		if cfg.Locale == "xx" {
+			return os.ErrInvalid
+		}
+		return nil
+	})
+	prev, err := m.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfig(t, path, baseConfig+"locale: xx\n")
+	if err := m.Reload(); err == nil || m.Current() != prev {
+		t.Errorf("err = %v, validator should keep the previous config", err)
+	}
+}
+
+func TestManagerWatch(t *testing.T) {
+	m, path := newTestManager(t, baseConfig)
+	if _, err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := make(chan *Config, 1)
+	m.OnChange(func(old, cfg *Config) { reloaded <- cfg })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Watch(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// 等待监听开始后再修改，修改可能早于监听而被错过，因此重复写入
+	deadline := time.After(5 * time.Second)
+	tick := time.NewTicker(300 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case cfg := <-reloaded:
+			if cfg.Locale != "en-US" {
+				t.Errorf("locale = %q, want en-US", cfg.Locale)
+			}
+			return
+		case <-tick.C:
+			writeConfig(t, path, baseConfig+"locale: en-US\n")
+		case err := <-done:
+			t.Fatalf("Watch returned: %v", err)
+		case <-deadline:
+			t.Fatal("config change not reloaded")
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"learn/internal/secret"
+)
+
+// resolveSecrets 将密钥配置项中的 env:、file:、secret: 引用替换为原文
+// 解析出的密钥会被登记，日志中自动替换为 ***
+func resolveSecrets(cfg *Config) error {
+	vault, err := openVault(cfg.SecretsFile, cfg.SecretsPassphrase)
+	if err != nil {
+		return err
+	}
+
+	resolve := func(field string, ref *string) error {
+		if *ref == "" {
+			return nil
+		}
+		value, err := secret.Resolve(*ref, vault)
+		if err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+		*ref = value
+		return nil
+	}
+	if err := resolve("apiBaseKey", &cfg.ApiBaseKey); err != nil {
+		return err
+	}
+	for name, p := range cfg.Providers {
+		if err := resolve("providers."+name+".apiKey", &p.APIKey); err != nil {
+			return err
+		}
+		headers := make(map[string]string, len(p.Headers))
+		for key, value := range p.Headers {
+			if err := resolve("providers."+name+".headers."+key, &value); err != nil {
+				return err
+			}
+			headers[key] = value
+		}
+		p.Headers = headers
+		cfg.Providers[name] = p
+	}
+	for i := range cfg.Webhooks {
+		if err := resolve(fmt.Sprintf("webhooks[%d].secret", i), &cfg.Webhooks[i].Secret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openVault 打开加密密钥文件，未配置 secretsFile 时返回 nil
+func openVault(path, passphraseRef string) (*secret.Vault, error) {
+	if path == "" {
+		return nil, nil
+	}
+	passphrase, err := secret.Resolve(passphraseRef, nil)
+	if err != nil {
+		return nil, fmt.Errorf("secretsPassphrase: %w", err)
+	}
+	vault, err := secret.OpenVault(path, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("secretsFile: %w", err)
+	}
+	return vault, nil
+}
+
+// Vault 打开配置中的加密密钥文件，用于增删密钥；不解析与校验其他配置项
+func (m *Manager) Vault() (*secret.Vault, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.readFile(); err != nil {
+		return nil, err
+	}
+	path := m.v.GetString("secretsFile")
+	if path == "" {
+		return nil, errors.New("未配置 secretsFile")
+	}
+	return openVault(path, m.v.GetString("secretsPassphrase"))
+}
+
+// Redacted 返回隐藏了密钥的副本，用于输出配置
+func (c *Config) Redacted() *Config {
+	r := *c
+	r.ApiBaseKey = secret.Mask(c.ApiBaseKey)
+	if !isSecretRef(c.SecretsPassphrase) {
+		r.SecretsPassphrase = secret.Mask(c.SecretsPassphrase)
+	}
+	if strings.EqualFold(c.DBDriver, "mysql") {
+		r.DBDsn = maskDSN(c.DBDsn)
+	}
+	r.Providers = maps.Clone(c.Providers)
+	for name, p := range r.Providers {
+		p.APIKey = secret.Mask(p.APIKey)
+		// 请求头通常用于鉴权，全部隐藏
+		headers := make(map[string]string, len(p.Headers))
+		for key, value := range p.Headers {
+			headers[key] = secret.Mask(value)
+		}
+		p.Headers = headers
+		r.Providers[name] = p
+	}
+	r.Webhooks = slices.Clone(c.Webhooks)
+	for i := range r.Webhooks {
+		r.Webhooks[i].Secret = secret.Mask(r.Webhooks[i].Secret)
+	}
+	return &r
+}
+
+// isSecretRef 值是否为 env: 或 file: 引用
+func isSecretRef(value string) bool {
+	return strings.HasPrefix(value, secret.EnvPrefix) || strings.HasPrefix(value, secret.FilePrefix)
+}
+
+// maskDSN 隐藏 MySQL DSN（user:password@tcp(host)/db）中的密码
+func maskDSN(dsn string) string {
+	at := strings.LastIndex(dsn, "@")
+	if at < 0 {
+		return dsn
+	}
+	colon := strings.Index(dsn[:at], ":")
+	if colon < 0 {
+		return dsn
+	}
+	return dsn[:colon+1] + "***" + dsn[at:]
+}
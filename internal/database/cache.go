@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CacheEntry 模型响应缓存条目
+type CacheEntry struct {
+	Key   string
+	Scope string
+	Value []byte
+	// Embedding 语义缓存使用的向量，可为空
+	Embedding []float64
+	CreatedAt time.Time
+	// ExpiresAt 为零值表示永不过期
+	ExpiresAt time.Time
+}
+
+func (e *CacheEntry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt)
+}
+
+// GetCache 按 key 读取未过期的缓存，不存在时返回 nil
+func (s *sqlDB) GetCache(ctx context.Context, key string) (*CacheEntry, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT cache_key, scope, value, embedding, created_at, expires_at
+		FROM llm_cache WHERE cache_key = ?`, key)
+
+	entry, err := scanCacheEntry(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取缓存失败: %w", err)
+	}
+	if entry.expired(time.Now()) {
+		return nil, nil
+	}
+	return entry, nil
+}
+
+// SetCache 写入或覆盖缓存
+func (s *sqlDB) SetCache(ctx context.Context, entry *CacheEntry) error {
+	var embedding []byte
+	if len(entry.Embedding) > 0 {
+		var err error
+		if embedding, err = json.Marshal(entry.Embedding); err != nil {
+			return err
+		}
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		REPLACE INTO llm_cache (cache_key, scope, value, embedding, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		entry.Key, entry.Scope, entry.Value, embedding,
+		entry.CreatedAt.UnixMilli(), unixMilli(entry.ExpiresAt))
+	if err != nil {
+		return fmt.Errorf("写入缓存失败: %w", err)
+	}
+	return nil
+}
+
+// ScanCache 列出某个范围内带向量且未过期的缓存，供语义缓存比较相似度
+func (s *sqlDB) ScanCache(ctx context.Context, scope string) ([]CacheEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT cache_key, scope, value, embedding, created_at, expires_at
+		FROM llm_cache WHERE scope = ? AND embedding IS NOT NULL`, scope)
+	if err != nil {
+		return nil, fmt.Errorf("读取缓存失败: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var entries []CacheEntry
+	for rows.Next() {
+		entry, err := scanCacheEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		if !entry.expired(now) {
+			entries = append(entries, *entry)
+		}
+	}
+	return entries, rows.Err()
+}
+
+// PurgeCache 删除已过期的缓存
+func (s *sqlDB) PurgeCache(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM llm_cache WHERE expires_at > 0 AND expires_at < ?`, time.Now().UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("清理缓存失败: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// scanner 兼容 *sql.Row 与 *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanCacheEntry(row scanner) (*CacheEntry, error) {
+	var entry CacheEntry
+	var embedding []byte
+	var createdAt, expiresAt int64
+	if err := row.Scan(&entry.Key, &entry.Scope, &entry.Value, &embedding, &createdAt, &expiresAt); err != nil {
+		return nil, err
+	}
+	if len(embedding) > 0 {
+		if err := json.Unmarshal(embedding, &entry.Embedding); err != nil {
+			return nil, fmt.Errorf("解析缓存向量失败: %w", err)
+		}
+	}
+	entry.CreatedAt = time.UnixMilli(createdAt)
+	entry.ExpiresAt = fromUnixMilli(expiresAt)
+	return &entry, nil
+}
+
+// unixMilli 零值时间存储为 0
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func fromUnixMilli(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
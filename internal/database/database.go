@@ -1 +1,223 @@
 package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Store 数据访问接口，SQLiteDB 与 MDB 均已实现
+type Store interface {
+	DB() *sql.DB
+	Close() error
+	Migrate(ctx context.Context) error
+
+	GetCache(ctx context.Context, key string) (*CacheEntry, error)
+	SetCache(ctx context.Context, entry *CacheEntry) error
+	ScanCache(ctx context.Context, scope string) ([]CacheEntry, error)
+	PurgeCache(ctx context.Context) (int64, error)
+
+	SaveUsage(ctx context.Context, records ...UsageRecord) error
+	ListUsage(ctx context.Context, runID string) ([]UsageRecord, error)
+
+	SaveRun(ctx context.Context, r *RunRecord) error
+	GetRun(ctx context.Context, runID string) (*RunRecord, error)
+	ListRuns(ctx context.Context, limit int) ([]RunRecord, error)
+
+	EnqueueJob(ctx context.Context, job *Job) error
+	LeaseJob(ctx context.Context, queue, owner string, visibility time.Duration) (*Job, error)
+	ExtendJob(ctx context.Context, job *Job, visibility time.Duration) (bool, error)
+	AckJob(ctx context.Context, job *Job) error
+	FailJob(ctx context.Context, job *Job, cause string, retryAt time.Time) error
+	ReleaseJob(ctx context.Context, job *Job) error
+	DeadLetterExpired(ctx context.Context, queue string) ([]Job, error)
+	CancelJob(ctx context.Context, id string) (string, error)
+	RetryJob(ctx context.Context, id string) error
+	GetJob(ctx context.Context, id string) (*Job, error)
+	ListJobs(ctx context.Context, status string, limit int) ([]Job, error)
+
+	SaveDelivery(ctx context.Context, d *WebhookDelivery) error
+	ListDeliveries(ctx context.Context, runID string) ([]WebhookDelivery, error)
+
+	SavePrompts(ctx context.Context, records ...PromptRecord) error
+	ListPrompts(ctx context.Context, runID string) ([]PromptRecord, error)
+	GetPromptVersion(ctx context.Context, role, version string) (string, error)
+
+	SaveExperiment(ctx context.Context, e *Experiment) error
+	GetExperiment(ctx context.Context, id string) (*Experiment, error)
+	ListExperiments(ctx context.Context, limit int) ([]Experiment, error)
+	SaveExperimentResult(ctx context.Context, r *ExperimentResult) error
+	ListExperimentResults(ctx context.Context, experimentID string) ([]ExperimentResult, error)
+}
+
+// Open 按驱动名打开数据库，支持 sqlite3 与 mysql
+func Open(driver, dsn string) (Store, error) {
+	switch driver {
+	case "sqlite3", "sqlite":
+		return NewSQLiteDB(dsn)
+	case "mysql":
+		return NewMDB(dsn)
+	}
+	return nil, fmt.Errorf("不支持的数据库驱动: %s", driver)
+}
+
+// sqlDB SQLite 与 MySQL 共用的数据访问实现
+// 语句尽量使用两者都支持的语法，差异部分按 driver 区分
+type sqlDB struct {
+	db     *sql.DB
+	driver string
+}
+
+// DB 返回底层连接
+func (s *sqlDB) DB() *sql.DB {
+	return s.db
+}
+
+// Close 关闭数据库连接
+func (s *sqlDB) Close() error {
+	return s.db.Close()
+}
+
+// schema 各功能使用的表，key 为 driver，"" 表示通用语句
+var schema = []map[string]string{
+	{
+		"": `CREATE TABLE IF NOT EXISTS llm_cache (
+			cache_key  VARCHAR(64) PRIMARY KEY,
+			scope      VARCHAR(255) NOT NULL,
+			value      LONGBLOB NOT NULL,
+			embedding  LONGBLOB,
+			created_at BIGINT NOT NULL,
+			expires_at BIGINT NOT NULL
+		)`,
+	},
+	{
+		"": `CREATE TABLE IF NOT EXISTS usage_records (
+			run_id            VARCHAR(64) NOT NULL,
+			step              VARCHAR(128) NOT NULL,
+			model             VARCHAR(255) NOT NULL,
+			requests          INT NOT NULL,
+			cached_requests   INT NOT NULL,
+			prompt_tokens     INT NOT NULL,
+			completion_tokens INT NOT NULL,
+			cost              DOUBLE NOT NULL,
+			created_at        BIGINT NOT NULL,
+			PRIMARY KEY (run_id, step)
+		)`,
+	},
+	{
+		"": `CREATE TABLE IF NOT EXISTS runs (
+			run_id        VARCHAR(64) PRIMARY KEY,
+			pipeline      VARCHAR(128) NOT NULL,
+			message       LONGTEXT NOT NULL,
+			status        VARCHAR(32) NOT NULL,
+			error_message TEXT,
+			data          LONGBLOB,
+			steps         TEXT,
+			created_at    BIGINT NOT NULL,
+			updated_at    BIGINT NOT NULL
+		)`,
+	},
+	{
+		"":      jobsTable + `)`,
+		"mysql": jobsTable + `, INDEX idx_jobs_claim (queue_name, status, available_at))`,
+	},
+	{
+		"": `CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			delivery_id   VARCHAR(64) NOT NULL,
+			attempt       INT NOT NULL,
+			run_id        VARCHAR(64) NOT NULL,
+			event         VARCHAR(64) NOT NULL,
+			url           TEXT NOT NULL,
+			status_code   INT NOT NULL,
+			error_message TEXT NOT NULL,
+			duration_ms   BIGINT NOT NULL,
+			created_at    BIGINT NOT NULL,
+			PRIMARY KEY (delivery_id, attempt)
+		)`,
+	},
+	{
+		"": `CREATE TABLE IF NOT EXISTS step_prompts (
+			run_id     VARCHAR(64) NOT NULL,
+			step       VARCHAR(128) NOT NULL,
+			role       VARCHAR(128) NOT NULL,
+			version    VARCHAR(64) NOT NULL,
+			model      VARCHAR(255) NOT NULL,
+			created_at BIGINT NOT NULL,
+			PRIMARY KEY (run_id, step)
+		)`,
+	},
+	{
+		"": `CREATE TABLE IF NOT EXISTS prompt_versions (
+			role       VARCHAR(128) NOT NULL,
+			version    VARCHAR(64) NOT NULL,
+			prompt     LONGTEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			PRIMARY KEY (role, version)
+		)`,
+	},
+	{
+		"": `CREATE TABLE IF NOT EXISTS experiments (
+			id         VARCHAR(64) PRIMARY KEY,
+			name       VARCHAR(255) NOT NULL,
+			pipeline   VARCHAR(128) NOT NULL,
+			variant_a  LONGTEXT NOT NULL,
+			variant_b  LONGTEXT NOT NULL,
+			evaluator  VARCHAR(255) NOT NULL,
+			created_at BIGINT NOT NULL
+		)`,
+	},
+	{
+		"": `CREATE TABLE IF NOT EXISTS experiment_results (
+			experiment_id VARCHAR(64) NOT NULL,
+			input_id      VARCHAR(255) NOT NULL,
+			variant       VARCHAR(8) NOT NULL,
+			input         LONGTEXT NOT NULL,
+			run_id        VARCHAR(64) NOT NULL,
+			status        VARCHAR(32) NOT NULL,
+			output        LONGTEXT NOT NULL,
+			score         DOUBLE,
+			reason        TEXT NOT NULL,
+			error_message TEXT NOT NULL,
+			created_at    BIGINT NOT NULL,
+			PRIMARY KEY (experiment_id, input_id, variant)
+		)`,
+	},
+	{
+		// MySQL 的索引已在建表时创建
+		"sqlite3": `CREATE INDEX IF NOT EXISTS idx_jobs_claim ON jobs (queue_name, status, available_at)`,
+	},
+}
+
+const jobsTable = `CREATE TABLE IF NOT EXISTS jobs (
+	id               VARCHAR(64) PRIMARY KEY,
+	queue_name       VARCHAR(64) NOT NULL,
+	payload          LONGBLOB NOT NULL,
+	status           VARCHAR(16) NOT NULL,
+	attempts         INT NOT NULL,
+	max_attempts     INT NOT NULL,
+	available_at     BIGINT NOT NULL,
+	lease_owner      VARCHAR(255) NOT NULL,
+	lease_token      VARCHAR(64) NOT NULL,
+	leased_until     BIGINT NOT NULL,
+	last_error       TEXT,
+	cancel_requested TINYINT NOT NULL,
+	created_at       BIGINT NOT NULL,
+	updated_at       BIGINT NOT NULL`
+
+// Migrate 创建所需的表
+func (s *sqlDB) Migrate(ctx context.Context) error {
+	for _, stmts := range schema {
+		stmt, ok := stmts[s.driver]
+		if !ok {
+			stmt = stmts[""]
+		}
+		if stmt == "" {
+			continue
+		}
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("数据库迁移失败: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Experiment 一次对比实验：同一批输入分别以两组配置运行
+type Experiment struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Pipeline string `json:"pipeline"`
+	// VariantA 与 VariantB 两组配置（JSON），结构见 experiment.Variant
+	VariantA  json.RawMessage `json:"variant_a"`
+	VariantB  json.RawMessage `json:"variant_b"`
+	Evaluator string          `json:"evaluator,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// ExperimentResult 实验中一条输入在一组配置下的结果，同一输入的两组结果构成一对
+type ExperimentResult struct {
+	ExperimentID string `json:"experiment_id"`
+	InputID      string `json:"input_id"`
+	Input        string `json:"input"`
+	// Variant 为 a 或 b
+	Variant string `json:"variant"`
+	RunID   string `json:"run_id"`
+	Status  string `json:"status"`
+	Output  string `json:"output"`
+	// Score 评估分数，未评估或评估失败时为空
+	Score     *float64  `json:"score,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SaveExperiment 写入实验
+func (s *sqlDB) SaveExperiment(ctx context.Context, e *Experiment) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	_, err := s.db.ExecContext(ctx, `
+		REPLACE INTO experiments (id, name, pipeline, variant_a, variant_b, evaluator, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		e.ID, e.Name, e.Pipeline, []byte(e.VariantA), []byte(e.VariantB), e.Evaluator, e.CreatedAt.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("写入实验失败: %w", err)
+	}
+	return nil
+}
+
+// GetExperiment 按 ID 读取实验，不存在时返回 nil
+func (s *sqlDB) GetExperiment(ctx context.Context, id string) (*Experiment, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT id, name, pipeline, variant_a, variant_b, evaluator, created_at
+		FROM experiments WHERE id = ?`, id)
+	e, err := scanExperiment(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取实验失败: %w", err)
+	}
+	return e, nil
+}
+
+// ListExperiments 按创建时间倒序列出实验，limit <= 0 时不限制
+func (s *sqlDB) ListExperiments(ctx context.Context, limit int) ([]Experiment, error) {
+	query := `
+		SELECT id, name, pipeline, variant_a, variant_b, evaluator, created_at
+		FROM experiments ORDER BY created_at DESC`
+	args := []any{}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询实验失败: %w", err)
+	}
+	defer rows.Close()
+
+	var experiments []Experiment
+	for rows.Next() {
+		e, err := scanExperiment(rows)
+		if err != nil {
+			return nil, err
+		}
+		experiments = append(experiments, *e)
+	}
+	return experiments, rows.Err()
+}
+
+func scanExperiment(row scanner) (*Experiment, error) {
+	var (
+		e         Experiment
+		a, b      []byte
+		createdAt int64
+	)
+	if err := row.Scan(&e.ID, &e.Name, &e.Pipeline, &a, &b, &e.Evaluator, &createdAt); err != nil {
+		return nil, err
+	}
+	e.VariantA, e.VariantB = json.RawMessage(a), json.RawMessage(b)
+	e.CreatedAt = time.UnixMilli(createdAt)
+	return &e, nil
+}
+
+// SaveExperimentResult 写入实验结果，同一输入同一组配置的结果会被覆盖
+func (s *sqlDB) SaveExperimentResult(ctx context.Context, r *ExperimentResult) error {
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+	var score sql.NullFloat64
+	if r.Score != nil {
+		score = sql.NullFloat64{Float64: *r.Score, Valid: true}
+	}
+	_, err := s.db.ExecContext(ctx, `
+		REPLACE INTO experiment_results (experiment_id, input_id, variant, input, run_id, status, output,
+			score, reason, error_message, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ExperimentID, r.InputID, r.Variant, r.Input, r.RunID, r.Status, r.Output,
+		score, r.Reason, r.Error, r.CreatedAt.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("写入实验结果失败: %w", err)
+	}
+	return nil
+}
+
+// ListExperimentResults 按输入与配置顺序列出实验结果
+func (s *sqlDB) ListExperimentResults(ctx context.Context, experimentID string) ([]ExperimentResult, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT experiment_id, input_id, variant, input, run_id, status, output,
+			score, reason, error_message, created_at
+		FROM experiment_results WHERE experiment_id = ? ORDER BY input_id, variant`, experimentID)
+	if err != nil {
+		return nil, fmt.Errorf("查询实验结果失败: %w", err)
+	}
+	defer rows.Close()
+
+	var results []ExperimentResult
+	for rows.Next() {
+		var (
+			r         ExperimentResult
+			score     sql.NullFloat64
+			createdAt int64
+		)
+		if err := rows.Scan(&r.ExperimentID, &r.InputID, &r.Variant, &r.Input, &r.RunID, &r.Status, &r.Output,
+			&score, &r.Reason, &r.Error, &createdAt); err != nil {
+			return nil, err
+		}
+		if score.Valid {
+			r.Score = &score.Float64
+		}
+		r.CreatedAt = time.UnixMilli(createdAt)
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,302 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 任务状态
+const (
+	JobQueued    = "queued"
+	JobLeased    = "leased"
+	JobDone      = "done"
+	JobDead      = "dead"
+	JobCancelled = "cancelled"
+)
+
+// ErrLeaseLost 租约已过期并被其他进程获取，或任务已被删除
+var ErrLeaseLost = errors.New("任务租约已失效")
+
+// Job 持久化任务队列中的任务
+// 领取任务时通过条件更新抢占，多个进程共用同一数据库时不会重复领取
+type Job struct {
+	ID          string          `json:"id"`
+	Queue       string          `json:"queue"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	// AvailableAt 之前不会被领取，用于重试退避
+	AvailableAt time.Time `json:"available_at"`
+	LeaseOwner  string    `json:"lease_owner,omitempty"`
+	// LeaseToken 本次领取的凭证，续租、确认与失败都需要匹配
+	LeaseToken  string    `json:"-"`
+	LeasedUntil time.Time `json:"leased_until,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+	// CancelRequested 请求取消运行中的任务，由持有租约的进程在续租时发现
+	CancelRequested bool      `json:"cancel_requested,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+const jobColumns = `id, queue_name, payload, status, attempts, max_attempts, available_at,
+	lease_owner, lease_token, leased_until, last_error, cancel_requested, created_at, updated_at`
+
+// EnqueueJob 加入任务，ID 重复时返回错误
+func (s *sqlDB) EnqueueJob(ctx context.Context, job *Job) error {
+	now := time.Now()
+	if job.AvailableAt.IsZero() {
+		job.AvailableAt = now
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = 1
+	}
+	job.Status, job.CreatedAt, job.UpdatedAt = JobQueued, now, now
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO jobs (id, queue_name, payload, status, attempts, max_attempts, available_at,
+			lease_owner, lease_token, leased_until, last_error, cancel_requested, created_at, updated_at)
+		VALUES (?, ?, ?, ?, 0, ?, ?, '', '', 0, '', 0, ?, ?)`,
+		job.ID, job.Queue, []byte(job.Payload), job.Status, job.MaxAttempts, job.AvailableAt.UnixMilli(),
+		now.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("加入任务失败: %w", err)
+	}
+	return nil
+}
+
+// LeaseJob 领取一个可执行的任务，包括租约已过期的任务；没有任务时返回 nil
+func (s *sqlDB) LeaseJob(ctx context.Context, queue, owner string, visibility time.Duration) (*Job, error) {
+	const claimable = `queue_name = ? AND attempts < max_attempts AND (
+		(status = 'queued' AND available_at <= ?) OR (status = 'leased' AND leased_until <= ?))`
+
+	now := time.Now().UnixMilli()
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id FROM jobs WHERE `+claimable+`
+		ORDER BY available_at, created_at LIMIT 8`, queue, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("查询任务失败: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 依次尝试抢占，条件更新只会有一个进程成功
+	token := newToken()
+	until := time.Now().Add(visibility).UnixMilli()
+	for _, id := range ids {
+		res, err := s.db.ExecContext(ctx, `
+			UPDATE jobs SET status = 'leased', attempts = attempts + 1, lease_owner = ?, lease_token = ?,
+				leased_until = ?, updated_at = ?
+			WHERE id = ? AND `+claimable,
+			owner, token, until, now, id, queue, now, now)
+		if err != nil {
+			return nil, fmt.Errorf("领取任务失败: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return s.GetJob(ctx, id)
+		}
+	}
+	return nil, nil
+}
+
+// ExtendJob 续租，返回任务是否被请求取消
+func (s *sqlDB) ExtendJob(ctx context.Context, job *Job, visibility time.Duration) (bool, error) {
+	now := time.Now()
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE jobs SET leased_until = ?, updated_at = ?
+		WHERE id = ? AND lease_token = ? AND status = 'leased'`,
+		now.Add(visibility).UnixMilli(), now.UnixMilli(), job.ID, job.LeaseToken)
+	if err != nil {
+		return false, fmt.Errorf("续租失败: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return false, ErrLeaseLost
+	}
+
+	var cancel bool
+	err = s.db.QueryRowContext(ctx, `SELECT cancel_requested FROM jobs WHERE id = ?`, job.ID).Scan(&cancel)
+	if err != nil {
+		return false, fmt.Errorf("续租失败: %w", err)
+	}
+	return cancel, nil
+}
+
+// AckJob 确认任务完成
+func (s *sqlDB) AckJob(ctx context.Context, job *Job) error {
+	return s.finishLease(ctx, job, `status = 'done'`)
+}
+
+// FailJob 记录失败，retryAt 为零值时进入死信，否则在 retryAt 之后重新执行
+// 已达最大执行次数时同样进入死信
+func (s *sqlDB) FailJob(ctx context.Context, job *Job, cause string, retryAt time.Time) error {
+	if retryAt.IsZero() || job.Attempts >= job.MaxAttempts {
+		return s.finishLease(ctx, job, `status = 'dead', last_error = ?`, cause)
+	}
+	return s.finishLease(ctx, job, `status = 'queued', last_error = ?, available_at = ?`, cause, retryAt.UnixMilli())
+}
+
+// ReleaseJob 放弃租约并立即归还队列，不计入执行次数，用于进程退出
+func (s *sqlDB) ReleaseJob(ctx context.Context, job *Job) error {
+	return s.finishLease(ctx, job, `status = 'queued', attempts = attempts - 1, available_at = ?`, time.Now().UnixMilli())
+}
+
+// finishLease 在持有租约的前提下更新任务
+func (s *sqlDB) finishLease(ctx context.Context, job *Job, set string, args ...any) error {
+	args = append(args, time.Now().UnixMilli(), job.ID, job.LeaseToken)
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE jobs SET `+set+`, lease_token = '', leased_until = 0, updated_at = ?
+		WHERE id = ? AND lease_token = ? AND status = 'leased'`, args...)
+	if err != nil {
+		return fmt.Errorf("更新任务失败: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// DeadLetterExpired 将租约过期且已达最大执行次数的任务移入死信，返回这些任务
+func (s *sqlDB) DeadLetterExpired(ctx context.Context, queue string) ([]Job, error) {
+	now := time.Now().UnixMilli()
+	jobs, err := s.queryJobs(ctx, `
+		WHERE queue_name = ? AND status = 'leased' AND leased_until <= ? AND attempts >= max_attempts`,
+		queue, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var dead []Job
+	for _, job := range jobs {
+		res, err := s.db.ExecContext(ctx, `
+			UPDATE jobs SET status = 'dead', last_error = ?, lease_token = '', leased_until = 0, updated_at = ?
+			WHERE id = ? AND lease_token = ? AND status = 'leased'`,
+			"租约过期且已达最大执行次数", now, job.ID, job.LeaseToken)
+		if err != nil {
+			return dead, fmt.Errorf("更新任务失败: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			job.Status = JobDead
+			dead = append(dead, job)
+		}
+	}
+	return dead, nil
+}
+
+// CancelJob 取消任务：排队中的任务直接取消，运行中的任务标记取消请求；返回取消后的状态
+func (s *sqlDB) CancelJob(ctx context.Context, id string) (string, error) {
+	now := time.Now().UnixMilli()
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE jobs SET status = 'cancelled', updated_at = ? WHERE id = ? AND status = 'queued'`, now, id)
+	if err != nil {
+		return "", fmt.Errorf("取消任务失败: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return JobCancelled, nil
+	}
+
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE jobs SET cancel_requested = 1, updated_at = ? WHERE id = ? AND status = 'leased'`, now, id); err != nil {
+		return "", fmt.Errorf("取消任务失败: %w", err)
+	}
+	job, err := s.GetJob(ctx, id)
+	if err != nil || job == nil {
+		return "", err
+	}
+	return job.Status, nil
+}
+
+// RetryJob 将死信或已取消的任务重新加入队列，执行次数清零
+func (s *sqlDB) RetryJob(ctx context.Context, id string) error {
+	now := time.Now().UnixMilli()
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE jobs SET status = 'queued', attempts = 0, cancel_requested = 0, available_at = ?, updated_at = ?
+		WHERE id = ? AND status IN ('dead', 'cancelled')`, now, now, id)
+	if err != nil {
+		return fmt.Errorf("重试任务失败: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		return fmt.Errorf("任务不存在或不在死信中: %s", id)
+	}
+	return nil
+}
+
+// GetJob 按 ID 读取任务，不存在时返回 nil
+func (s *sqlDB) GetJob(ctx context.Context, id string) (*Job, error) {
+	jobs, err := s.queryJobs(ctx, `WHERE id = ?`, id)
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// ListJobs 按创建时间倒序列出任务，status 为空时不过滤
+func (s *sqlDB) ListJobs(ctx context.Context, status string, limit int) ([]Job, error) {
+	where, args := `WHERE 1 = 1`, []any{}
+	if status != "" {
+		where += ` AND status = ?`
+		args = append(args, status)
+	}
+	where += ` ORDER BY created_at DESC`
+	if limit > 0 {
+		where += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	return s.queryJobs(ctx, where, args...)
+}
+
+func (s *sqlDB) queryJobs(ctx context.Context, where string, args ...any) ([]Job, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+jobColumns+` FROM jobs `+where, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询任务失败: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var (
+			job                                        Job
+			payload                                    []byte
+			availableAt, leasedUntil, created, updated int64
+			lastError                                  sql.NullString
+		)
+		if err := rows.Scan(&job.ID, &job.Queue, &payload, &job.Status, &job.Attempts, &job.MaxAttempts,
+			&availableAt, &job.LeaseOwner, &job.LeaseToken, &leasedUntil, &lastError,
+			&job.CancelRequested, &created, &updated); err != nil {
+			return nil, err
+		}
+		job.Payload = json.RawMessage(payload)
+		job.LastError = lastError.String
+		job.AvailableAt = time.UnixMilli(availableAt)
+		if leasedUntil > 0 {
+			job.LeasedUntil = time.UnixMilli(leasedUntil)
+		}
+		job.CreatedAt = time.UnixMilli(created)
+		job.UpdatedAt = time.UnixMilli(updated)
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// newToken 生成租约凭证
+func newToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
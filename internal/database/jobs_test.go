@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"llm.db", "llm.db?_busy_timeout=5000&_journal_mode=WAL"},
+		{"file:llm.db?cache=shared", "file:llm.db?cache=shared&_busy_timeout=5000&_journal_mode=WAL"},
+		{"llm.db?_busy_timeout=100", "llm.db?_busy_timeout=100&_journal_mode=WAL"},
+	}
+	for _, tt := range tests {
+		if got := sqliteDSN(tt.in); got != tt.want {
+			t.Errorf("sqliteDSN(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// 多个连接池模拟多个 Worker 进程共用同一个 SQLite 文件
+func TestConcurrentLeaseSQLite(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "jobs.db")
+
+	const workers, jobs = 4, 40
+	stores := make([]*SQLiteDB, workers)
+	for i := range stores {
+		db, err := NewSQLiteDB(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		stores[i] = db
+	}
+	if err := stores[0].Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var mode string
+	if err := stores[1].DB().QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Fatalf("journal_mode = %q, err = %v, want wal", mode, err)
+	}
+	for i := 0; i < jobs; i++ {
+		if err := stores[0].EnqueueJob(ctx, &Job{ID: fmt.Sprintf("job-%02d", i), Queue: "runs", Payload: []byte(`{}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		leased = map[string]int{}
+		errs   []error
+	)
+	for i, db := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			owner := fmt.Sprintf("worker-%d", i)
+			for {
+				job, err := db.LeaseJob(ctx, "runs", owner, time.Minute)
+				if err == nil && job != nil {
+					_, err = db.ExtendJob(ctx, job, time.Minute)
+					if err == nil {
+						err = db.AckJob(ctx, job)
+					}
+				}
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, err)
+				}
+				if job != nil {
+					leased[job.ID]++
+				}
+				mu.Unlock()
+				if err != nil || job == nil {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		t.Error(err)
+	}
+	if len(leased) != jobs {
+		t.Errorf("leased %d jobs, want %d", len(leased), jobs)
+	}
+	for id, n := range leased {
+		if n != 1 {
+			t.Errorf("%s leased %d times", id, n)
+		}
+	}
+	done, err := stores[0].ListJobs(ctx, JobDone, jobs+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != jobs {
+		t.Errorf("done = %d, want %d", len(done), jobs)
+	}
+}
@@ -6,7 +6,7 @@ import (
 )
 
 type MDB struct {
-	db *sql.DB
+	sqlDB
 }
 
 func NewMDB(dataSourceName string) (*MDB, error) {
@@ -14,5 +14,5 @@ func NewMDB(dataSourceName string) (*MDB, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &MDB{db: db}, nil
+	return &MDB{sqlDB: sqlDB{db: db, driver: "mysql"}}, nil
 }
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PromptRecord 步骤使用的系统提示词版本
+type PromptRecord struct {
+	RunID   string `json:"run_id"`
+	Step    string `json:"step"`
+	Role    string `json:"role"`
+	Version string `json:"version"`
+	Model   string `json:"model"`
+	// Prompt 渲染前的提示词，写入 prompt_versions 表，查询步骤记录时不返回
+	Prompt    string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SavePrompts 写入步骤的提示词版本，同一运行的同一步骤会被覆盖；提示词原文按角色与版本保存一份
+func (s *sqlDB) SavePrompts(ctx context.Context, records ...PromptRecord) error {
+	for _, r := range records {
+		if r.CreatedAt.IsZero() {
+			r.CreatedAt = time.Now()
+		}
+		_, err := s.db.ExecContext(ctx, `
+			REPLACE INTO step_prompts (run_id, step, role, version, model, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			r.RunID, r.Step, r.Role, r.Version, r.Model, r.CreatedAt.UnixMilli())
+		if err != nil {
+			return fmt.Errorf("写入提示词版本失败: %w", err)
+		}
+		if r.Prompt == "" {
+			continue
+		}
+		_, err = s.db.ExecContext(ctx, `
+			REPLACE INTO prompt_versions (role, version, prompt, created_at) VALUES (?, ?, ?, ?)`,
+			r.Role, r.Version, r.Prompt, r.CreatedAt.UnixMilli())
+		if err != nil {
+			return fmt.Errorf("写入提示词版本失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListPrompts 查询一次运行各步骤的提示词版本
+func (s *sqlDB) ListPrompts(ctx context.Context, runID string) ([]PromptRecord, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT run_id, step, role, version, model, created_at
+		FROM step_prompts WHERE run_id = ? ORDER BY created_at`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("查询提示词版本失败: %w", err)
+	}
+	defer rows.Close()
+
+	var records []PromptRecord
+	for rows.Next() {
+		var (
+			r         PromptRecord
+			createdAt int64
+		)
+		if err := rows.Scan(&r.RunID, &r.Step, &r.Role, &r.Version, &r.Model, &createdAt); err != nil {
+			return nil, err
+		}
+		r.CreatedAt = time.UnixMilli(createdAt)
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// GetPromptVersion 读取角色某个版本的提示词原文，不存在时返回空字符串
+func (s *sqlDB) GetPromptVersion(ctx context.Context, role, version string) (string, error) {
+	var prompt string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT prompt FROM prompt_versions WHERE role = ? AND version = ?`, role, version).Scan(&prompt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("读取提示词版本失败: %w", err)
+	}
+	return prompt, nil
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RunRecord 一次链条运行的记录，用于查看与恢复运行
+type RunRecord struct {
+	RunID    string `json:"run_id"`
+	Pipeline string `json:"pipeline"`
+	Message  string `json:"message"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	// Data 各步骤的输出（JSON）
+	Data json.RawMessage `json:"data,omitempty"`
+	// Steps 已成功完成的步骤
+	Steps     []string  `json:"steps"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SaveRun 写入或覆盖运行记录
+func (s *sqlDB) SaveRun(ctx context.Context, r *RunRecord) error {
+	steps, err := json.Marshal(r.Steps)
+	if err != nil {
+		return err
+	}
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+	r.UpdatedAt = time.Now()
+
+	_, err = s.db.ExecContext(ctx, `
+		REPLACE INTO runs (run_id, pipeline, message, status, error_message, data, steps, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.RunID, r.Pipeline, r.Message, r.Status, r.Error, []byte(r.Data), steps,
+		r.CreatedAt.UnixMilli(), r.UpdatedAt.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("写入运行记录失败: %w", err)
+	}
+	return nil
+}
+
+// GetRun 按 ID 读取运行记录，不存在时返回 nil
+func (s *sqlDB) GetRun(ctx context.Context, runID string) (*RunRecord, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT run_id, pipeline, message, status, error_message, data, steps, created_at, updated_at
+		FROM runs WHERE run_id = ?`, runID)
+
+	r, err := scanRun(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取运行记录失败: %w", err)
+	}
+	return r, nil
+}
+
+// ListRuns 按创建时间倒序列出最近的运行记录，limit <= 0 时不限制
+func (s *sqlDB) ListRuns(ctx context.Context, limit int) ([]RunRecord, error) {
+	query := `
+		SELECT run_id, pipeline, message, status, error_message, data, steps, created_at, updated_at
+		FROM runs ORDER BY created_at DESC`
+	args := []any{}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询运行记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	var records []RunRecord
+	for rows.Next() {
+		r, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *r)
+	}
+	return records, rows.Err()
+}
+
+func scanRun(row scanner) (*RunRecord, error) {
+	var (
+		r                    RunRecord
+		errMsg               sql.NullString
+		data, steps          []byte
+		createdAt, updatedAt int64
+	)
+	if err := row.Scan(&r.RunID, &r.Pipeline, &r.Message, &r.Status, &errMsg,
+		&data, &steps, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	r.Error = errMsg.String
+	if len(data) > 0 {
+		r.Data = json.RawMessage(data)
+	}
+	if len(steps) > 0 {
+		if err := json.Unmarshal(steps, &r.Steps); err != nil {
+			return nil, fmt.Errorf("解析运行步骤失败: %w", err)
+		}
+	}
+	r.CreatedAt = time.UnixMilli(createdAt)
+	r.UpdatedAt = time.UnixMilli(updatedAt)
+	return &r, nil
+}
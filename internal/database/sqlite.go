@@ -2,17 +2,36 @@ package database
 
 import (
 	"database/sql"
+	"strings"
+
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type SQLiteDB struct {
-	db *sql.DB
+	sqlDB
 }
 
 func NewSQLiteDB(dbPath string) (*SQLiteDB, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := sql.Open("sqlite3", sqliteDSN(dbPath))
 	if err != nil {
 		return nil, err
 	}
-	return &SQLiteDB{db: db}, nil
+	return &SQLiteDB{sqlDB: sqlDB{db: db, driver: "sqlite3"}}, nil
+}
+
+// sqliteDSN 未指定时加上忙等待与 WAL 模式：多个 Worker 进程并发领取、续租任务时等待锁释放，
+// 而不是立即返回 database is locked
+func sqliteDSN(dbPath string) string {
+	for _, param := range []string{"_busy_timeout=5000", "_journal_mode=WAL"} {
+		key, _, _ := strings.Cut(param, "=")
+		if strings.Contains(dbPath, key+"=") {
+			continue
+		}
+		sep := "?"
+		if strings.Contains(dbPath, "?") {
+			sep = "&"
+		}
+		dbPath += sep + param
+	}
+	return dbPath
 }
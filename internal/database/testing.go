@@ -0,0 +1,21 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+// OpenTest 在测试的临时目录中打开并迁移 SQLite 数据库，测试结束时关闭
+func OpenTest(t testing.TB) Store {
+	t.Helper()
+	store, err := Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// UsageRecord 单个步骤的用量记录
+type UsageRecord struct {
+	RunID            string    `json:"run_id"`
+	Step             string    `json:"step"`
+	Model            string    `json:"model"`
+	Requests         int       `json:"requests"`
+	CachedRequests   int       `json:"cached_requests"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Cost             float64   `json:"cost"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// SaveUsage 写入用量记录，同一运行的同一步骤会被覆盖
+func (s *sqlDB) SaveUsage(ctx context.Context, records ...UsageRecord) error {
+	for _, r := range records {
+		if r.CreatedAt.IsZero() {
+			r.CreatedAt = time.Now()
+		}
+		_, err := s.db.ExecContext(ctx, `
+			REPLACE INTO usage_records (run_id, step, model, requests, cached_requests,
+				prompt_tokens, completion_tokens, cost, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.RunID, r.Step, r.Model, r.Requests, r.CachedRequests,
+			r.PromptTokens, r.CompletionTokens, r.Cost, r.CreatedAt.UnixMilli())
+		if err != nil {
+			return fmt.Errorf("写入用量失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListUsage 查询一次运行的用量记录
+func (s *sqlDB) ListUsage(ctx context.Context, runID string) ([]UsageRecord, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT run_id, step, model, requests, cached_requests,
+			prompt_tokens, completion_tokens, cost, created_at
+		FROM usage_records WHERE run_id = ? ORDER BY created_at`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("查询用量失败: %w", err)
+	}
+	defer rows.Close()
+
+	var records []UsageRecord
+	for rows.Next() {
+		var r UsageRecord
+		var createdAt int64
+		if err := rows.Scan(&r.RunID, &r.Step, &r.Model, &r.Requests, &r.CachedRequests,
+			&r.PromptTokens, &r.CompletionTokens, &r.Cost, &createdAt); err != nil {
+			return nil, err
+		}
+		r.CreatedAt = time.UnixMilli(createdAt)
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
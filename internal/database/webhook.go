@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WebhookDelivery 一次 webhook 投递尝试的记录
+type WebhookDelivery struct {
+	// DeliveryID 同一次通知的各次重试共用
+	DeliveryID string `json:"delivery_id"`
+	Attempt    int    `json:"attempt"`
+	RunID      string `json:"run_id"`
+	Event      string `json:"event"`
+	URL        string `json:"url"`
+	// StatusCode 接收方返回的状态码，请求未完成时为 0
+	StatusCode int       `json:"status_code"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// SaveDelivery 写入投递记录
+func (s *sqlDB) SaveDelivery(ctx context.Context, d *WebhookDelivery) error {
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = time.Now()
+	}
+	_, err := s.db.ExecContext(ctx, `
+		REPLACE INTO webhook_deliveries (delivery_id, attempt, run_id, event, url, status_code,
+			error_message, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.DeliveryID, d.Attempt, d.RunID, d.Event, d.URL, d.StatusCode, d.Error,
+		d.DurationMs, d.CreatedAt.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("写入投递记录失败: %w", err)
+	}
+	return nil
+}
+
+// ListDeliveries 按时间顺序列出运行的投递记录
+func (s *sqlDB) ListDeliveries(ctx context.Context, runID string) ([]WebhookDelivery, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT delivery_id, attempt, run_id, event, url, status_code, error_message, duration_ms, created_at
+		FROM webhook_deliveries WHERE run_id = ? ORDER BY created_at, attempt`, runID)
+	if err != nil {
+		return nil, fmt.Errorf("查询投递记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var (
+			d         WebhookDelivery
+			createdAt int64
+		)
+		if err := rows.Scan(&d.DeliveryID, &d.Attempt, &d.RunID, &d.Event, &d.URL, &d.StatusCode,
+			&d.Error, &d.DurationMs, &createdAt); err != nil {
+			return nil, err
+		}
+		d.CreatedAt = time.UnixMilli(createdAt)
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
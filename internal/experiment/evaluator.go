@@ -0,0 +1,69 @@
+package experiment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"learn/internal/agent"
+	"learn/internal/provider"
+)
+
+// maxJudgedOutput 交给评审模型的输出最大长度（字符），超出部分截断
+const maxJudgedOutput = 20000
+
+// Score 评估结果
+type Score struct {
+	Value  float64 `json:"score"`
+	Reason string  `json:"reason"`
+}
+
+// Evaluator 为一条输入的输出打分，分数越高越好
+type Evaluator interface {
+	Name() string
+	Evaluate(ctx context.Context, input, output string) (Score, error)
+}
+
+// Judge 由模型按评审角色的提示词打 1~10 分
+type Judge struct {
+	provider provider.Provider
+	model    string
+	opts     []agent.Option
+}
+
+// NewJudge 创建使用 model 评分的评审，opts 追加到评审 Agent 的选项，如提示词覆盖
+func NewJudge(p provider.Provider, model string, opts ...agent.Option) *Judge {
+	return &Judge{provider: p, model: model, opts: opts}
+}
+
+func (j *Judge) Name() string {
+	return "judge:" + j.model
+}
+
+// Evaluate 请求评审模型以 JSON 返回分数与理由
+func (j *Judge) Evaluate(ctx context.Context, input, output string) (Score, error) {
+	if r := []rune(output); len(r) > maxJudgedOutput {
+		output = string(r[:maxJudgedOutput]) + "\n...(已截断)"
+	}
+	app := agent.NewAgent(append([]agent.Option{
+		agent.WithAgentName("评审"),
+		agent.WithRole(agent.EvaluatorRole),
+		agent.WithModel(j.model),
+		agent.WithTemperature(0),
+		agent.WithFormat(agent.FormatJSON),
+		agent.WithUserPrompt(fmt.Sprintf("用户需求：\n%s\n\n模型输出：\n%s", input, output)),
+	}, j.opts...)...)
+
+	_, content, err := app.ExecuteTaskContext(ctx, j.provider)
+	if err != nil {
+		return Score{}, fmt.Errorf("评审失败: %w", err)
+	}
+	var score Score
+	if err := json.Unmarshal([]byte(content), &score); err != nil {
+		return Score{}, fmt.Errorf("解析评审结果失败: %w", err)
+	}
+	if score.Value < 1 || score.Value > 10 {
+		return Score{}, fmt.Errorf("评审分数超出范围: %v", score.Value)
+	}
+	return score, nil
+}
@@ -0,0 +1,252 @@
+package experiment
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"learn/internal/agent"
+	"learn/internal/chain"
+	"learn/internal/database"
+	"learn/internal/model"
+	"learn/internal/util"
+)
+
+// 实验的两组配置
+const (
+	VariantA = "a"
+	VariantB = "b"
+)
+
+// Variant 一组实验配置，与另一组只在模型或提示词上不同
+type Variant struct {
+	// Label 便于识别的名称，如 fe-v2
+	Label string `json:"label,omitempty"`
+	// Model 覆盖各 Agent 步骤使用的模型，为空时使用配置
+	Model string `json:"model,omitempty"`
+	// Prompts 覆盖角色的系统提示词，Versions 为其版本
+	Prompts  map[agent.Role]string `json:"prompts,omitempty"`
+	Versions map[agent.Role]string `json:"versions,omitempty"`
+}
+
+// Input 一条实验输入，格式与批量文件相同，只使用 id 与 prompt
+type Input struct {
+	ID     string `json:"id,omitempty"`
+	Prompt string `json:"prompt"`
+}
+
+// Store 实验存储
+type Store interface {
+	SaveExperiment(ctx context.Context, e *database.Experiment) error
+	SaveExperimentResult(ctx context.Context, r *database.ExperimentResult) error
+}
+
+// Runner 实验执行器
+type Runner struct {
+	store       Store
+	pipeline    string
+	setup       func(c *chain.Chain)
+	evaluator   Evaluator
+	concurrency int
+	// artifactsDir 生成文件的根目录，每次运行写入 <dir>/<实验 ID>/<输入 ID>/<a|b>
+	artifactsDir string
+}
+
+// Option 定义 with 选项函数类型
+type Option func(*Runner)
+
+// WithPipeline 设置流水线，默认 default
+func WithPipeline(name string) Option {
+	return func(r *Runner) {
+		r.pipeline = name
+	}
+}
+
+// WithSetup 设置链条初始化函数，用于注入模型服务与存储
+func WithSetup(setup func(c *chain.Chain)) Option {
+	return func(r *Runner) {
+		r.setup = setup
+	}
+}
+
+// WithEvaluator 设置评估方式，为空时只保存输出不打分
+func WithEvaluator(e Evaluator) Option {
+	return func(r *Runner) {
+		r.evaluator = e
+	}
+}
+
+// WithConcurrency 设置同时执行的运行数，默认 1
+func WithConcurrency(n int) Option {
+	return func(r *Runner) {
+		r.concurrency = n
+	}
+}
+
+// WithArtifactsDir 设置生成文件的根目录，为空时写入当前目录
+func WithArtifactsDir(dir string) Option {
+	return func(r *Runner) {
+		r.artifactsDir = dir
+	}
+}
+
+// NewRunner 创建实验执行器，结果写入 store
+func NewRunner(store Store, opts ...Option) *Runner {
+	r := &Runner{store: store, pipeline: chain.DefaultPipeline, concurrency: 1}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.concurrency = max(r.concurrency, 1)
+	return r
+}
+
+// ReadInputs 读取 JSONL 格式的实验输入，空行与 # 开头的行被忽略，id 为空时使用 line-<行号>
+func ReadInputs(in io.Reader) ([]Input, error) {
+	var inputs []Input
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var input Input
+		if err := json.Unmarshal([]byte(text), &input); err != nil {
+			return nil, fmt.Errorf("第 %d 行解析失败: %w", line, err)
+		}
+		if input.Prompt == "" {
+			return nil, fmt.Errorf("第 %d 行缺少 prompt", line)
+		}
+		if input.ID == "" {
+			input.ID = fmt.Sprintf("line-%d", line)
+		}
+		inputs = append(inputs, input)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取实验输入失败: %w", err)
+	}
+	return inputs, nil
+}
+
+// Run 以两组配置分别运行每条输入，评估输出并保存成对的结果
+// ctx 取消后不再开始新的运行，已保存的结果仍可通过 Summarize 汇总
+func (r *Runner) Run(ctx context.Context, name string, a, b Variant, inputs []Input) (*Report, error) {
+	exp := &database.Experiment{ID: util.NewID(), Name: name, Pipeline: r.pipeline}
+	var err error
+	if exp.VariantA, err = json.Marshal(a); err != nil {
+		return nil, err
+	}
+	if exp.VariantB, err = json.Marshal(b); err != nil {
+		return nil, err
+	}
+	if r.evaluator != nil {
+		exp.Evaluator = r.evaluator.Name()
+	}
+	if err := r.store.SaveExperiment(ctx, exp); err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "开始实验", "experiment_id", exp.ID, "inputs", len(inputs))
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, r.concurrency)
+		results []database.ExperimentResult
+		serr    error
+	)
+	variants := []struct {
+		name string
+		v    Variant
+	}{{VariantA, a}, {VariantB, b}}
+loop:
+	for _, input := range inputs {
+		for _, variant := range variants {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				break loop
+			}
+			wg.Add(1)
+			go func(input Input, name string, v Variant) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				res := r.runOne(ctx, exp.ID, input, name, v)
+				err := r.store.SaveExperimentResult(context.WithoutCancel(ctx), res)
+
+				mu.Lock()
+				defer mu.Unlock()
+				results = append(results, *res)
+				if err != nil && serr == nil {
+					serr = err
+				}
+			}(input, variant.name, variant.v)
+		}
+	}
+	wg.Wait()
+
+	report := Summarize(exp, results)
+	if serr != nil {
+		return report, serr
+	}
+	return report, ctx.Err()
+}
+
+// runOne 以一组配置运行一条输入并评估输出
+func (r *Runner) runOne(ctx context.Context, experimentID string, input Input, name string, v Variant) *database.ExperimentResult {
+	res := &database.ExperimentResult{
+		ExperimentID: experimentID,
+		InputID:      input.ID,
+		Input:        input.Prompt,
+		Variant:      name,
+		Status:       string(model.StatusFailed),
+	}
+	ch, err := chain.NewPipeline(r.pipeline)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	if r.setup != nil {
+		r.setup(ch)
+	}
+
+	request := &chain.Request{
+		Message:        input.Prompt,
+		Data:           make(map[string]any),
+		Model:          v.Model,
+		Prompts:        v.Prompts,
+		PromptVersions: v.Versions,
+	}
+	if r.artifactsDir != "" {
+		request.ArtifactDir = filepath.Join(r.artifactsDir, experimentID, util.SafeName(input.ID), name)
+	}
+	result := ch.HandleRequest(request.SetContext(ctx))
+	res.RunID = result.RunID
+	res.Status = string(result.Status)
+	res.Output = result.Output
+	res.Error = result.Error
+	if result.Status != model.StatusCompleted || result.Output == "" || r.evaluator == nil {
+		return res
+	}
+
+	score, err := r.evaluator.Evaluate(ctx, input.Prompt, result.Output)
+	if err != nil {
+		slog.WarnContext(ctx, "评估失败", "input_id", input.ID, "variant", name, "error", err)
+		res.Error = err.Error()
+		return res
+	}
+	res.Score, res.Reason = &score.Value, score.Reason
+	return res
+}
+
@@ -0,0 +1,121 @@
+package experiment
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"learn/internal/chain"
+	"learn/internal/database"
+	"learn/internal/model"
+	"learn/internal/provider"
+)
+
+// modelEcho 回复中带上请求的模型，用于区分两组配置的输出
+type modelEcho struct{}
+
+func (modelEcho) Name() string {
+	return "echo"
+}
+
+func (modelEcho) Chat(_ context.Context, req *provider.ChatRequest) (*provider.ChatResponse, error) {
+	last := req.Messages[len(req.Messages)-1].Content
+	return &provider.ChatResponse{Content: fmt.Sprintf("%s: %s", req.Model, last)}, nil
+}
+
+// modelScore 按输出中的模型打分，model-b 更高
+type modelScore struct{}
+
+func (modelScore) Name() string {
+	return "model-score"
+}
+
+func (modelScore) Evaluate(_ context.Context, input, output string) (Score, error) {
+	if strings.HasPrefix(output, "model-b") {
+		return Score{Value: 8, Reason: "b"}, nil
+	}
+	return Score{Value: 5, Reason: "a"}, nil
+}
+
+func TestRunnerPairsVariants(t *testing.T) {
+	ctx := context.Background()
+	store := database.OpenTest(t)
+	r := NewRunner(store,
+		WithPipeline("analyze"),
+		WithSetup(func(c *chain.Chain) { c.SetProvider(modelEcho{}) }),
+		WithEvaluator(modelScore{}),
+		WithConcurrency(3),
+		WithArtifactsDir(t.TempDir()),
+	)
+	inputs := []Input{{ID: "login", Prompt: "做一个登录页"}, {ID: "todo", Prompt: "做一个待办清单"}}
+
+	report, err := r.Run(ctx, "models", Variant{Label: "base", Model: "model-a"}, Variant{Label: "next", Model: "model-b"}, inputs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Experiment.Evaluator != "model-score" || report.Experiment.Pipeline != "analyze" {
+		t.Errorf("experiment = %+v", report.Experiment)
+	}
+	if len(report.Pairs) != 2 || report.WinsB != 2 || report.WinsA != 0 || report.Ties != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+	if report.A.Completed != 2 || report.A.MeanScore != 5 || report.B.MeanScore != 8 {
+		t.Errorf("stats a = %+v, b = %+v", report.A, report.B)
+	}
+	for i, p := range report.Pairs {
+		input := inputs[i]
+		if p.InputID != input.ID || p.Winner != VariantB {
+			t.Errorf("pair %d = %s, winner %s", i, p.InputID, p.Winner)
+		}
+		// 同一输入的两组结果分别来自各自的模型
+		if p.A.Variant != VariantA || !strings.HasPrefix(p.A.Output, "model-a") || !strings.Contains(p.A.Output, input.Prompt) {
+			t.Errorf("pair %s a = %+v", p.InputID, p.A)
+		}
+		if p.B.Variant != VariantB || !strings.HasPrefix(p.B.Output, "model-b") || p.B.Status != string(model.StatusCompleted) {
+			t.Errorf("pair %s b = %+v", p.InputID, p.B)
+		}
+	}
+
+	saved, err := store.ListExperimentResults(ctx, report.Experiment.ID)
+	if err != nil || len(saved) != 4 {
+		t.Fatalf("saved %d results, err = %v", len(saved), err)
+	}
+	if summary := Summarize(report.Experiment, saved); summary.WinsB != 2 {
+		t.Errorf("summary from saved results = %+v", summary)
+	}
+}
+
+func TestJudge(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  float64
+		err   string
+	}{
+		{`{"score": 8, "reason": "完整"}`, 8, ""},
+		{`{"score": 11, "reason": "太高"}`, 0, "超出范围"},
+		{`{"score": 0, "reason": "缺少分数"}`, 0, "超出范围"},
+	}
+	for _, tt := range tests {
+		mock := provider.NewMock().Reply(tt.reply)
+		score, err := NewJudge(mock, "judge").Evaluate(context.Background(), "做一个登录页", "<html></html>")
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("reply %s: err = %v, want %q", tt.reply, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || score.Value != tt.want || score.Reason != "完整" {
+			t.Errorf("reply %s: score = %+v, err = %v", tt.reply, score, err)
+		}
+
+		// 评审请求以 temperature 0 与 JSON 模式发送，包含需求与输出
+		req := mock.Call(0)
+		if req.Model != "judge" || req.Format != "json" || req.Options["temperature"] != 0.0 {
+			t.Errorf("request model = %s, format = %s, options = %v", req.Model, req.Format, req.Options)
+		}
+		if prompt := req.Messages[len(req.Messages)-1].Content; !strings.Contains(prompt, "做一个登录页") || !strings.Contains(prompt, "<html></html>") {
+			t.Errorf("user prompt = %q", prompt)
+		}
+	}
+}
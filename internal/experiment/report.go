@@ -0,0 +1,93 @@
+package experiment
+
+import (
+	"sort"
+
+	"learn/internal/database"
+	"learn/internal/model"
+)
+
+// Report 实验汇总
+type Report struct {
+	Experiment *database.Experiment `json:"experiment"`
+	A          VariantStats         `json:"a"`
+	B          VariantStats         `json:"b"`
+	// WinsA、WinsB 与 Ties 只统计两组都有分数的输入
+	WinsA int    `json:"wins_a"`
+	WinsB int    `json:"wins_b"`
+	Ties  int    `json:"ties"`
+	Pairs []Pair `json:"pairs"`
+}
+
+// VariantStats 一组配置的统计
+type VariantStats struct {
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+	Scored    int `json:"scored"`
+	// MeanScore 有分数的结果的平均分
+	MeanScore float64 `json:"mean_score"`
+}
+
+// Pair 同一输入在两组配置下的结果
+type Pair struct {
+	InputID string                     `json:"input_id"`
+	A       *database.ExperimentResult `json:"a,omitempty"`
+	B       *database.ExperimentResult `json:"b,omitempty"`
+	// Winner 为 a、b 或 tie，任一组没有分数时为空
+	Winner string `json:"winner,omitempty"`
+}
+
+// Summarize 将实验结果按输入配对并统计
+func Summarize(exp *database.Experiment, results []database.ExperimentResult) *Report {
+	report := &Report{Experiment: exp}
+	pairs := make(map[string]*Pair)
+	var sumA, sumB float64
+	for i := range results {
+		res := &results[i]
+		p, ok := pairs[res.InputID]
+		if !ok {
+			p = &Pair{InputID: res.InputID}
+			pairs[res.InputID] = p
+		}
+		stats, sum := &report.A, &sumA
+		if res.Variant == VariantB {
+			p.B, stats, sum = res, &report.B, &sumB
+		} else {
+			p.A = res
+		}
+		if res.Status == string(model.StatusCompleted) {
+			stats.Completed++
+		} else {
+			stats.Failed++
+		}
+		if res.Score != nil {
+			stats.Scored++
+			*sum += *res.Score
+		}
+	}
+	if report.A.Scored > 0 {
+		report.A.MeanScore = sumA / float64(report.A.Scored)
+	}
+	if report.B.Scored > 0 {
+		report.B.MeanScore = sumB / float64(report.B.Scored)
+	}
+
+	for _, p := range pairs {
+		if p.A != nil && p.B != nil && p.A.Score != nil && p.B.Score != nil {
+			switch {
+			case *p.A.Score > *p.B.Score:
+				p.Winner = VariantA
+				report.WinsA++
+			case *p.A.Score < *p.B.Score:
+				p.Winner = VariantB
+				report.WinsB++
+			default:
+				p.Winner = "tie"
+				report.Ties++
+			}
+		}
+		report.Pairs = append(report.Pairs, *p)
+	}
+	sort.Slice(report.Pairs, func(i, j int) bool { return report.Pairs[i].InputID < report.Pairs[j].InputID })
+	return report
+}
@@ -1,6 +1,7 @@
 package gen
 
 import (
+	"bufio"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -48,6 +49,8 @@ type ModelInfo struct {
 // 定义本地大语言模型接口
 type ILocalLLM interface {
 	ModelList() ([]Models, error)
+	ShowModel(name string) (*ModelInfo, error)
+	PullModel(name string, progress func(status string, completed, total int64)) error
 	GetReply(resp *resty.Response) string
 	Client(requestBody map[string]any) (*resty.Response, error)
 }
@@ -59,8 +62,13 @@ type LocalLLM struct {
 
 // 创建本地大语言模型客户端实例
 func NewLocalLargeModelClient() ILocalLLM {
+	return NewLocalLLM(config.OllamaUrl)
+}
+
+// NewLocalLLM 创建指定地址的本地大语言模型客户端
+func NewLocalLLM(baseURL string) ILocalLLM {
 	client := resty.New()
-	client.SetBaseURL(config.OllamaUrl)
+	client.SetBaseURL(baseURL)
 	client.SetTLSClientConfig(&tls.Config{
 		InsecureSkipVerify: true,
 	})
@@ -89,6 +97,57 @@ func (llm *LocalLLM) ModelList() ([]Models, error) {
 	return modelList.Models, nil
 }
 
+// 获取模型详情
+func (llm *LocalLLM) ShowModel(name string) (*ModelInfo, error) {
+	resp, err := llm.client.R().SetBody(map[string]any{"model": name}).Post("/api/show")
+	if err != nil {
+		return nil, fmt.Errorf("failed to show model: %w", err)
+	}
+
+	if resp.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("failed to show model: HTTP %d: %s", resp.StatusCode(), resp.String())
+	}
+
+	var info ModelInfo
+	if err := json.Unmarshal(resp.Bytes(), &info); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal model info: %w", err)
+	}
+
+	return &info, nil
+}
+
+// 拉取模型，progress 接收下载进度，可为 nil
+func (llm *LocalLLM) PullModel(name string, progress func(status string, completed, total int64)) error {
+	resp, err := llm.client.R().
+		SetBody(map[string]any{"model": name, "stream": true}).
+		SetDoNotParseResponse(true).
+		SetTimeout(0).
+		Post("/api/pull")
+	if err != nil {
+		return fmt.Errorf("failed to pull model: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode() != http.StatusOK {
+		return fmt.Errorf("failed to pull model: HTTP %d", resp.StatusCode())
+	}
+
+	// 响应为逐行的 JSON 进度
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if msg := gjson.GetBytes(line, "error").String(); msg != "" {
+			return fmt.Errorf("failed to pull model: %s", msg)
+		}
+		if progress != nil {
+			progress(gjson.GetBytes(line, "status").String(),
+				gjson.GetBytes(line, "completed").Int(),
+				gjson.GetBytes(line, "total").Int())
+		}
+	}
+	return scanner.Err()
+}
+
 func (llm *LocalLLM) GetReply(resp *resty.Response) string {
 	if resp.IsError() {
 		return ""
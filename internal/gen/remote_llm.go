@@ -18,11 +18,10 @@ type RemoteLargeModelClient struct {
 
 // NewRemoteLargeModelClient 创建新的远程大模型客户端
 func NewRemoteLargeModelClient(baseURL, apiKey string) *RemoteLargeModelClient {
+	// 不在 HTTP 层重试，统一交给 Agent 的重试策略处理
 	client := resty.New()
 	client.
 		SetTimeout(300*time.Second).
-		SetRetryCount(3).
-		SetRetryWaitTime(5*time.Second).
 		SetHeader("Content-Type", "application/json").
 		SetHeader("Authorization", "Bearer "+apiKey).
 		SetHeader("Accept", "application/json")
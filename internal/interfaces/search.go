@@ -0,0 +1,17 @@
+package interfaces
+
+import "context"
+
+// SearchResult 单条搜索结果
+type SearchResult struct {
+	Title   string  `json:"title"`
+	URL     string  `json:"url"`
+	Content string  `json:"content"`
+	Score   float64 `json:"score"`
+}
+
+// ISearchProvider 搜索服务提供方，供 Agent 以工具形式调用
+type ISearchProvider interface {
+	Name() string
+	Search(ctx context.Context, query string, limit int) ([]SearchResult, error)
+}
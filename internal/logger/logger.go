@@ -0,0 +1,155 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"learn/internal/secret"
+)
+
+// Options 日志配置
+type Options struct {
+	// Level 日志级别 debug|info|warn|error
+	Level string
+	// Format 输出格式 text|json
+	Format string
+	// Redact 开启后提示词与响应正文只输出长度
+	Redact bool
+	Output io.Writer
+}
+
+var redact atomic.Bool
+
+// Setup 初始化默认日志，标准库 log 的输出也会转到 slog
+func Setup(opts Options) error {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return err
+	}
+	if opts.Output == nil {
+		opts.Output = os.Stderr
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactSecrets}
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(opts.Output, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(opts.Output, handlerOpts)
+	default:
+		return fmt.Errorf("不支持的日志格式: %s", opts.Format)
+	}
+
+	redact.Store(opts.Redact)
+	slog.SetDefault(slog.New(&contextHandler{Handler: handler}))
+	return nil
+}
+
+// redactSecrets 将消息、字符串与错误属性中已登记的密钥替换为 ***，见 secret.Register
+func redactSecrets(_ []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(secret.Redact(a.Value.String()))
+	case slog.KindAny:
+		var text string
+		switch v := a.Value.Any().(type) {
+		case error:
+			text = v.Error()
+		case fmt.Stringer:
+			text = v.String()
+		default:
+			return a
+		}
+		if redacted := secret.Redact(text); redacted != text {
+			a.Value = slog.StringValue(redacted)
+		}
+	}
+	return a
+}
+
+// ParseLevel 解析日志级别
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("不支持的日志级别: %s", level)
+}
+
+type ctxKey struct{}
+
+// With 在 ctx 上追加日志属性，使用该 ctx 输出的日志都会带上这些属性
+func With(ctx context.Context, args ...any) context.Context {
+	r := slog.NewRecord(time.Time{}, 0, "", 0)
+	r.Add(args...)
+
+	parent := attrsFrom(ctx)
+	attrs := make([]slog.Attr, 0, len(parent)+r.NumAttrs())
+	attrs = append(attrs, parent...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return context.WithValue(ctx, ctxKey{}, attrs)
+}
+
+func attrsFrom(ctx context.Context) []slog.Attr {
+	if ctx == nil {
+		return nil
+	}
+	attrs, _ := ctx.Value(ctxKey{}).([]slog.Attr)
+	return attrs
+}
+
+// Payload 在 debug 级别输出提示词或响应正文，开启脱敏时只输出长度
+func Payload(ctx context.Context, msg, key string, body any) {
+	if !slog.Default().Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	text, ok := body.(string)
+	if !ok {
+		data, err := json.Marshal(body)
+		if err != nil {
+			text = fmt.Sprintf("%v", body)
+		} else {
+			text = string(data)
+		}
+	}
+	if redact.Load() {
+		text = fmt.Sprintf("[redacted %d bytes]", len(text))
+	}
+	slog.DebugContext(ctx, msg, key, text)
+}
+
+// contextHandler 把 ctx 中的属性附加到每条日志
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.AddAttrs(attrsFrom(ctx)...)
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
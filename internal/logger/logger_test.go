@@ -0,0 +1,33 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"learn/internal/secret"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	secret.Register("sk-logger-secret")
+
+	var buf bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{ReplaceAttr: redactSecrets}))
+	log.Info("请求 sk-logger-secret 失败",
+		"key", "sk-logger-secret",
+		"error", errors.New("401: bad key sk-logger-secret"),
+		"count", 3,
+	)
+
+	out := buf.String()
+	if strings.Contains(out, "sk-logger-secret") {
+		t.Fatalf("secret leaked: %s", out)
+	}
+	for _, want := range []string{`msg="请求 *** 失败"`, "key=***", `error="401: bad key ***"`, "count=3"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q: %s", want, out)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"learn/internal/agent"
+	"learn/internal/chain"
+	"learn/internal/provider"
+)
+
+// Default 默认注册表
+var Default = NewRegistry()
+
+var (
+	requestsTotal = Default.NewCounter("llm_requests_total",
+		"Model requests by provider, model and status.", "provider", "model", "status")
+	requestDuration = Default.NewHistogram("llm_request_duration_seconds",
+		"Model request latency.", nil, "provider", "model")
+	retriesTotal = Default.NewCounter("llm_retries_total",
+		"Model requests that were retried.", "provider", "model")
+	failuresTotal = Default.NewCounter("llm_failures_total",
+		"Failed model requests by error class.", "provider", "model", "class")
+	tokensTotal = Default.NewCounter("llm_tokens_total",
+		"Tokens consumed by direction (in = prompt, out = completion).", "provider", "model", "direction")
+	cacheHitsTotal = Default.NewCounter("llm_cache_hits_total",
+		"Model responses served from cache.", "provider", "model")
+
+	tasksTotal = Default.NewCounter("agent_tasks_total",
+		"Agent tasks by final status.", "agent", "status")
+
+	activeRuns = Default.NewGauge("chain_active_runs",
+		"Chain runs currently in progress.")
+	runsTotal = Default.NewCounter("chain_runs_total",
+		"Finished chain runs by status.", "status")
+	runDuration = Default.NewHistogram("chain_run_duration_seconds",
+		"Chain run duration.", nil)
+	stepDuration = Default.NewHistogram("chain_step_duration_seconds",
+		"Chain step duration by step and outcome.", nil, "step", "status")
+)
+
+var installOnce sync.Once
+
+// Install 注册 Agent 与 Chain 的回调开始采集指标，重复调用无效
+func Install() {
+	installOnce.Do(func() {
+		agent.AddHooks(agent.Hooks{
+			OnAttempt: observeAttempt,
+			OnTask: func(_ context.Context, e agent.TaskEvent) {
+				tasksTotal.Inc(e.Agent, string(e.Status))
+			},
+		})
+
+		chain.AddHooks(chain.Hooks{
+			OnRunStart: func(context.Context, string) {
+				activeRuns.Add(1)
+			},
+			OnRunEnd: func(_ context.Context, result *chain.Result, elapsed time.Duration) {
+				activeRuns.Add(-1)
+				runsTotal.Inc(string(result.Status))
+				runDuration.Observe(elapsed.Seconds())
+			},
+			OnStepEnd: func(_ context.Context, e chain.StepEvent) {
+				stepDuration.Observe(e.Duration.Seconds(), e.Step, outcome(e.Err))
+			},
+		})
+	})
+}
+
+func observeAttempt(_ context.Context, e agent.AttemptEvent) {
+	requestsTotal.Inc(e.Provider, e.Model, outcome(e.Err))
+	requestDuration.Observe(e.Duration.Seconds(), e.Provider, e.Model)
+
+	if e.Err != nil {
+		failuresTotal.Inc(e.Provider, e.Model, string(provider.Classify(e.Err)))
+	}
+	if e.Retrying {
+		retriesTotal.Inc(e.Provider, e.Model)
+	}
+	if e.Cached {
+		cacheHitsTotal.Inc(e.Provider, e.Model)
+		return
+	}
+	tokensTotal.Add(float64(e.Usage.PromptTokens), e.Provider, e.Model, "in")
+	tokensTotal.Add(float64(e.Usage.CompletionTokens), e.Provider, e.Model, "out")
+}
+
+func outcome(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
+
+// Handler 返回默认注册表的 /metrics 处理器
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// Serve 在 addr 上启动仅包含 /metrics 的 HTTP 服务，阻塞直到出错
+func Serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", Handler())
+	return http.ListenAndServe(addr, mux)
+}
@@ -0,0 +1,68 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// Alias 模型别名指向的服务与模型
+type Alias struct {
+	Provider Provider
+	Model    string
+}
+
+// Aliases 按模型别名分发请求：别名改写为实际模型后交给对应的服务，其他模型名交给默认服务
+type Aliases struct {
+	name     string
+	fallback Provider
+	aliases  map[string]Alias
+}
+
+// NewAliases 创建按模型别名分发的服务提供方，fallback 为空时未知的模型名返回错误
+func NewAliases(name string, fallback Provider, aliases map[string]Alias) *Aliases {
+	return &Aliases{name: name, fallback: fallback, aliases: aliases}
+}
+
+func (a *Aliases) Name() string {
+	return a.name
+}
+
+// Resolve 返回模型名对应的服务与实际模型
+func (a *Aliases) Resolve(model string) (Provider, string, error) {
+	if alias, ok := a.aliases[model]; ok {
+		return alias.Provider, alias.Model, nil
+	}
+	if a.fallback == nil {
+		return nil, "", fmt.Errorf("%s: 未知的模型别名: %s", a.name, model)
+	}
+	return a.fallback, model, nil
+}
+
+// Names 返回已配置的别名
+func (a *Aliases) Names() []string {
+	names := make([]string, 0, len(a.aliases))
+	for name := range a.aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Chat 解析别名后转发请求，不修改调用方的请求；响应的 Model 为实际模型，用于计费
+func (a *Aliases) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	p, model, err := a.Resolve(req.Model)
+	if err != nil {
+		return nil, err
+	}
+	if model != req.Model {
+		r := *req
+		r.Model = model
+		req = &r
+	}
+	resp, err := p.Chat(ctx, req)
+	if resp != nil && resp.Model == "" {
+		resp.Model = model
+	}
+	return resp, err
+}
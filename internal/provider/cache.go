@@ -0,0 +1,259 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"learn/internal/database"
+)
+
+// CacheStore 缓存存储，database.SQLiteDB 与 database.MDB 均已实现
+type CacheStore interface {
+	GetCache(ctx context.Context, key string) (*database.CacheEntry, error)
+	SetCache(ctx context.Context, entry *database.CacheEntry) error
+	ScanCache(ctx context.Context, scope string) ([]database.CacheEntry, error)
+}
+
+// Embedder 文本向量化，用于语义缓存
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float64, error)
+}
+
+// EmbedFunc 函数形式的 Embedder
+type EmbedFunc func(ctx context.Context, text string) ([]float64, error)
+
+func (f EmbedFunc) Embed(ctx context.Context, text string) ([]float64, error) {
+	return f(ctx, text)
+}
+
+// Cached 带响应缓存的服务提供方
+// 默认仅缓存显式设置 temperature 为 0 的请求：未设置时服务使用自己的默认值（Ollama 为 0.8），
+// 输出并不确定；开启 force 时缓存全部请求
+type Cached struct {
+	Provider
+	store CacheStore
+	ttl   time.Duration
+	force bool
+
+	// 语义缓存：向量余弦相似度不低于 threshold 时视为命中
+	embedder  Embedder
+	threshold float64
+}
+
+// CacheOption 定义 Cached 选项函数类型
+type CacheOption func(*Cached)
+
+// WithTTL 设置缓存有效期，0 表示永不过期
+func WithTTL(ttl time.Duration) CacheOption {
+	return func(c *Cached) {
+		c.ttl = ttl
+	}
+}
+
+// WithForceCache 未设置 temperature 或 temperature > 0 时也使用缓存
+func WithForceCache(force bool) CacheOption {
+	return func(c *Cached) {
+		c.force = force
+	}
+}
+
+// WithSemantic 开启语义缓存，threshold 不大于 0 时不开启，否则任意缓存都会被视为命中
+func WithSemantic(embedder Embedder, threshold float64) CacheOption {
+	return func(c *Cached) {
+		if threshold <= 0 {
+			c.embedder = nil
+			return
+		}
+		c.embedder = embedder
+		c.threshold = threshold
+	}
+}
+
+// NewCached 为服务提供方加上响应缓存
+func NewCached(p Provider, store CacheStore, opts ...CacheOption) *Cached {
+	c := &Cached{
+		Provider:  p,
+		store:     store,
+		ttl:       24 * time.Hour,
+		threshold: 0.95,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Chat 优先返回缓存结果，未命中时请求并写入缓存
+func (c *Cached) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	if !c.cacheable(req) {
+		return c.Provider.Chat(ctx, req)
+	}
+
+	key, err := CacheKey(c.Name(), req)
+	if err != nil {
+		return c.Provider.Chat(ctx, req)
+	}
+
+	if resp := c.lookup(ctx, key); resp != nil {
+		return resp, nil
+	}
+
+	var embedding []float64
+	if c.embedder != nil {
+		embedding, err = c.embedder.Embed(ctx, promptText(req))
+		if err != nil {
+			slog.WarnContext(ctx, "语义缓存向量化失败", "error", err)
+		} else if resp := c.nearest(ctx, req, embedding); resp != nil {
+			return resp, nil
+		}
+	}
+
+	resp, err := c.Provider.Chat(ctx, req)
+	if err != nil || isEmpty(resp) {
+		return resp, err
+	}
+	c.save(ctx, key, req, resp, embedding)
+	return resp, nil
+}
+
+// cacheable 判断请求是否应当使用缓存
+func (c *Cached) cacheable(req *ChatRequest) bool {
+	if c.force {
+		return true
+	}
+	t, ok := req.Options["temperature"]
+	if !ok {
+		return false
+	}
+	switch v := t.(type) {
+	case float64:
+		return v <= 0
+	case float32:
+		return v <= 0
+	case int:
+		return v <= 0
+	}
+	return false
+}
+
+func (c *Cached) lookup(ctx context.Context, key string) *ChatResponse {
+	entry, err := c.store.GetCache(ctx, key)
+	if err != nil {
+		slog.WarnContext(ctx, "读取缓存失败", "error", err)
+		return nil
+	}
+	if entry == nil {
+		return nil
+	}
+	return decodeCached(entry)
+}
+
+// nearest 在同一服务与模型范围内查找最相似的缓存
+func (c *Cached) nearest(ctx context.Context, req *ChatRequest, embedding []float64) *ChatResponse {
+	entries, err := c.store.ScanCache(ctx, c.scope(req))
+	if err != nil {
+		slog.WarnContext(ctx, "读取语义缓存失败", "error", err)
+		return nil
+	}
+
+	var best *database.CacheEntry
+	bestScore := c.threshold
+	for i := range entries {
+		if score := cosine(embedding, entries[i].Embedding); score >= bestScore {
+			best, bestScore = &entries[i], score
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return decodeCached(best)
+}
+
+func (c *Cached) save(ctx context.Context, key string, req *ChatRequest, resp *ChatResponse, embedding []float64) {
+	value, err := json.Marshal(resp)
+	if err != nil {
+		return
+	}
+
+	entry := &database.CacheEntry{
+		Key:       key,
+		Scope:     c.scope(req),
+		Value:     value,
+		Embedding: embedding,
+	}
+	if c.ttl > 0 {
+		entry.ExpiresAt = time.Now().Add(c.ttl)
+	}
+	if err := c.store.SetCache(ctx, entry); err != nil {
+		slog.WarnContext(ctx, "写入缓存失败", "error", err)
+	}
+}
+
+func (c *Cached) scope(req *ChatRequest) string {
+	return c.Name() + "/" + req.Model
+}
+
+// CacheKey 根据服务名、模型、消息与参数计算缓存 key
+func CacheKey(providerName string, req *ChatRequest) (string, error) {
+	data, err := json.Marshal(struct {
+		Provider     string
+		Model        string
+		Messages     any
+		Tools        any
+		Options      map[string]any
+		EnableSearch bool
+		// Format 为空时不参与计算，已有的缓存仍然有效
+		Format string `json:",omitempty"`
+	}{providerName, req.Model, req.Messages, req.Tools, req.Options, req.EnableSearch, req.Format})
+	if err != nil {
+		return "", fmt.Errorf("计算缓存 key 失败: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func decodeCached(entry *database.CacheEntry) *ChatResponse {
+	var resp ChatResponse
+	if err := json.Unmarshal(entry.Value, &resp); err != nil {
+		slog.Warn("解析缓存失败", "key", entry.Key, "error", err)
+		return nil
+	}
+	resp.Cached = true
+	return &resp
+}
+
+// promptText 拼接消息文本用于向量化
+func promptText(req *ChatRequest) string {
+	var sb strings.Builder
+	for _, msg := range req.Messages {
+		sb.WriteString(msg.Role)
+		sb.WriteString(": ")
+		sb.WriteString(msg.Content)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// cosine 余弦相似度，维度不一致时返回 0
+func cosine(a, b []float64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"learn/internal/database"
+	"learn/internal/util"
+)
+
+// topicEmbedder 按提示词是否提到登录返回正交的向量
+var topicEmbedder = EmbedFunc(func(_ context.Context, text string) ([]float64, error) {
+	if strings.Contains(text, "登录") {
+		return []float64{1, 0}, nil
+	}
+	return []float64{0, 1}, nil
+})
+
+func chatRequest(prompt string) *ChatRequest {
+	return &ChatRequest{
+		Model:    "m",
+		Messages: []util.PromptType{util.AppendUserPrompt(prompt)},
+		Options:  map[string]any{"temperature": 0.0},
+	}
+}
+
+func TestSemanticCache(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name      string
+		threshold float64
+		prompts   []string
+		calls     int
+	}{
+		{"similar prompt hits", 0.95, []string{"做一个登录页", "请做一个登录页面"}, 1},
+		{"unrelated prompt misses", 0.95, []string{"做一个登录页", "写一个贪吃蛇"}, 2},
+		{"zero threshold disabled", 0, []string{"做一个登录页", "写一个贪吃蛇"}, 2},
+		{"negative threshold disabled", -1, []string{"做一个登录页", "请做一个登录页面"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMock().Reply("第一次").Reply("第二次")
+			c := NewCached(mock, database.OpenTest(t), WithSemantic(topicEmbedder, tt.threshold))
+			for _, prompt := range tt.prompts {
+				if _, err := c.Chat(ctx, chatRequest(prompt)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := len(mock.Calls()); got != tt.calls {
+				t.Errorf("provider calls = %d, want %d", got, tt.calls)
+			}
+		})
+	}
+}
+
+func TestExactCache(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMock().Reply("答案")
+	c := NewCached(mock, database.OpenTest(t))
+
+	first, err := c.Chat(ctx, chatRequest("做一个登录页"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.Chat(ctx, chatRequest("做一个登录页"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mock.Calls()) != 1 || first.Cached || !second.Cached || second.Content != "答案" {
+		t.Errorf("calls = %d, first = %+v, second = %+v", len(mock.Calls()), first, second)
+	}
+}
+
+func TestCacheSkipsNonDeterministic(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		options map[string]any
+		force   bool
+		calls   int
+	}{
+		// 未设置时由服务决定温度，Ollama 默认 0.8
+		{"unset temperature", nil, false, 2},
+		{"positive temperature", map[string]any{"temperature": 0.7}, false, 2},
+		{"zero temperature", map[string]any{"temperature": 0}, false, 1},
+		{"forced", nil, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMock().Reply("第一次").Reply("第二次")
+			c := NewCached(mock, database.OpenTest(t), WithForceCache(tt.force))
+			for range 2 {
+				req := chatRequest("做一个登录页")
+				req.Options = tt.options
+				if _, err := c.Chat(ctx, req); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := len(mock.Calls()); got != tt.calls {
+				t.Errorf("provider calls = %d, want %d", got, tt.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"learn/internal/util"
+)
+
+// RecordEnv 设置为 1 时 NewCassette 强制重新录制
+const RecordEnv = "LLM_RECORD"
+
+// Interaction 一次录制的请求与响应
+type Interaction struct {
+	Key      string        `json:"key"`
+	Request  *ChatRequest  `json:"request"`
+	Response *ChatResponse `json:"response,omitempty"`
+	Error    *Error        `json:"error,omitempty"`
+	// ErrorMessage 错误链无法序列化，回放时以该文本重建
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+// cassetteFile 录制文件格式
+type cassetteFile struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Recorder 录制服务提供方的每一次请求与响应，每次调用后写入文件
+type Recorder struct {
+	Provider
+	path string
+
+	mu           sync.Mutex
+	interactions []Interaction
+}
+
+// NewRecorder 创建录制器，会覆盖已有文件
+func NewRecorder(p Provider, path string) *Recorder {
+	return &Recorder{Provider: p, path: path}
+}
+
+// Chat 转发请求并记录结果
+func (r *Recorder) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	resp, err := r.Provider.Chat(ctx, req)
+
+	it := Interaction{Key: RequestKey(req), Request: req, Response: resp}
+	if err != nil {
+		var pe *Error
+		if !errors.As(err, &pe) {
+			pe = &Error{Provider: r.Name(), Class: Classify(err), Err: err}
+		}
+		recorded := *pe
+		recorded.Err = nil
+		it.Error = &recorded
+		if pe.Err != nil {
+			it.ErrorMessage = pe.Err.Error()
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interactions = append(r.interactions, it)
+	if saveErr := writeCassette(r.path, r.interactions); saveErr != nil {
+		return resp, errors.Join(err, saveErr)
+	}
+	return resp, err
+}
+
+// Replayer 按请求回放录制的响应，不发起任何网络请求
+// 相同请求出现多次时按录制顺序依次返回
+type Replayer struct {
+	name string
+
+	mu      sync.Mutex
+	pending map[string][]Interaction
+}
+
+// NewReplayer 从录制文件创建回放器
+func NewReplayer(path string) (*Replayer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取录制文件失败: %w", err)
+	}
+
+	var file cassetteFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析录制文件失败: %w", err)
+	}
+
+	r := &Replayer{name: "replay", pending: map[string][]Interaction{}}
+	for _, it := range file.Interactions {
+		r.pending[it.Key] = append(r.pending[it.Key], it)
+	}
+	return r, nil
+}
+
+func (r *Replayer) Name() string {
+	return r.name
+}
+
+// Chat 返回匹配的录制结果
+func (r *Replayer) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	key := RequestKey(req)
+
+	r.mu.Lock()
+	queue := r.pending[key]
+	if len(queue) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("replay: no recorded interaction for request %s (model %s)", key[:12], req.Model)
+	}
+	it := queue[0]
+	// 只剩最后一条时保留，允许重复请求
+	if len(queue) > 1 {
+		r.pending[key] = queue[1:]
+	}
+	r.mu.Unlock()
+
+	if it.Error != nil {
+		e := *it.Error
+		if it.ErrorMessage != "" {
+			e.Err = errors.New(it.ErrorMessage)
+		}
+		return nil, &e
+	}
+	return it.Response, nil
+}
+
+// NewCassette 设置了 LLM_RECORD=1 时录制，否则回放；文件不存在时返回错误，避免测试在不知情时请求真实服务
+func NewCassette(p Provider, path string) (Provider, error) {
+	if os.Getenv(RecordEnv) == "1" {
+		return NewRecorder(p, path), nil
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("录制文件不存在，设置 %s=1 录制: %w", RecordEnv, err)
+	}
+	return NewReplayer(path)
+}
+
+// RequestKey 归一化请求后计算的匹配 key，忽略服务名与内容首尾空白
+func RequestKey(req *ChatRequest) string {
+	messages := make([]util.PromptType, len(req.Messages))
+	for i, msg := range req.Messages {
+		msg.Content = strings.TrimSpace(msg.Content)
+		messages[i] = msg
+	}
+
+	data, _ := json.Marshal(struct {
+		Model        string
+		Messages     []util.PromptType
+		Tools        []map[string]any
+		Options      map[string]any
+		EnableSearch bool
+		// Format 为空时不参与计算，已有的录制仍然匹配
+		Format string `json:",omitempty"`
+	}{req.Model, messages, req.Tools, req.Options, req.EnableSearch, req.Format})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func writeCassette(path string, interactions []Interaction) error {
+	data, err := json.MarshalIndent(cassetteFile{Interactions: interactions}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCassetteMissingFile(t *testing.T) {
+	t.Setenv(RecordEnv, "")
+	path := filepath.Join(t.TempDir(), "missing.json")
+
+	mock := NewMock().Reply("ok")
+	if _, err := NewCassette(mock, path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("err = %v, want missing cassette error", err)
+	}
+	if len(mock.Calls()) != 0 {
+		t.Errorf("provider called %d times without %s=1", len(mock.Calls()), RecordEnv)
+	}
+}
+
+func TestCassetteRecordReplay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	t.Setenv(RecordEnv, "1")
+	recorder, err := NewCassette(NewMock().Reply("答案"), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recorder.Chat(ctx, chatRequest("做一个登录页")); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(RecordEnv, "")
+	replayer, err := NewCassette(NewMock(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 首尾空白不影响匹配
+	resp, err := replayer.Chat(ctx, chatRequest("  做一个登录页\n"))
+	if err != nil || resp.Content != "答案" {
+		t.Errorf("resp = %+v, err = %v", resp, err)
+	}
+}
@@ -0,0 +1,147 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"resty.dev/v3"
+)
+
+// ErrorClass 错误分类
+type ErrorClass string
+
+const (
+	ClassTransport     ErrorClass = "transport"               // 网络或连接错误
+	ClassRateLimited   ErrorClass = "rate_limited"            // HTTP 429
+	ClassServer        ErrorClass = "server_error"            // HTTP 5xx
+	ClassContextLength ErrorClass = "context_length_exceeded" // 提示词超出模型上下文
+	ClassEmptyContent  ErrorClass = "empty_content"           // 模型返回空内容
+	ClassInvalidJSON   ErrorClass = "invalid_json"            // 响应无法解析
+	ClassClient        ErrorClass = "client_error"            // 其余 4xx，通常不可重试
+	ClassCanceled      ErrorClass = "canceled"                // 调用方取消或超时
+	ClassInterrupted   ErrorClass = "stream_interrupted"      // 已输出流式分段后失败，不可重试
+)
+
+// Error 服务提供方返回的分类错误，可通过 errors.As 获取
+type Error struct {
+	Provider   string     `json:"provider"`
+	Class      ErrorClass `json:"class"`
+	StatusCode int        `json:"status_code,omitempty"`
+	// RetryAfter 服务端通过 Retry-After 建议的等待时间
+	RetryAfter time.Duration `json:"retry_after,omitempty"`
+	Body       string        `json:"body,omitempty"`
+	Err        error         `json:"-"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s: %s", e.Provider, e.Class)
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" (HTTP %d)", e.StatusCode)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Classify 返回错误的分类，非 *Error 的错误视为传输错误
+func Classify(err error) ErrorClass {
+	if err == nil {
+		return ""
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ClassCanceled
+	}
+	var pe *Error
+	if errors.As(err, &pe) {
+		return pe.Class
+	}
+	if errors.Is(err, ErrEmptyContent) {
+		return ClassEmptyContent
+	}
+	return ClassTransport
+}
+
+// transportError 包装请求未能完成的错误
+func transportError(name string, err error) error {
+	class := ClassTransport
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		class = ClassCanceled
+	}
+	return &Error{Provider: name, Class: class, Err: err}
+}
+
+// emptyContentError 包装空内容错误
+func emptyContentError(name string) error {
+	return &Error{Provider: name, Class: ClassEmptyContent, Err: ErrEmptyContent}
+}
+
+// invalidJSONError 包装响应解析错误
+func invalidJSONError(name string, err error) error {
+	return &Error{Provider: name, Class: ClassInvalidJSON, Err: err}
+}
+
+// httpError 根据状态码与响应体对 HTTP 错误分类
+func httpError(name string, res *resty.Response) error {
+	return statusError(name, res.StatusCode(), string(res.Bytes()), res.Header().Get("Retry-After"))
+}
+
+// statusError 按状态码分类，retryAfter 为 Retry-After 响应头的原始值
+func statusError(name string, status int, body, retryAfter string) *Error {
+	e := &Error{
+		Provider:   name,
+		StatusCode: status,
+		Body:       body,
+		Err:        fmt.Errorf("request failed: %d %s", status, http.StatusText(status)),
+	}
+
+	switch {
+	case status == http.StatusTooManyRequests:
+		e.Class = ClassRateLimited
+		e.RetryAfter = parseRetryAfter(retryAfter)
+	case status >= 500:
+		e.Class = ClassServer
+		e.RetryAfter = parseRetryAfter(retryAfter)
+	case isContextLength(body):
+		e.Class = ClassContextLength
+	default:
+		e.Class = ClassClient
+	}
+	return e
+}
+
+// isContextLength 识别各服务商超出上下文长度的错误信息
+func isContextLength(body string) bool {
+	body = strings.ToLower(body)
+	for _, s := range []string{"context_length_exceeded", "context length", "maximum context", "too many tokens", "prompt is too long"} {
+		if strings.Contains(body, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRetryAfter 解析秒数或 HTTP 日期格式的 Retry-After
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limits 限流配置，零值表示对应维度不限制
+type Limits struct {
+	// RequestsPerSecond 每秒请求数，Burst 为允许的突发请求数
+	RequestsPerSecond float64
+	Burst             int
+	// TokensPerMinute 每分钟 token 数，按请求估算值扣减
+	TokensPerMinute int
+	// MaxInFlight 最大并发请求数
+	MaxInFlight int
+}
+
+// DefaultLimits 未配置限流时的默认值：突发 10 个请求，每秒补充 1 个，最多 4 个并发
+var DefaultLimits = Limits{RequestsPerSecond: 1, Burst: 10, MaxInFlight: 4}
+
+// bucket 令牌桶
+type bucket struct {
+	capacity float64
+	rate     float64 // 每秒补充的令牌数
+	tokens   float64
+	last     time.Time
+}
+
+func newBucket(capacity, rate float64) *bucket {
+	return &bucket{capacity: capacity, rate: rate, tokens: capacity, last: time.Now()}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// delay 返回凑够 n 个令牌还需等待的时间
+func (b *bucket) delay(n float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Limiter 并发安全的限流器，同时限制请求速率、token 速率与并发数
+type Limiter struct {
+	mu       sync.Mutex
+	requests *bucket
+	tokens   *bucket
+	inFlight chan struct{}
+}
+
+// NewLimiter 创建限流器
+func NewLimiter(limits Limits) *Limiter {
+	l := &Limiter{}
+	if limits.RequestsPerSecond > 0 {
+		burst := limits.Burst
+		if burst <= 0 {
+			burst = 1
+		}
+		l.requests = newBucket(float64(burst), limits.RequestsPerSecond)
+	}
+	if limits.TokensPerMinute > 0 {
+		l.tokens = newBucket(float64(limits.TokensPerMinute), float64(limits.TokensPerMinute)/60)
+	}
+	if limits.MaxInFlight > 0 {
+		l.inFlight = make(chan struct{}, limits.MaxInFlight)
+	}
+	return l
+}
+
+// Wait 阻塞直到允许发起一次预计消耗 tokens 的请求，返回的 release 需在请求结束后调用
+func (l *Limiter) Wait(ctx context.Context, tokens int) (release func(), err error) {
+	release = func() {}
+	if l.inFlight != nil {
+		select {
+		case l.inFlight <- struct{}{}:
+			release = sync.OnceFunc(func() { <-l.inFlight })
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	for {
+		wait := l.reserve(float64(tokens))
+		if wait == 0 {
+			return release, nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			release()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// reserve 令牌充足时扣减并返回 0，否则返回需要等待的时间
+func (l *Limiter) reserve(tokens float64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	if l.requests != nil {
+		l.requests.refill(now)
+		wait = max(wait, l.requests.delay(1))
+	}
+	if l.tokens != nil {
+		// 单次请求超过桶容量时按容量计，避免永久阻塞
+		tokens = math.Min(tokens, l.tokens.capacity)
+		l.tokens.refill(now)
+		wait = max(wait, l.tokens.delay(tokens))
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	if l.requests != nil {
+		l.requests.tokens--
+	}
+	if l.tokens != nil {
+		l.tokens.tokens -= tokens
+	}
+	return 0
+}
+
+// Limited 带限流的服务提供方，限流器随实例共享给所有使用它的 Agent
+type Limited struct {
+	Provider
+	limiter *Limiter
+}
+
+// NewLimited 为服务提供方加上限流
+func NewLimited(p Provider, limits Limits) *Limited {
+	return &Limited{Provider: p, limiter: NewLimiter(limits)}
+}
+
+// Limiter 返回底层限流器
+func (l *Limited) Limiter() *Limiter {
+	return l.limiter
+}
+
+// Chat 等待限流器放行后再发起请求
+func (l *Limited) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	release, err := l.limiter.Wait(ctx, EstimateTokens(req))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return l.Provider.Chat(ctx, req)
+}
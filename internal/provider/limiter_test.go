@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor 在 timeout 内等待限流器放行，超时返回 context.DeadlineExceeded
+func waitFor(l *Limiter, tokens int, timeout time.Duration) (func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return l.Wait(ctx, tokens)
+}
+
+func TestLimiterConcurrentWait(t *testing.T) {
+	// 几乎不补充令牌，只有突发额度内的请求能放行
+	l := NewLimiter(Limits{RequestsPerSecond: 0.001, Burst: 5})
+
+	var wg sync.WaitGroup
+	var allowed, blocked atomic.Int32
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := waitFor(l, 0, 50*time.Millisecond)
+			if err != nil {
+				blocked.Add(1)
+				return
+			}
+			allowed.Add(1)
+			release()
+		}()
+	}
+	wg.Wait()
+
+	if allowed.Load() != 5 || blocked.Load() != 15 {
+		t.Errorf("allowed = %d, blocked = %d, want 5 and 15", allowed.Load(), blocked.Load())
+	}
+}
+
+func TestLimiterMaxInFlight(t *testing.T) {
+	l := NewLimiter(Limits{MaxInFlight: 2})
+
+	first, err := waitFor(l, 0, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := waitFor(l, 0, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := waitFor(l, 0, 20*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("third request err = %v, want blocked", err)
+	}
+
+	// release 可重复调用，只归还一次
+	first()
+	first()
+	if _, err := waitFor(l, 0, time.Second); err != nil {
+		t.Fatalf("request after release: %v", err)
+	}
+	if len(l.inFlight) != 2 {
+		t.Errorf("in flight = %d, want 2", len(l.inFlight))
+	}
+}
+
+func TestLimiterCancelWhileBlocked(t *testing.T) {
+	l := NewLimiter(Limits{RequestsPerSecond: 0.001, Burst: 1, MaxInFlight: 2})
+	if _, err := waitFor(l, 0, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := l.Wait(ctx, 0)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("err = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after cancel")
+	}
+	// 取消的请求归还并发名额
+	if len(l.inFlight) != 1 {
+		t.Errorf("in flight = %d, want 1", len(l.inFlight))
+	}
+}
+
+func TestLimiterTokensPerMinute(t *testing.T) {
+	// 每秒补充 10 个 token
+	l := NewLimiter(Limits{TokensPerMinute: 600})
+
+	if _, err := waitFor(l, 500, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	// 剩余 100 个，还差 100 个需要等待约 10 秒
+	if _, err := waitFor(l, 200, 50*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want blocked by token budget", err)
+	}
+	if _, err := waitFor(l, 90, time.Second); err != nil {
+		t.Fatalf("request within budget: %v", err)
+	}
+
+	// 超过桶容量的请求按容量计，等额度补满后放行而不是永久阻塞
+	big := NewLimiter(Limits{TokensPerMinute: 600})
+	if _, err := waitFor(big, 10000, time.Second); err != nil {
+		t.Errorf("oversized request: %v", err)
+	}
+}
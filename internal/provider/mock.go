@@ -0,0 +1,180 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"learn/internal/util"
+)
+
+// MockResponse 模拟服务的一次脚本化响应
+type MockResponse struct {
+	Content   string
+	ToolCalls []ToolCall
+	// RawToolCalls 回传给模型的原始工具调用，为空时按 OpenAI 格式由 ToolCalls 生成
+	RawToolCalls json.RawMessage
+	// Chunks 流式分段，请求设置了 OnDelta 时逐段回调；Content 为空时取分段拼接结果
+	// 与 Err 或 StatusCode 同时设置时先输出分段再返回错误，模拟流式输出中途断开
+	Chunks []string
+	// Delay 返回前的等待时间，可用于模拟超时
+	Delay time.Duration
+	// StatusCode 不小于 400 时返回对应分类的 HTTP 错误
+	StatusCode int
+	// RetryAfter 与 StatusCode 配合模拟 Retry-After 响应头
+	RetryAfter string
+	// Err 直接返回该错误
+	Err error
+	// Usage 模拟的 token 用量
+	Usage Usage
+}
+
+// Mock 可编排的模拟服务，按调用顺序返回脚本化响应并记录每次请求
+type Mock struct {
+	name string
+
+	mu     sync.Mutex
+	script []MockResponse
+	calls  []*ChatRequest
+}
+
+// NewMock 创建模拟服务
+func NewMock(responses ...MockResponse) *Mock {
+	return &Mock{name: "mock", script: responses}
+}
+
+// Reply 追加一条仅包含内容的响应
+func (m *Mock) Reply(content string) *Mock {
+	return m.Push(MockResponse{Content: content})
+}
+
+// Push 追加脚本化响应
+func (m *Mock) Push(responses ...MockResponse) *Mock {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.script = append(m.script, responses...)
+	return m
+}
+
+func (m *Mock) Name() string {
+	return m.name
+}
+
+// Chat 记录请求并返回下一条脚本化响应
+func (m *Mock) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	m.mu.Lock()
+	index := len(m.calls)
+	recorded := *req
+	recorded.Messages = append([]util.PromptType(nil), req.Messages...)
+	m.calls = append(m.calls, &recorded)
+	if len(m.script) == 0 {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("mock: no scripted response for call %d", index)
+	}
+	script := m.script[0]
+	m.script = m.script[1:]
+	m.mu.Unlock()
+
+	if script.Delay > 0 {
+		timer := time.NewTimer(script.Delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, transportError(m.name, ctx.Err())
+		}
+	}
+
+	if req.OnDelta != nil {
+		for _, chunk := range script.Chunks {
+			req.OnDelta(chunk)
+		}
+	}
+
+	if script.Err != nil {
+		return nil, script.Err
+	}
+	if script.StatusCode >= 400 {
+		return nil, statusError(m.name, script.StatusCode, script.Content, script.RetryAfter)
+	}
+
+	content := script.Content
+	if content == "" {
+		content = strings.Join(script.Chunks, "")
+	}
+
+	raw := script.RawToolCalls
+	if raw == nil && len(script.ToolCalls) > 0 {
+		var err error
+		if raw, err = rawToolCalls(script.ToolCalls); err != nil {
+			return nil, fmt.Errorf("mock: %w", err)
+		}
+	}
+
+	return &ChatResponse{
+		Content:      content,
+		ToolCalls:    script.ToolCalls,
+		RawToolCalls: raw,
+		Usage:        script.Usage,
+		Provider:     m.name,
+		StatusCode:   200,
+	}, nil
+}
+
+// rawToolCalls 按 OpenAI 格式序列化工具调用，参数为 JSON 字符串
+func rawToolCalls(calls []ToolCall) (json.RawMessage, error) {
+	type function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	}
+	type toolCall struct {
+		ID       string   `json:"id,omitempty"`
+		Type     string   `json:"type"`
+		Function function `json:"function"`
+	}
+
+	out := make([]toolCall, len(calls))
+	for i, call := range calls {
+		args, err := json.Marshal(call.Params)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = toolCall{ID: call.ID, Type: "function", Function: function{Name: call.ToolName, Arguments: string(args)}}
+	}
+	return json.Marshal(out)
+}
+
+// Calls 返回已记录的全部请求
+func (m *Mock) Calls() []*ChatRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*ChatRequest(nil), m.calls...)
+}
+
+// Call 返回第 i 次请求，不存在时返回 nil
+func (m *Mock) Call(i int) *ChatRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i < 0 || i >= len(m.calls) {
+		return nil
+	}
+	return m.calls[i]
+}
+
+// Messages 返回第 i 次请求发送的消息
+func (m *Mock) Messages(i int) []util.PromptType {
+	if call := m.Call(i); call != nil {
+		return call.Messages
+	}
+	return nil
+}
+
+// Remaining 返回尚未消费的脚本条数
+func (m *Mock) Remaining() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.script)
+}
@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMockScript(t *testing.T) {
+	ctx := context.Background()
+	mock := NewMock(
+		MockResponse{StatusCode: 429, RetryAfter: "2"},
+		MockResponse{Chunks: []string{"你", "好"}, Usage: Usage{PromptTokens: 3, CompletionTokens: 2}},
+	).Reply("再见")
+
+	_, err := mock.Chat(ctx, chatRequest("第一次"))
+	var pe *Error
+	if !errors.As(err, &pe) || pe.Class != ClassRateLimited || pe.RetryAfter != 2*time.Second {
+		t.Fatalf("err = %v, want rate limited with Retry-After", err)
+	}
+
+	var streamed strings.Builder
+	req := chatRequest("第二次")
+	req.OnDelta = func(delta string) { streamed.WriteString(delta) }
+	resp, err := mock.Chat(ctx, req)
+	if err != nil || resp.Content != "你好" || streamed.String() != "你好" || resp.Usage.CompletionTokens != 2 {
+		t.Fatalf("resp = %+v, streamed = %q, err = %v", resp, streamed.String(), err)
+	}
+
+	if resp, err := mock.Chat(ctx, chatRequest("第三次")); err != nil || resp.Content != "再见" {
+		t.Fatalf("resp = %+v, err = %v", resp, err)
+	}
+	if _, err := mock.Chat(ctx, chatRequest("第四次")); err == nil {
+		t.Error("expected error after the script is exhausted")
+	}
+
+	if len(mock.Calls()) != 4 || mock.Remaining() != 0 {
+		t.Errorf("calls = %d, remaining = %d", len(mock.Calls()), mock.Remaining())
+	}
+	if got := mock.Messages(1)[0].Content; got != "第二次" {
+		t.Errorf("messages(1) = %q", got)
+	}
+	if mock.Call(4) != nil || mock.Messages(-1) != nil {
+		t.Error("out of range call should be nil")
+	}
+}
+
+func TestMockRawToolCalls(t *testing.T) {
+	mock := NewMock(MockResponse{ToolCalls: []ToolCall{{ID: "call_1", ToolName: "search", Params: map[string]any{"query": "天气"}}}})
+
+	resp, err := mock.Chat(context.Background(), chatRequest("查天气"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"id":"call_1","type":"function","function":{"name":"search","arguments":"{\"query\":\"天气\"}"}}]`
+	if string(resp.RawToolCalls) != want {
+		t.Errorf("RawToolCalls = %s, want %s", resp.RawToolCalls, want)
+	}
+}
+
+func TestMockDelayCanceled(t *testing.T) {
+	mock := NewMock(MockResponse{Content: "慢", Delay: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := mock.Chat(ctx, chatRequest("hi")); Classify(err) != ClassCanceled {
+		t.Errorf("err = %v, want canceled", err)
+	}
+}
@@ -0,0 +1,150 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"learn/internal/trace"
+
+	"github.com/tidwall/gjson"
+	"resty.dev/v3"
+)
+
+// Ollama 本地 Ollama 服务
+type Ollama struct {
+	name   string
+	client *resty.Client
+}
+
+// NewOllama 创建 Ollama 服务提供方
+func NewOllama(name, baseURL string) *Ollama {
+	client := resty.New()
+	client.SetBaseURL(baseURL).
+		SetTimeout(120*time.Second).
+		SetHeader("Content-Type", "application/json")
+
+	return &Ollama{name: name, client: client}
+}
+
+// SetHeaders 设置每个请求附带的请求头，如网关要求的鉴权头
+func (o *Ollama) SetHeaders(headers map[string]string) *Ollama {
+	o.client.SetHeaders(headers)
+	return o
+}
+
+// SetTimeout 设置单次请求的超时，流式响应从发出请求到读完为止
+func (o *Ollama) SetTimeout(timeout time.Duration) *Ollama {
+	o.client.SetTimeout(timeout)
+	return o
+}
+
+// SetTLSConfig 设置 TLS 配置，用于自签名证书或双向认证
+func (o *Ollama) SetTLSConfig(config *tls.Config) *Ollama {
+	o.client.SetTLSClientConfig(config)
+	return o
+}
+
+func (o *Ollama) Name() string {
+	return o.name
+}
+
+// Chat 调用 /api/chat，设置了 OnDelta 时使用流式响应
+func (o *Ollama) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	stream := req.OnDelta != nil
+	body := map[string]any{
+		"model":    req.Model,
+		"messages": req.Messages,
+		"stream":   stream,
+	}
+	if len(req.Tools) > 0 {
+		body["tools"] = req.Tools
+	}
+	if len(req.Options) > 0 {
+		body["options"] = req.Options
+	}
+	if req.Format != "" {
+		body["format"] = req.Format
+	}
+
+	ctx, span := trace.Start(ctx, "http.request")
+	span.Set("provider", o.name).Set("http.method", "POST").Set("http.path", "/api/chat")
+	res, err := o.client.R().SetContext(ctx).SetBody(body).SetDoNotParseResponse(stream).Post("/api/chat")
+	if err != nil {
+		err = transportError(o.name, err)
+		span.Finish(err)
+		return nil, err
+	}
+	span.Set("http.status_code", res.StatusCode())
+	if stream {
+		defer res.Body.Close()
+		if res.IsError() {
+			err = streamHTTPError(o.name, res)
+			span.Finish(err)
+			return nil, err
+		}
+		resp, err := readOllamaStream(o.name, res.Body, req.OnDelta)
+		span.Finish(err)
+		if err != nil {
+			return nil, err
+		}
+		resp.StatusCode = res.StatusCode()
+		return resp, nil
+	}
+	if res.IsError() {
+		err = httpError(o.name, res)
+		span.Finish(err)
+		return nil, err
+	}
+	span.Finish(nil)
+
+	raw := res.Bytes()
+	if !gjson.ValidBytes(raw) {
+		return nil, invalidJSONError(o.name, fmt.Errorf("invalid response body: %.200s", raw))
+	}
+	toolCalls := gjson.GetBytes(raw, "message.tool_calls")
+	calls, err := parseToolCalls(toolCalls)
+	if err != nil {
+		return nil, invalidJSONError(o.name, err)
+	}
+
+	return &ChatResponse{
+		Content: gjson.GetBytes(raw, "message.content").String(),
+		Usage: Usage{
+			PromptTokens:     int(gjson.GetBytes(raw, "prompt_eval_count").Int()),
+			CompletionTokens: int(gjson.GetBytes(raw, "eval_count").Int()),
+		},
+		ToolCalls:    calls,
+		RawToolCalls: rawJSON(toolCalls.Raw),
+		Provider:     o.name,
+		StatusCode:   res.StatusCode(),
+		Raw:          raw,
+	}, nil
+}
+
+// Embedder 返回使用指定向量模型的 Embedder，调用 /api/embed
+func (o *Ollama) Embedder(model string) Embedder {
+	return EmbedFunc(func(ctx context.Context, text string) ([]float64, error) {
+		res, err := o.client.R().
+			SetContext(ctx).
+			SetBody(map[string]any{"model": model, "input": text}).
+			Post("/api/embed")
+		if err != nil {
+			return nil, transportError(o.name, err)
+		}
+		if res.IsError() {
+			return nil, httpError(o.name, res)
+		}
+
+		var embedding []float64
+		gjson.GetBytes(res.Bytes(), "embeddings.0").ForEach(func(_, v gjson.Result) bool {
+			embedding = append(embedding, v.Float())
+			return true
+		})
+		if len(embedding) == 0 {
+			return nil, emptyContentError(o.name)
+		}
+		return embedding, nil
+	})
+}
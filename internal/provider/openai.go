@@ -0,0 +1,140 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"learn/internal/trace"
+
+	"github.com/tidwall/gjson"
+	"resty.dev/v3"
+)
+
+// OpenAI OpenAI 兼容的对话服务（OpenAI、DashScope 兼容模式等）
+type OpenAI struct {
+	name   string
+	path   string
+	client *resty.Client
+}
+
+// NewOpenAI 创建 OpenAI 兼容服务提供方
+func NewOpenAI(name, baseURL, apiKey string) *OpenAI {
+	client := resty.New()
+	client.SetBaseURL(baseURL).
+		SetTimeout(300*time.Second).
+		SetHeader("Content-Type", "application/json").
+		SetHeader("Accept", "application/json").
+		SetHeader("Authorization", "Bearer "+apiKey)
+
+	return &OpenAI{name: name, path: "/v1/chat/completions", client: client}
+}
+
+// SetPath 设置对话接口路径，默认 /v1/chat/completions
+func (o *OpenAI) SetPath(path string) *OpenAI {
+	o.path = path
+	return o
+}
+
+// SetHeaders 设置每个请求附带的请求头，如网关要求的鉴权头
+func (o *OpenAI) SetHeaders(headers map[string]string) *OpenAI {
+	o.client.SetHeaders(headers)
+	return o
+}
+
+// SetTimeout 设置单次请求的超时，流式响应从发出请求到读完为止
+func (o *OpenAI) SetTimeout(timeout time.Duration) *OpenAI {
+	o.client.SetTimeout(timeout)
+	return o
+}
+
+// SetTLSConfig 设置 TLS 配置，用于自签名证书或双向认证
+func (o *OpenAI) SetTLSConfig(config *tls.Config) *OpenAI {
+	o.client.SetTLSClientConfig(config)
+	return o
+}
+
+func (o *OpenAI) Name() string {
+	return o.name
+}
+
+// Chat 调用 chat/completions，设置了 OnDelta 时使用流式响应
+// 工具调用在流式响应中是分段返回的，带工具的请求不使用流式
+func (o *OpenAI) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	stream := req.OnDelta != nil && len(req.Tools) == 0
+	body := map[string]any{
+		"model":    req.Model,
+		"messages": req.Messages,
+		"stream":   stream,
+	}
+	if stream {
+		body["stream_options"] = map[string]any{"include_usage": true}
+	}
+	if len(req.Tools) > 0 {
+		body["tools"] = req.Tools
+	}
+	if req.EnableSearch {
+		body["enable_search"] = true
+	}
+	if req.Format == "json" {
+		body["response_format"] = map[string]any{"type": "json_object"}
+	}
+	for k, v := range req.Options {
+		body[k] = v
+	}
+
+	ctx, span := trace.Start(ctx, "http.request")
+	span.Set("provider", o.name).Set("http.method", "POST").Set("http.path", o.path)
+	res, err := o.client.R().SetContext(ctx).SetBody(body).SetDoNotParseResponse(stream).Post(o.path)
+	if err != nil {
+		err = transportError(o.name, err)
+		span.Finish(err)
+		return nil, err
+	}
+	span.Set("http.status_code", res.StatusCode())
+	if stream {
+		defer res.Body.Close()
+		if res.IsError() {
+			err = streamHTTPError(o.name, res)
+			span.Finish(err)
+			return nil, err
+		}
+		resp, err := readOpenAIStream(o.name, res.Body, req.OnDelta)
+		span.Finish(err)
+		if err != nil {
+			return nil, err
+		}
+		resp.StatusCode = res.StatusCode()
+		return resp, nil
+	}
+	if res.IsError() {
+		err = httpError(o.name, res)
+		span.Finish(err)
+		return nil, err
+	}
+	span.Finish(nil)
+
+	raw := res.Bytes()
+	if !gjson.ValidBytes(raw) {
+		return nil, invalidJSONError(o.name, fmt.Errorf("invalid response body: %.200s", raw))
+	}
+	toolCalls := gjson.GetBytes(raw, "choices.0.message.tool_calls")
+	calls, err := parseToolCalls(toolCalls)
+	if err != nil {
+		return nil, invalidJSONError(o.name, err)
+	}
+
+	return &ChatResponse{
+		Content: gjson.GetBytes(raw, "choices.0.message.content").String(),
+		Usage: Usage{
+			PromptTokens:     int(gjson.GetBytes(raw, "usage.prompt_tokens").Int()),
+			CompletionTokens: int(gjson.GetBytes(raw, "usage.completion_tokens").Int()),
+		},
+		ToolCalls:    calls,
+		RawToolCalls: rawJSON(toolCalls.Raw),
+		Provider:     o.name,
+		StatusCode:   res.StatusCode(),
+		Raw:          raw,
+	}, nil
+}
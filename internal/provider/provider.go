@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"learn/internal/util"
+
+	"github.com/tidwall/gjson"
+)
+
+// ErrEmptyContent 模型返回空内容
+var ErrEmptyContent = errors.New("empty content from provider")
+
+// ChatRequest 对话请求，与具体服务商的请求格式无关
+type ChatRequest struct {
+	Model    string            `json:"model"`
+	Messages []util.PromptType `json:"messages"`
+	Tools    []map[string]any  `json:"tools,omitempty"`
+	// Options 生成参数，如 temperature、top_p
+	Options map[string]any `json:"options,omitempty"`
+	// EnableSearch 透传给支持服务端搜索的服务商
+	EnableSearch bool `json:"enable_search,omitempty"`
+	// Format 为 json 时使用服务端的 JSON 模式（Ollama 的 format，OpenAI 的 response_format）
+	Format string `json:"format,omitempty"`
+	// OnDelta 流式输出回调，支持流式的服务商在生成过程中逐段调用
+	OnDelta func(delta string) `json:"-"`
+}
+
+// ChatResponse 对话响应
+type ChatResponse struct {
+	Content   string     `json:"content"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// Model 实际使用的模型，请求中的模型为别名时由 Aliases 设置为解析后的模型
+	Model string `json:"model,omitempty"`
+	// RawToolCalls 服务商返回的原始工具调用，回传给模型时使用
+	RawToolCalls json.RawMessage `json:"raw_tool_calls,omitempty"`
+	Provider     string          `json:"provider"`
+	StatusCode   int             `json:"status_code"`
+	Raw          json.RawMessage `json:"raw,omitempty"`
+	Usage        Usage           `json:"usage"`
+	// Cached 是否来自缓存
+	Cached bool `json:"cached,omitempty"`
+}
+
+// Usage 单次响应的 token 用量
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// ToolCall 工具调用信息
+type ToolCall struct {
+	ID       string                 `json:"id,omitempty"`
+	ToolName string                 `json:"tool_name"`
+	Params   map[string]interface{} `json:"params"`
+}
+
+// Provider 模型服务提供方
+type Provider interface {
+	Name() string
+	Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error)
+}
+
+// EstimateTokens 粗略估算请求的 token 数：ASCII 约 4 字节一个 token，其余字符按 1 个计
+func EstimateTokens(req *ChatRequest) int {
+	tokens := 0
+	for _, msg := range req.Messages {
+		ascii, other := 0, 0
+		for _, r := range msg.Content {
+			if r < utf8.RuneSelf {
+				ascii++
+			} else {
+				other++
+			}
+		}
+		tokens += ascii/4 + other + 4
+	}
+	return tokens
+}
+
+// rawJSON 空字符串转换为 nil，避免序列化出非法 JSON
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	return json.RawMessage(s)
+}
+
+// isEmpty 响应既无内容也无工具调用
+func isEmpty(resp *ChatResponse) bool {
+	return resp.Content == "" && len(resp.ToolCalls) == 0
+}
+
+// parseToolCalls 解析消息中的工具调用，Ollama 的参数为对象，OpenAI 为 JSON 字符串
+func parseToolCalls(raw gjson.Result) ([]ToolCall, error) {
+	if !raw.IsArray() {
+		return nil, nil
+	}
+
+	var calls []ToolCall
+	var err error
+	raw.ForEach(func(_, item gjson.Result) bool {
+		call := ToolCall{
+			ID:       item.Get("id").String(),
+			ToolName: item.Get("function.name").String(),
+		}
+		args := item.Get("function.arguments")
+		argsJSON := args.Raw
+		if args.Type == gjson.String {
+			argsJSON = args.Str
+		}
+		if argsJSON != "" {
+			if err = json.Unmarshal([]byte(argsJSON), &call.Params); err != nil {
+				err = fmt.Errorf("invalid arguments for tool %s: %w", call.ToolName, err)
+				return false
+			}
+		}
+		calls = append(calls, call)
+		return true
+	})
+	return calls, err
+}
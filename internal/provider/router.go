@@ -0,0 +1,247 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Strategy 路由器在成员之间的选择策略
+type Strategy int
+
+const (
+	// StrategyFallback 按添加顺序依次尝试，出错时切换到下一个
+	StrategyFallback Strategy = iota
+	// StrategyRoundRobin 按权重轮询选择起点，出错时依次尝试其余成员
+	StrategyRoundRobin
+)
+
+// Rule 路由规则，命中时请求交给 Target 处理
+type Rule struct {
+	Name   string
+	Match  func(req *ChatRequest) bool
+	Target Provider
+}
+
+// ModelPrefixRule 按模型名前缀路由
+func ModelPrefixRule(prefix string, target Provider) Rule {
+	return Rule{
+		Name: "model:" + prefix,
+		Match: func(req *ChatRequest) bool {
+			return strings.HasPrefix(req.Model, prefix)
+		},
+		Target: target,
+	}
+}
+
+// PromptSizeRule 估算的提示词 token 数不少于 minTokens 时路由
+func PromptSizeRule(minTokens int, target Provider) Rule {
+	return Rule{
+		Name: fmt.Sprintf("prompt>=%d", minTokens),
+		Match: func(req *ChatRequest) bool {
+			return EstimateTokens(req) >= minTokens
+		},
+		Target: target,
+	}
+}
+
+// member 路由成员及其健康状态
+type member struct {
+	provider Provider
+	weight   int
+	current  int // 平滑加权轮询的当前权重
+
+	failures     int
+	ejectedUntil time.Time
+}
+
+// Router 组合多个服务提供方，支持规则路由、顺序降级、加权轮询与故障摘除
+// Router 本身也是 Provider，可作为规则的目标嵌套使用
+type Router struct {
+	name     string
+	strategy Strategy
+	rules    []Rule
+	members  []*member
+
+	// maxFailures 连续失败多少次后摘除，cooldown 为摘除时长
+	maxFailures int
+	cooldown    time.Duration
+
+	mu sync.Mutex
+}
+
+// RouterOption 定义 Router 选项函数类型
+type RouterOption func(*Router)
+
+// WithStrategy 设置成员选择策略
+func WithStrategy(strategy Strategy) RouterOption {
+	return func(r *Router) {
+		r.strategy = strategy
+	}
+}
+
+// WithRule 添加路由规则，按添加顺序匹配
+func WithRule(rule Rule) RouterOption {
+	return func(r *Router) {
+		r.rules = append(r.rules, rule)
+	}
+}
+
+// WithMember 添加成员，weight 仅在轮询策略下生效
+func WithMember(p Provider, weight int) RouterOption {
+	return func(r *Router) {
+		if weight <= 0 {
+			weight = 1
+		}
+		r.members = append(r.members, &member{provider: p, weight: weight})
+	}
+}
+
+// WithEjection 设置故障摘除参数
+func WithEjection(maxFailures int, cooldown time.Duration) RouterOption {
+	return func(r *Router) {
+		r.maxFailures = maxFailures
+		r.cooldown = cooldown
+	}
+}
+
+// NewRouter 创建路由服务提供方
+func NewRouter(name string, opts ...RouterOption) *Router {
+	r := &Router{
+		name:        name,
+		maxFailures: 3,
+		cooldown:    30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// NewFallback 创建按顺序降级的路由
+func NewFallback(name string, providers ...Provider) *Router {
+	r := NewRouter(name)
+	for _, p := range providers {
+		WithMember(p, 1)(r)
+	}
+	return r
+}
+
+func (r *Router) Name() string {
+	return r.name
+}
+
+// Chat 按规则或策略选择成员处理请求
+func (r *Router) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	for _, rule := range r.rules {
+		if rule.Match(req) {
+			return rule.Target.Chat(ctx, req)
+		}
+	}
+
+	candidates := r.candidates()
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%s: no provider available", r.name)
+	}
+
+	var errs []error
+	for _, m := range candidates {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		attempt, streamed := withStreamCheck(req)
+		resp, err := m.provider.Chat(ctx, attempt)
+		if err == nil && isEmpty(resp) {
+			err = emptyContentError(m.provider.Name())
+		}
+		r.report(m, err)
+		if err == nil {
+			return resp, nil
+		}
+		// 已输出的分段无法撤回，切换成员会让调用方收到重复或错乱的文本
+		if *streamed {
+			return nil, &Error{
+				Provider: r.name,
+				Class:    ClassInterrupted,
+				Err:      fmt.Errorf("%s failed after streaming output, not falling back: %w", m.provider.Name(), err),
+			}
+		}
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("%s: all providers failed: %w", r.name, errors.Join(errs...))
+}
+
+// withStreamCheck 返回记录是否已输出流式分段的请求副本，未设置 OnDelta 时返回原请求
+func withStreamCheck(req *ChatRequest) (*ChatRequest, *bool) {
+	streamed := new(bool)
+	if req.OnDelta == nil {
+		return req, streamed
+	}
+	r := *req
+	r.OnDelta = func(delta string) {
+		*streamed = true
+		req.OnDelta(delta)
+	}
+	return &r, streamed
+}
+
+// candidates 返回本次请求的尝试顺序，被摘除的成员排在最后
+func (r *Router) candidates() []*member {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	var healthy, ejected []*member
+	for _, m := range r.members {
+		if now.Before(m.ejectedUntil) {
+			ejected = append(ejected, m)
+		} else {
+			healthy = append(healthy, m)
+		}
+	}
+
+	if r.strategy == StrategyRoundRobin && len(healthy) > 1 {
+		start := r.pickWeighted(healthy)
+		healthy = append(healthy[start:len(healthy):len(healthy)], healthy[:start]...)
+	}
+	return append(healthy, ejected...)
+}
+
+// pickWeighted 平滑加权轮询，返回选中成员的下标
+func (r *Router) pickWeighted(members []*member) int {
+	total, best := 0, 0
+	for i, m := range members {
+		m.current += m.weight
+		total += m.weight
+		if m.current > members[best].current {
+			best = i
+		}
+	}
+	members[best].current -= total
+	return best
+}
+
+// report 记录调用结果，连续失败达到阈值后摘除成员
+func (r *Router) report(m *member, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err == nil {
+		m.failures = 0
+		return
+	}
+	// 调用方取消不计入成员健康状态
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	m.failures++
+	if r.maxFailures > 0 && m.failures >= r.maxFailures {
+		m.ejectedUntil = time.Now().Add(r.cooldown)
+		m.failures = 0
+	}
+}
@@ -0,0 +1,72 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// partialStream 输出一段内容后失败，模拟流式响应中途断开
+type partialStream struct{}
+
+func (partialStream) Name() string {
+	return "partial"
+}
+
+func (partialStream) Chat(_ context.Context, req *ChatRequest) (*ChatResponse, error) {
+	if req.OnDelta != nil {
+		req.OnDelta("<html>")
+	}
+	return nil, &Error{Provider: "partial", Class: ClassTransport, Err: errors.New("connection reset")}
+}
+
+func TestRouterFallback(t *testing.T) {
+	primary := NewMock(MockResponse{StatusCode: 503})
+	backup := NewMock().Reply("ok")
+	r := NewFallback("router", primary, backup)
+
+	resp, err := r.Chat(context.Background(), &ChatRequest{Model: "m"})
+	if err != nil || resp.Content != "ok" {
+		t.Fatalf("resp = %+v, err = %v", resp, err)
+	}
+	if len(primary.Calls()) != 1 || len(backup.Calls()) != 1 {
+		t.Errorf("calls = %d, %d", len(primary.Calls()), len(backup.Calls()))
+	}
+}
+
+func TestRouterNoFallbackAfterStreamedOutput(t *testing.T) {
+	backup := NewMock(MockResponse{Chunks: []string{"<html>", "</html>"}})
+	r := NewFallback("router", partialStream{}, backup)
+
+	var out strings.Builder
+	_, err := r.Chat(context.Background(), &ChatRequest{Model: "m", OnDelta: func(d string) { out.WriteString(d) }})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	// 分类不在默认的重试范围内，Agent 不会重试
+	if Classify(err) != ClassInterrupted {
+		t.Errorf("class = %s, want %s", Classify(err), ClassInterrupted)
+	}
+	if len(backup.Calls()) != 0 {
+		t.Errorf("backup called %d times after partial output", len(backup.Calls()))
+	}
+	if out.String() != "<html>" {
+		t.Errorf("streamed = %q", out.String())
+	}
+}
+
+func TestRouterFallbackBeforeStreamedOutput(t *testing.T) {
+	primary := NewMock(MockResponse{StatusCode: 503})
+	backup := NewMock(MockResponse{Chunks: []string{"<html>", "</html>"}})
+	r := NewFallback("router", primary, backup)
+
+	var out strings.Builder
+	resp, err := r.Chat(context.Background(), &ChatRequest{Model: "m", OnDelta: func(d string) { out.WriteString(d) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "<html></html>" || out.String() != "<html></html>" {
+		t.Errorf("content = %q, streamed = %q", resp.Content, out.String())
+	}
+}
@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/tidwall/gjson"
+	"resty.dev/v3"
+)
+
+// 流式响应单行的最大长度
+const maxStreamLine = 1 << 20
+
+// streamHTTPError 读取未解析的错误响应并分类
+func streamHTTPError(name string, res *resty.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	return statusError(name, res.StatusCode(), string(body), res.Header().Get("Retry-After"))
+}
+
+// streamError 响应中途返回的错误，按服务端错误处理以便重试
+func streamError(name, msg string) error {
+	return &Error{Provider: name, Class: ClassServer, Body: msg, Err: errors.New(msg)}
+}
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxStreamLine)
+	return scanner
+}
+
+// readOllamaStream 读取 Ollama 逐行 JSON 的流式响应
+func readOllamaStream(name string, r io.Reader, onDelta func(string)) (*ChatResponse, error) {
+	var (
+		content   bytes.Buffer
+		toolCalls gjson.Result
+		resp      = &ChatResponse{Provider: name}
+	)
+
+	scanner := newLineScanner(r)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if !gjson.ValidBytes(line) {
+			return nil, invalidJSONError(name, fmt.Errorf("invalid stream chunk: %.200s", line))
+		}
+		if msg := gjson.GetBytes(line, "error").String(); msg != "" {
+			return nil, streamError(name, msg)
+		}
+
+		if delta := gjson.GetBytes(line, "message.content").String(); delta != "" {
+			content.WriteString(delta)
+			onDelta(delta)
+		}
+		if calls := gjson.GetBytes(line, "message.tool_calls"); calls.IsArray() {
+			toolCalls = calls
+		}
+		if gjson.GetBytes(line, "done").Bool() {
+			resp.Usage = Usage{
+				PromptTokens:     int(gjson.GetBytes(line, "prompt_eval_count").Int()),
+				CompletionTokens: int(gjson.GetBytes(line, "eval_count").Int()),
+			}
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, transportError(name, err)
+	}
+
+	calls, err := parseToolCalls(toolCalls)
+	if err != nil {
+		return nil, invalidJSONError(name, err)
+	}
+	resp.Content = content.String()
+	resp.ToolCalls = calls
+	resp.RawToolCalls = rawJSON(toolCalls.Raw)
+	return resp, nil
+}
+
+// readOpenAIStream 读取 OpenAI 兼容接口的 SSE 流式响应
+func readOpenAIStream(name string, r io.Reader, onDelta func(string)) (*ChatResponse, error) {
+	var (
+		content bytes.Buffer
+		resp    = &ChatResponse{Provider: name}
+	)
+
+	scanner := newLineScanner(r)
+	for scanner.Scan() {
+		data, ok := bytes.CutPrefix(scanner.Bytes(), []byte("data:"))
+		if !ok {
+			continue
+		}
+		data = bytes.TrimSpace(data)
+		if string(data) == "[DONE]" {
+			break
+		}
+		if !gjson.ValidBytes(data) {
+			return nil, invalidJSONError(name, fmt.Errorf("invalid stream chunk: %.200s", data))
+		}
+		if msg := gjson.GetBytes(data, "error.message").String(); msg != "" {
+			return nil, streamError(name, msg)
+		}
+
+		if delta := gjson.GetBytes(data, "choices.0.delta.content").String(); delta != "" {
+			content.WriteString(delta)
+			onDelta(delta)
+		}
+		// 开启 include_usage 后最后一段携带用量
+		if u := gjson.GetBytes(data, "usage"); u.IsObject() {
+			resp.Usage = Usage{
+				PromptTokens:     int(u.Get("prompt_tokens").Int()),
+				CompletionTokens: int(u.Get("completion_tokens").Int()),
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, transportError(name, err)
+	}
+
+	resp.Content = content.String()
+	return resp, nil
+}
@@ -0,0 +1,157 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"learn/internal/database"
+	"learn/internal/interfaces"
+)
+
+// FTSIndex 基于 SQLite FTS5 的本地全文索引
+// 注意：mattn/go-sqlite3 默认不启用 FTS5，需要使用 -tags sqlite_fts5 编译
+type FTSIndex struct {
+	db *database.SQLiteDB
+}
+
+// NewFTSIndex 打开（或创建）本地全文索引
+func NewFTSIndex(dbPath string) (*FTSIndex, error) {
+	db, err := database.NewSQLiteDB(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("打开索引失败: %w", err)
+	}
+
+	// trigram 分词对中文更友好，查询词需不少于 3 个字符
+	_, err = db.DB().Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS docs USING fts5(
+		title, url UNINDEXED, content, tokenize = 'trigram'
+	)`)
+	if err != nil {
+		db.Close()
+		if strings.Contains(err.Error(), "no such module") {
+			return nil, fmt.Errorf("sqlite3 驱动未启用 FTS5，请使用 -tags sqlite_fts5 编译: %w", err)
+		}
+		return nil, fmt.Errorf("创建索引表失败: %w", err)
+	}
+
+	return &FTSIndex{db: db}, nil
+}
+
+func (i *FTSIndex) Name() string {
+	return "fts"
+}
+
+// Close 关闭索引
+func (i *FTSIndex) Close() error {
+	return i.db.Close()
+}
+
+// Add 添加或替换一篇文档，以 url 作为唯一标识
+func (i *FTSIndex) Add(ctx context.Context, title, url, content string) error {
+	tx, err := i.db.DB().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM docs WHERE url = ?`, url); err != nil {
+		return fmt.Errorf("删除旧文档失败: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO docs (title, url, content) VALUES (?, ?, ?)`, title, url, content); err != nil {
+		return fmt.Errorf("写入文档失败: %w", err)
+	}
+	return tx.Commit()
+}
+
+// IndexDir 递归索引目录下指定扩展名的文件，默认索引 .md 和 .txt
+func (i *FTSIndex) IndexDir(ctx context.Context, dir string, exts ...string) (int, error) {
+	if len(exts) == 0 {
+		exts = []string{".md", ".txt"}
+	}
+
+	count := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if !hasExt(path, exts) {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		title := strings.TrimSuffix(d.Name(), filepath.Ext(d.Name()))
+		if err := i.Add(ctx, title, path, string(data)); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// Search 实现 interfaces.ISearchProvider
+func (i *FTSIndex) Search(ctx context.Context, query string, limit int) ([]interfaces.SearchResult, error) {
+	match := buildMatchQuery(query)
+	if match == "" {
+		return nil, nil
+	}
+	if limit <= 0 {
+		limit = 5
+	}
+
+	rows, err := i.db.DB().QueryContext(ctx, `
+		SELECT title, url, snippet(docs, 2, '', '', '...', 64), bm25(docs)
+		FROM docs WHERE docs MATCH ? ORDER BY bm25(docs) LIMIT ?`, match, limit)
+	if err != nil {
+		return nil, fmt.Errorf("全文检索失败: %w", err)
+	}
+	defer rows.Close()
+
+	return scanResults(rows)
+}
+
+func scanResults(rows *sql.Rows) ([]interfaces.SearchResult, error) {
+	var results []interfaces.SearchResult
+	for rows.Next() {
+		var r interfaces.SearchResult
+		if err := rows.Scan(&r.Title, &r.URL, &r.Content, &r.Score); err != nil {
+			return nil, err
+		}
+		// bm25 越小越相关，取反便于调用方按分数降序理解
+		r.Score = -r.Score
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// buildMatchQuery 将自然语言查询转换为 FTS5 表达式，每个词作为短语并以 OR 连接
+func buildMatchQuery(query string) string {
+	var terms []string
+	for _, f := range strings.Fields(query) {
+		f = strings.ReplaceAll(f, `"`, "")
+		// trigram 分词无法匹配不足 3 个字符的词
+		if utf8.RuneCountInString(f) < 3 {
+			continue
+		}
+		terms = append(terms, `"`+f+`"`)
+	}
+	return strings.Join(terms, " OR ")
+}
+
+func hasExt(path string, exts []string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range exts {
+		if ext == strings.ToLower(e) {
+			return true
+		}
+	}
+	return false
+}
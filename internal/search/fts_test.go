@@ -0,0 +1,49 @@
+//go:build sqlite_fts5
+
+package search
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFTSIndex(t *testing.T) {
+	ctx := context.Background()
+	index, err := NewFTSIndex(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"login.md":  "登录页面需要用户名和密码表单",
+		"todo.txt":  "待办清单支持添加和删除",
+		"skip.html": "登录页面",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := index.IndexDir(ctx, dir); err != nil || n != 2 {
+		t.Fatalf("indexed %d files, err = %v", n, err)
+	}
+	// 重复索引按 url 替换，不会产生重复结果
+	if _, err := index.IndexDir(ctx, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := index.Search(ctx, "登录页面 表单", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Title != "login" {
+		t.Errorf("results = %+v", results)
+	}
+	if results, _ := index.Search(ctx, "登录", 5); results != nil {
+		t.Errorf("short query results = %+v, want none", results)
+	}
+}
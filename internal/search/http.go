@@ -0,0 +1,133 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"learn/internal/interfaces"
+
+	"github.com/tidwall/gjson"
+	"resty.dev/v3"
+)
+
+// HTTPSearcher 通用 HTTP JSON 搜索适配器
+// 通过 GET 请求调用搜索服务，并用 gjson 路径从响应中提取结果
+type HTTPSearcher struct {
+	client       *resty.Client
+	endpoint     string
+	queryParam   string
+	limitParam   string
+	resultsPath  string
+	titleField   string
+	urlField     string
+	contentField string
+}
+
+// HTTPOption 定义 HTTPSearcher 选项函数类型
+type HTTPOption func(*HTTPSearcher)
+
+// WithQueryParam 设置查询参数名，默认 q
+func WithQueryParam(name string) HTTPOption {
+	return func(s *HTTPSearcher) {
+		s.queryParam = name
+	}
+}
+
+// WithLimitParam 设置条数参数名，默认 limit，为空则不传
+func WithLimitParam(name string) HTTPOption {
+	return func(s *HTTPSearcher) {
+		s.limitParam = name
+	}
+}
+
+// WithResultsPath 设置结果数组的 gjson 路径，默认 results
+func WithResultsPath(path string) HTTPOption {
+	return func(s *HTTPSearcher) {
+		s.resultsPath = path
+	}
+}
+
+// WithFields 设置单条结果中标题、链接、内容字段的 gjson 路径
+func WithFields(title, url, content string) HTTPOption {
+	return func(s *HTTPSearcher) {
+		s.titleField = title
+		s.urlField = url
+		s.contentField = content
+	}
+}
+
+// WithHeader 设置请求头，如鉴权信息
+func WithHeader(key, value string) HTTPOption {
+	return func(s *HTTPSearcher) {
+		s.client.SetHeader(key, value)
+	}
+}
+
+// WithTimeout 设置请求超时
+func WithTimeout(timeout time.Duration) HTTPOption {
+	return func(s *HTTPSearcher) {
+		s.client.SetTimeout(timeout)
+	}
+}
+
+// NewHTTPSearcher 创建 HTTP 搜索适配器
+func NewHTTPSearcher(endpoint string, opts ...HTTPOption) *HTTPSearcher {
+	client := resty.New()
+	client.SetTimeout(30*time.Second).
+		SetHeader("Accept", "application/json")
+
+	s := &HTTPSearcher{
+		client:       client,
+		endpoint:     endpoint,
+		queryParam:   "q",
+		limitParam:   "limit",
+		resultsPath:  "results",
+		titleField:   "title",
+		urlField:     "url",
+		contentField: "content",
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+func (s *HTTPSearcher) Name() string {
+	return "http"
+}
+
+// Search 实现 interfaces.ISearchProvider
+func (s *HTTPSearcher) Search(ctx context.Context, query string, limit int) ([]interfaces.SearchResult, error) {
+	if limit <= 0 {
+		limit = 5
+	}
+
+	req := s.client.R().
+		SetContext(ctx).
+		SetQueryParam(s.queryParam, query)
+	if s.limitParam != "" {
+		req.SetQueryParam(s.limitParam, strconv.Itoa(limit))
+	}
+
+	resp, err := req.Get(s.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("搜索请求失败: %w", err)
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("搜索服务异常响应: %s", resp.Status())
+	}
+
+	var results []interfaces.SearchResult
+	gjson.GetBytes(resp.Bytes(), s.resultsPath).ForEach(func(_, item gjson.Result) bool {
+		results = append(results, interfaces.SearchResult{
+			Title:   item.Get(s.titleField).String(),
+			URL:     item.Get(s.urlField).String(),
+			Content: item.Get(s.contentField).String(),
+			Score:   item.Get("score").Float(),
+		})
+		return len(results) < limit
+	})
+	return results, nil
+}
@@ -0,0 +1,72 @@
+package search
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBuildMatchQuery(t *testing.T) {
+	tests := map[string]string{
+		"登录页面 表单校验":          `"登录页面" OR "表单校验"`,
+		`  go "hello" world`: `"hello" OR "world"`,
+		// trigram 无法匹配不足 3 个字符的词
+		"做 登录 页面设计": `"页面设计"`,
+		"ab cd":     "",
+		"":          "",
+	}
+	for query, want := range tests {
+		if got := buildMatchQuery(query); got != want {
+			t.Errorf("buildMatchQuery(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestHTTPSearcher(t *testing.T) {
+	var query, limit, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, limit, auth = r.URL.Query().Get("keyword"), r.URL.Query().Get("size"), r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": {"items": [
+			{"name": "登录页", "link": "https://a.example", "body": {"text": "表单"}, "score": 2.5},
+			{"name": "注册页", "link": "https://b.example", "body": {"text": "校验"}, "score": 1},
+			{"name": "首页", "link": "https://c.example", "body": {"text": "导航"}}
+		]}}`))
+	}))
+	defer srv.Close()
+
+	s := NewHTTPSearcher(srv.URL,
+		WithQueryParam("keyword"),
+		WithLimitParam("size"),
+		WithResultsPath("data.items"),
+		WithFields("name", "link", "body.text"),
+		WithHeader("Authorization", "Bearer token"),
+	)
+	results, err := s.Search(context.Background(), "登录", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != "登录" || limit != "2" || auth != "Bearer token" {
+		t.Errorf("request query = %q, limit = %q, auth = %q", query, limit, auth)
+	}
+	// 服务返回的条数超过 limit 时截断
+	if len(results) != 2 {
+		t.Fatalf("results = %+v, want 2", results)
+	}
+	first := results[0]
+	if first.Title != "登录页" || first.URL != "https://a.example" || first.Content != "表单" || first.Score != 2.5 {
+		t.Errorf("first = %+v", first)
+	}
+}
+
+func TestHTTPSearcherError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	if _, err := NewHTTPSearcher(srv.URL).Search(context.Background(), "登录", 0); err == nil {
+		t.Error("expected error for 502 response")
+	}
+}
@@ -0,0 +1,114 @@
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 密钥引用前缀，配置项的值不带前缀时视为明文
+const (
+	EnvPrefix   = "env:"    // env:OPENAI_KEY 读取环境变量
+	FilePrefix  = "file:"   // file:/run/secrets/key 读取文件内容，去掉末尾换行
+	VaultPrefix = "secret:" // secret:openai 读取加密密钥文件中的条目
+)
+
+// Resolve 解析密钥引用，返回密钥原文；vault 为空时 secret: 引用返回错误
+// 解析出的值会被登记，之后的日志中自动替换为 ***
+func Resolve(ref string, vault *Vault) (string, error) {
+	var value string
+	switch {
+	case strings.HasPrefix(ref, EnvPrefix):
+		name := strings.TrimPrefix(ref, EnvPrefix)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("环境变量未设置: %s", name)
+		}
+		value = v
+	case strings.HasPrefix(ref, FilePrefix):
+		path := strings.TrimPrefix(ref, FilePrefix)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("读取密钥文件失败: %w", err)
+		}
+		value = strings.TrimRight(string(data), "\r\n")
+	case strings.HasPrefix(ref, VaultPrefix):
+		name := strings.TrimPrefix(ref, VaultPrefix)
+		if vault == nil {
+			return "", errors.New("未配置 secretsFile，无法读取 " + ref)
+		}
+		v, ok := vault.Get(name)
+		if !ok {
+			return "", fmt.Errorf("加密密钥文件中没有 %s", name)
+		}
+		value = v
+	default:
+		value = ref
+	}
+	Register(value)
+	return value, nil
+}
+
+// minRedactLen 短于该长度的值不登记，避免日志中的普通短词被替换
+const minRedactLen = 4
+
+var (
+	mu       sync.RWMutex
+	known    = make(map[string]struct{})
+	replacer *strings.Replacer
+)
+
+// Register 登记密钥原文，Redact 会将其替换为 ***
+func Register(values ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	changed := false
+	for _, v := range values {
+		if len(v) < minRedactLen {
+			continue
+		}
+		if _, ok := known[v]; !ok {
+			known[v] = struct{}{}
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	// 长的优先替换，一个密钥包含另一个时不会只替换一半
+	list := make([]string, 0, len(known))
+	for v := range known {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return len(list[i]) > len(list[j]) })
+	pairs := make([]string, 0, len(list)*2)
+	for _, v := range list {
+		pairs = append(pairs, v, "***")
+	}
+	replacer = strings.NewReplacer(pairs...)
+}
+
+// Redact 将 s 中已登记的密钥替换为 ***
+func Redact(s string) string {
+	mu.RLock()
+	r := replacer
+	mu.RUnlock()
+	if r == nil {
+		return s
+	}
+	return r.Replace(s)
+}
+
+// Mask 只保留密钥前 3 位，用于输出配置
+func Mask(value string) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) <= 3 {
+		return "***"
+	}
+	return value[:3] + "***"
+}
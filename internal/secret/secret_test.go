@@ -0,0 +1,72 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	t.Setenv("SECRET_TEST_KEY", "sk-from-env")
+	file := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(file, []byte("sk-from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	vault, err := OpenVault(filepath.Join(t.TempDir(), "secrets.json"), "口令")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault.Set("openai", "sk-from-vault")
+
+	tests := []struct {
+		ref   string
+		vault *Vault
+		want  string
+		err   string
+	}{
+		{ref: "env:SECRET_TEST_KEY", want: "sk-from-env"},
+		{ref: "env:SECRET_TEST_MISSING", err: "环境变量未设置"},
+		{ref: "file:" + file, want: "sk-from-file"},
+		{ref: "file:" + file + ".missing", err: "读取密钥文件失败"},
+		{ref: "secret:openai", vault: vault, want: "sk-from-vault"},
+		{ref: "secret:missing", vault: vault, err: "没有 missing"},
+		{ref: "secret:openai", err: "未配置 secretsFile"},
+		{ref: "sk-plain-text", want: "sk-plain-text"},
+	}
+	for _, tt := range tests {
+		got, err := Resolve(tt.ref, tt.vault)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Resolve(%q) err = %v, want %q", tt.ref, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Resolve(%q) = %q, %v, want %q", tt.ref, got, err, tt.want)
+		}
+		// 解析出的值登记后在日志中被替换
+		if redacted := Redact("key=" + got); redacted != "key=***" {
+			t.Errorf("Redact = %q", redacted)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	Register("sk-redact-long-value", "sk-redact", "abc")
+	tests := map[string]string{
+		// 长的优先替换，不会只替换一半
+		"token sk-redact-long-value end": "token *** end",
+		"token sk-redact end":            "token *** end",
+		// 过短的值不登记
+		"abc def": "abc def",
+	}
+	for in, want := range tests {
+		if got := Redact(in); got != want {
+			t.Errorf("Redact(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := Mask("sk-123456"); got != "sk-***" {
+		t.Errorf("Mask = %q", got)
+	}
+}
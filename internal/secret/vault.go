@@ -0,0 +1,168 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// vaultIterations PBKDF2 迭代次数，解锁一次约需数百毫秒
+const vaultIterations = 600_000
+
+// Vault 以口令加密的本地密钥文件
+// 文件为 JSON，内容用 PBKDF2-SHA256 派生的密钥做 AES-256-GCM 加密，每次保存重新生成盐与随机数
+type Vault struct {
+	path       string
+	passphrase string
+	values     map[string]string
+}
+
+// vaultFile 密钥文件格式
+type vaultFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// OpenVault 用口令解锁密钥文件，文件不存在时返回空的 Vault，保存时创建
+func OpenVault(path, passphrase string) (*Vault, error) {
+	if passphrase == "" {
+		return nil, errors.New("密钥文件口令不能为空")
+	}
+	v := &Vault{path: path, passphrase: passphrase, values: make(map[string]string)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return v, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥文件失败: %w", err)
+	}
+
+	var f vaultFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("解析密钥文件失败: %w", err)
+	}
+	if f.Version != 1 || f.KDF != "pbkdf2-sha256" {
+		return nil, fmt.Errorf("不支持的密钥文件格式: version=%d kdf=%s", f.Version, f.KDF)
+	}
+	gcm, err := newGCM(passphrase, f.Salt, f.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return nil, errors.New("解锁密钥文件失败: 口令错误或文件已损坏")
+	}
+	if err := json.Unmarshal(plain, &v.values); err != nil {
+		return nil, fmt.Errorf("解析密钥文件失败: %w", err)
+	}
+	for _, value := range v.values {
+		Register(value)
+	}
+	return v, nil
+}
+
+// Path 返回密钥文件路径
+func (v *Vault) Path() string {
+	return v.path
+}
+
+// Get 返回名为 name 的密钥
+func (v *Vault) Get(name string) (string, bool) {
+	value, ok := v.values[name]
+	return value, ok
+}
+
+// Set 设置密钥，调用 Save 后写入文件
+func (v *Vault) Set(name, value string) {
+	v.values[name] = value
+	Register(value)
+}
+
+// Delete 删除密钥，返回是否存在
+func (v *Vault) Delete(name string) bool {
+	_, ok := v.values[name]
+	delete(v.values, name)
+	return ok
+}
+
+// Names 返回全部密钥名
+func (v *Vault) Names() []string {
+	names := make([]string, 0, len(v.values))
+	for name := range v.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Save 加密后写入文件，先写临时文件再重命名，文件权限为 0600
+func (v *Vault) Save() error {
+	plain, err := json.Marshal(v.values)
+	if err != nil {
+		return err
+	}
+	f := vaultFile{Version: 1, KDF: "pbkdf2-sha256", Iterations: vaultIterations, Salt: make([]byte, 16)}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return err
+	}
+	gcm, err := newGCM(v.passphrase, f.Salt, f.Iterations)
+	if err != nil {
+		return err
+	}
+	f.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+	f.Data = gcm.Seal(nil, f.Nonce, plain, nil)
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(v.path), ".secrets-*")
+	if err != nil {
+		return fmt.Errorf("写入密钥文件失败: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入密钥文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入密钥文件失败: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), v.path); err != nil {
+		return fmt.Errorf("写入密钥文件失败: %w", err)
+	}
+	return nil
+}
+
+// newGCM 由口令派生 AES-256 密钥
+func newGCM(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	if iterations <= 0 || len(salt) == 0 {
+		return nil, errors.New("密钥文件缺少盐或迭代次数")
+	}
+	block, err := aes.NewCipher(deriveKey(passphrase, salt, iterations))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// deriveKey 以 PBKDF2-HMAC-SHA256 派生 32 字节的密钥
+func deriveKey(passphrase string, salt []byte, iterations int) []byte {
+	return pbkdf2.Key([]byte(passphrase), salt, iterations, 32, sha256.New)
+}
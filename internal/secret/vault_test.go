@@ -0,0 +1,77 @@
+package secret
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// RFC 7914 第 11 节的 PBKDF2-HMAC-SHA256 测试向量，确保已有的密钥文件仍能解锁
+func TestDeriveKeyVector(t *testing.T) {
+	// 向量的派生长度为 64 字节，取前 32 字节
+	want := "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"
+	if got := hex.EncodeToString(deriveKey("passwd", []byte("salt"), 1)); got != want {
+		t.Errorf("deriveKey = %s, want %s", got, want)
+	}
+}
+
+func TestVaultRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	v, err := OpenVault(path, "口令")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Set("openai", "sk-round-trip")
+	v.Set("webhook", "hook-secret")
+	v.Set("removed", "gone-value")
+	if !v.Delete("removed") {
+		t.Error("Delete returned false for an existing secret")
+	}
+	if err := v.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "sk-round-trip") {
+		t.Error("secret stored in plain text")
+	}
+
+	opened, err := OpenVault(path, "口令")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := opened.Get("openai"); got != "sk-round-trip" {
+		t.Errorf("openai = %q", got)
+	}
+	if names := strings.Join(opened.Names(), ","); names != "openai,webhook" {
+		t.Errorf("names = %s", names)
+	}
+}
+
+func TestVaultWrongPassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+	v, err := OpenVault(path, "right")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Set("openai", "sk-wrong-pass")
+	if err := v.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenVault(path, "wrong"); err == nil || !strings.Contains(err.Error(), "口令错误") {
+		t.Errorf("err = %v, want wrong passphrase error", err)
+	}
+	if _, err := OpenVault(path, ""); err == nil {
+		t.Error("empty passphrase accepted")
+	}
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"learn/internal/chain"
+	"learn/internal/model"
+)
+
+const (
+	// maxHistory 每次运行保留的事件数，超出后新的订阅者无法看到最早的事件
+	maxHistory = 20000
+	// subscriberBuffer 订阅者缓冲，消费过慢时断开，由客户端携带 Last-Event-ID 重连
+	subscriberBuffer = 1024
+	// keepAlive SSE 心跳间隔
+	keepAlive = 15 * time.Second
+	// pollInterval 运行不在本进程执行时轮询数据库的间隔
+	pollInterval = time.Second
+)
+
+// sequenced 带序号的事件，序号即 SSE 的 id
+type sequenced struct {
+	id    int
+	event chain.Event
+}
+
+// eventStream 单次运行的事件广播，保留历史以便晚到或重连的订阅者回放
+type eventStream struct {
+	mu      sync.Mutex
+	history []sequenced
+	next    int
+	subs    map[chan sequenced]struct{}
+	closed  bool
+}
+
+func newEventStream() *eventStream {
+	return &eventStream{next: 1, subs: make(map[chan sequenced]struct{})}
+}
+
+// publish 广播事件，run-end 之后关闭所有订阅
+func (st *eventStream) publish(e chain.Event) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.closed {
+		return
+	}
+
+	se := sequenced{id: st.next, event: e}
+	st.next++
+	if len(st.history) < maxHistory {
+		st.history = append(st.history, se)
+	}
+	for sub := range st.subs {
+		select {
+		case sub <- se:
+		default:
+			delete(st.subs, sub)
+			close(sub)
+		}
+	}
+	if e.Type == chain.EventRunEnd {
+		st.close()
+	}
+}
+
+// close 关闭所有订阅，需持有锁
+func (st *eventStream) close() {
+	st.closed = true
+	for sub := range st.subs {
+		close(sub)
+	}
+	st.subs = nil
+}
+
+// subscribe 返回 id 大于 after 的历史事件与后续事件的通道，运行已结束时通道为 nil
+func (st *eventStream) subscribe(after int) ([]sequenced, chan sequenced) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var history []sequenced
+	for _, se := range st.history {
+		if se.id > after {
+			history = append(history, se)
+		}
+	}
+	if st.closed {
+		return history, nil
+	}
+	sub := make(chan sequenced, subscriberBuffer)
+	st.subs[sub] = struct{}{}
+	return history, sub
+}
+
+func (st *eventStream) unsubscribe(sub chan sequenced) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if _, ok := st.subs[sub]; ok {
+		delete(st.subs, sub)
+		close(sub)
+	}
+}
+
+// stream 返回运行的事件广播，不存在时返回 nil
+func (s *Server) stream(runID string) *eventStream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams[runID]
+}
+
+// streamEvents 以 SSE 推送运行事件，运行已结束时只推送一条 run-end
+// 运行由其他进程执行时无法获得逐字输出，改为轮询数据库推送 step-end 与 run-end
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	record, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("不支持流式响应"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	after, _ := strconv.Atoi(r.Header.Get("Last-Event-ID"))
+	lastWrite := time.Now()
+	for {
+		// 进程内的 Worker 开始执行后切换到事件广播
+		if st := s.stream(record.RunID); st != nil {
+			s.forward(w, r, flusher, st, after)
+			return
+		}
+		if finished(record.Status) {
+			writeEvent(w, sequenced{event: chain.Event{
+				Type:   chain.EventRunEnd,
+				RunID:  record.RunID,
+				Status: model.Status(record.Status),
+				Error:  record.Error,
+				Time:   record.UpdatedAt,
+			}})
+			flusher.Flush()
+			return
+		}
+
+		select {
+		case <-time.After(pollInterval):
+		case <-r.Context().Done():
+			return
+		}
+		next, err := s.store.GetRun(r.Context(), record.RunID)
+		if err != nil || next == nil {
+			return
+		}
+		if len(next.Steps) > len(record.Steps) {
+			for _, step := range next.Steps[len(record.Steps):] {
+				writeEvent(w, sequenced{event: chain.Event{
+					Type:  chain.EventStepEnd,
+					RunID: record.RunID,
+					Step:  step,
+					Time:  next.UpdatedAt,
+				}})
+			}
+			lastWrite = time.Now()
+			flusher.Flush()
+		} else if time.Since(lastWrite) >= keepAlive {
+			fmt.Fprint(w, ": ping\n\n")
+			lastWrite = time.Now()
+			flusher.Flush()
+		}
+		record = next
+	}
+}
+
+// forward 推送事件广播中 id 大于 after 的事件，直到运行结束或连接断开
+func (s *Server) forward(w http.ResponseWriter, r *http.Request, flusher http.Flusher, st *eventStream, after int) {
+	history, sub := st.subscribe(after)
+	if sub != nil {
+		defer st.unsubscribe(sub)
+	}
+	for _, se := range history {
+		writeEvent(w, se)
+	}
+	flusher.Flush()
+	if sub == nil {
+		return
+	}
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case se, ok := <-sub:
+			if !ok {
+				return
+			}
+			writeEvent(w, se)
+			flusher.Flush()
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// finished 运行是否已结束，等待重试的运行为待执行
+func finished(status string) bool {
+	switch model.Status(status) {
+	case model.StatusCompleted, model.StatusFailed, model.StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// writeEvent 写入一条 SSE 事件，id 为 0 时不写入 id 行
+func writeEvent(w http.ResponseWriter, se sequenced) {
+	data, err := json.Marshal(se.event)
+	if err != nil {
+		return
+	}
+	if se.id > 0 {
+		fmt.Fprintf(w, "id: %d\n", se.id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", se.event.Type, data)
+}
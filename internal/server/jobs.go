@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+
+	"learn/internal/chain"
+)
+
+// Start 启动进程内的 Worker，ctx 取消后运行中的任务归还队列
+// 未启用进程内 Worker 时，任务由 worker 子命令启动的进程执行
+func (s *Server) Start(ctx context.Context) {
+	if s.worker == nil {
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.worker.Run(ctx)
+	}()
+}
+
+// Wait 等待进程内的 Worker 退出
+func (s *Server) Wait() {
+	s.wg.Wait()
+}
+
+// publisher 返回运行的事件广播，供进程内的 Worker 发送事件，run-end 后移除
+func (s *Server) publisher(runID string) func(e chain.Event) {
+	s.mu.Lock()
+	st, ok := s.streams[runID]
+	if !ok {
+		st = newEventStream()
+		s.streams[runID] = st
+	}
+	s.mu.Unlock()
+
+	return func(e chain.Event) {
+		st.publish(e)
+		if e.Type != chain.EventRunEnd {
+			return
+		}
+		s.mu.Lock()
+		if s.streams[runID] == st {
+			delete(s.streams, runID)
+		}
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"learn/internal/chain"
+	"learn/internal/model"
+	"learn/internal/usage"
+	"learn/internal/util"
+)
+
+// 以下为 OpenAI chat completions 接口的兼容实现：流水线名称作为模型名，
+// 最后一条用户消息作为需求，返回链条的输出（见 chain.Result.Output）
+
+type completionRequest struct {
+	Model    string            `json:"model"`
+	Messages []util.PromptType `json:"messages"`
+	Stream   bool              `json:"stream"`
+
+	StreamOptions struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+}
+
+type completionUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type completionChoice struct {
+	Index        int              `json:"index"`
+	Message      *util.PromptType `json:"message,omitempty"`
+	Delta        *completionDelta `json:"delta,omitempty"`
+	FinishReason *string          `json:"finish_reason"`
+}
+
+type completionDelta struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type completion struct {
+	ID      string             `json:"id"`
+	Object  string             `json:"object"`
+	Created int64              `json:"created"`
+	Model   string             `json:"model"`
+	Choices []completionChoice `json:"choices"`
+	Usage   *completionUsage   `json:"usage,omitempty"`
+}
+
+func newCompletionUsage(s usage.Stats) *completionUsage {
+	return &completionUsage{
+		PromptTokens:     s.PromptTokens,
+		CompletionTokens: s.CompletionTokens,
+		TotalTokens:      s.TotalTokens(),
+	}
+}
+
+// listModels 每个流水线作为一个模型
+func (s *Server) listModels(w http.ResponseWriter, _ *http.Request) {
+	type modelInfo struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Created int64  `json:"created"`
+		OwnedBy string `json:"owned_by"`
+	}
+	models := []modelInfo{}
+	for _, name := range chain.Pipelines() {
+		models = append(models, modelInfo{ID: name, Object: "model", OwnedBy: "llm-chain"})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"object": "list", "data": models})
+}
+
+// chatCompletions 同步执行一次链条，客户端断开时取消运行
+func (s *Server) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req completionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "", fmt.Errorf("请求体格式错误: %w", err))
+		return
+	}
+	if !slices.Contains(chain.Pipelines(), req.Model) {
+		writeOpenAIError(w, http.StatusNotFound, "model_not_found", fmt.Errorf("模型不存在: %s", req.Model))
+		return
+	}
+	message := lastUserMessage(req.Messages)
+	if message == "" {
+		writeOpenAIError(w, http.StatusBadRequest, "", errors.New("缺少用户消息"))
+		return
+	}
+
+	ch, err := chain.NewPipeline(req.Model)
+	if err != nil {
+		writeOpenAIError(w, http.StatusNotFound, "model_not_found", err)
+		return
+	}
+	if s.setup != nil {
+		s.setup(ch)
+	}
+	ch.SetStore(s.store)
+
+	request := &chain.Request{Message: message, Data: make(map[string]any), RunID: util.NewID()}
+	request.ArtifactDir = s.artifactDir(request.RunID)
+	request.SetContext(r.Context())
+
+	base := completion{
+		ID:      "chatcmpl-" + request.RunID,
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+	}
+	if req.Stream {
+		s.streamCompletion(w, ch, request, base, req.StreamOptions.IncludeUsage)
+		return
+	}
+
+	result := ch.HandleRequest(request)
+	if result.Status != model.StatusCompleted {
+		writeOpenAIError(w, http.StatusInternalServerError, "", errors.New(result.Error))
+		return
+	}
+	stop := "stop"
+	reply := util.AppendAssistantPrompt(result.Output)
+	base.Object = "chat.completion"
+	base.Choices = []completionChoice{{Message: &reply, FinishReason: &stop}}
+	base.Usage = newCompletionUsage(result.Usage)
+	writeJSON(w, http.StatusOK, base)
+}
+
+// streamCompletion 以 SSE 返回输出步骤的流式内容
+func (s *Server) streamCompletion(w http.ResponseWriter, ch *chain.Chain, request *chain.Request, base completion, includeUsage bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeOpenAIError(w, http.StatusInternalServerError, "", errors.New("不支持流式响应"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	base.Object = "chat.completion.chunk"
+	send := func(v any) {
+		data, _ := json.Marshal(v)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+	}
+	chunk := func(delta completionDelta, finish *string) completion {
+		c := base
+		c.Choices = []completionChoice{{Delta: &delta, FinishReason: finish}}
+		return c
+	}
+
+	send(chunk(completionDelta{Role: "assistant"}, nil))
+	// 事件在运行所在的 goroutine 中同步回调，可直接写入响应；
+	// 输出开始后模型失败时 Agent 不再重试（见 agent.send），运行以错误结束
+	outputStep, streamed := ch.OutputStep(), false
+	request.OnEvent = func(e chain.Event) {
+		if e.Type == chain.EventDelta && e.Step == outputStep {
+			streamed = true
+			send(chunk(completionDelta{Content: e.Delta}, nil))
+		}
+	}
+
+	result := ch.HandleRequest(request)
+	if result.Status != model.StatusCompleted {
+		send(map[string]any{"error": map[string]string{"message": result.Error, "type": "server_error"}})
+		fmt.Fprint(w, "data: [DONE]\n\n")
+		flusher.Flush()
+		return
+	}
+	if !streamed && result.Output != "" {
+		send(chunk(completionDelta{Content: result.Output}, nil))
+	}
+	stop := "stop"
+	send(chunk(completionDelta{}, &stop))
+	if includeUsage {
+		c := base
+		c.Choices = []completionChoice{}
+		c.Usage = newCompletionUsage(result.Usage)
+		send(c)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+func lastUserMessage(messages []util.PromptType) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
+
+// writeOpenAIError 按 OpenAI 的错误格式返回，code 可为空
+func writeOpenAIError(w http.ResponseWriter, status int, code string, err error) {
+	body := map[string]any{"message": err.Error(), "type": "invalid_request_error"}
+	if status >= 500 {
+		body["type"] = "server_error"
+	}
+	if code != "" {
+		body["code"] = code
+	}
+	writeJSON(w, status, map[string]any{"error": body})
+}
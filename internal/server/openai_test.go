@@ -0,0 +1,69 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"learn/internal/chain"
+	"learn/internal/database"
+	"learn/internal/provider"
+)
+
+func newCompletionServer(t *testing.T, p provider.Provider) *httptest.Server {
+	t.Helper()
+	store := database.OpenTest(t)
+
+	s := New(store, WithWorkers(0), WithArtifactsDir(t.TempDir()),
+		WithSetup(func(c *chain.Chain) { c.SetProvider(p) }))
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func postStream(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	body := `{"model":"analyze","stream":true,"messages":[{"role":"user","content":"做一个登录页"}]}`
+	resp, err := http.Post(srv.URL+"/v1/chat/completions", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestStreamCompletion(t *testing.T) {
+	mock := provider.NewMock(provider.MockResponse{Chunks: []string{"需求", "文档"}})
+	out := postStream(t, newCompletionServer(t, mock))
+
+	for _, want := range []string{`"content":"需求"`, `"content":"文档"`, `"finish_reason":"stop"`, "data: [DONE]"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("stream missing %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestStreamCompletionInterruptedAttempt(t *testing.T) {
+	mock := provider.NewMock(
+		provider.MockResponse{Chunks: []string{"部分"}, StatusCode: 503},
+		provider.MockResponse{Chunks: []string{"完整的答案"}},
+	)
+	out := postStream(t, newCompletionServer(t, mock))
+
+	if !strings.Contains(out, `"content":"部分"`) || !strings.Contains(out, `"error"`) || !strings.HasSuffix(out, "data: [DONE]\n\n") {
+		t.Errorf("stream should end with an error after partial output:\n%s", out)
+	}
+	// 重试的输出不会接在部分内容之后
+	if strings.Contains(out, "完整的答案") || strings.Contains(out, `"finish_reason":"stop"`) {
+		t.Errorf("retried output forwarded:\n%s", out)
+	}
+	if mock.Remaining() != 1 {
+		t.Errorf("retry sent after the stream was interrupted, remaining = %d", mock.Remaining())
+	}
+}
@@ -0,0 +1,370 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"learn/internal/chain"
+	"learn/internal/database"
+	"learn/internal/logger"
+	"learn/internal/model"
+	"learn/internal/usage"
+	"learn/internal/worker"
+)
+
+// Store 服务依赖的存储，database.Store 已实现
+type Store interface {
+	worker.Store
+	EnqueueJob(ctx context.Context, job *database.Job) error
+	CancelJob(ctx context.Context, id string) (string, error)
+	ListRuns(ctx context.Context, limit int) ([]database.RunRecord, error)
+	ListUsage(ctx context.Context, runID string) ([]database.UsageRecord, error)
+}
+
+// Server 提交与查询链条运行的 HTTP 服务，运行写入持久化任务队列，由 Worker 执行
+type Server struct {
+	store        Store
+	workers      int
+	maxAttempts  int
+	artifactsDir string
+	setup        func(c *chain.Chain)
+	workerOpts   []worker.Option
+	notifier     worker.Notifier
+
+	// worker 进程内的 Worker，workers 为 0 时为空
+	worker *worker.Worker
+	wg     sync.WaitGroup
+
+	mu sync.Mutex
+	// streams 进程内运行中任务的事件广播
+	streams map[string]*eventStream
+}
+
+// Option 定义 with 选项函数类型
+type Option func(*Server)
+
+// WithWorkers 设置进程内并发执行的任务数，默认 2；为 0 时只接收请求，由独立的 Worker 进程执行
+func WithWorkers(n int) Option {
+	return func(s *Server) {
+		s.workers = n
+	}
+}
+
+// WithMaxAttempts 设置每次运行最多执行的次数，失败后按退避时间重试，默认 worker.DefaultMaxAttempts
+func WithMaxAttempts(n int) Option {
+	return func(s *Server) {
+		s.maxAttempts = n
+	}
+}
+
+// WithNotifier 设置运行结束的通知，进程内 Worker 与排队期间的取消共用
+func WithNotifier(n worker.Notifier) Option {
+	return func(s *Server) {
+		s.notifier = n
+	}
+}
+
+// WithWorkerOptions 设置进程内 Worker 的其他选项，如租约时长
+func WithWorkerOptions(opts ...worker.Option) Option {
+	return func(s *Server) {
+		s.workerOpts = append(s.workerOpts, opts...)
+	}
+}
+
+// WithArtifactsDir 设置生成文件的根目录，每次运行写入 <dir>/<run_id>，默认 artifacts
+func WithArtifactsDir(dir string) Option {
+	return func(s *Server) {
+		s.artifactsDir = dir
+	}
+}
+
+// WithSetup 设置链条初始化函数，用于注入模型服务与预算
+func WithSetup(setup func(c *chain.Chain)) Option {
+	return func(s *Server) {
+		s.setup = setup
+	}
+}
+
+// New 创建服务
+func New(store Store, opts ...Option) *Server {
+	s := &Server{
+		store:        store,
+		workers:      2,
+		maxAttempts:  worker.DefaultMaxAttempts,
+		artifactsDir: "artifacts",
+		streams:      make(map[string]*eventStream),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.workers > 0 {
+		s.worker = worker.New(store, append([]worker.Option{
+			worker.WithConcurrency(s.workers),
+			worker.WithArtifactsDir(s.artifactsDir),
+			worker.WithSetup(s.setup),
+			worker.WithEvents(s.publisher),
+			worker.WithNotifier(s.notifier),
+		}, s.workerOpts...)...)
+	}
+	return s
+}
+
+// Handler 返回 API 路由
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/pipelines", s.listPipelines)
+	mux.HandleFunc("POST /api/runs", s.submitRun)
+	mux.HandleFunc("GET /api/runs", s.listRuns)
+	mux.HandleFunc("GET /api/runs/{id}", s.getRun)
+	mux.HandleFunc("POST /api/runs/{id}/cancel", s.cancelRun)
+	mux.HandleFunc("GET /api/runs/{id}/events", s.streamEvents)
+	mux.HandleFunc("GET /api/runs/{id}/artifacts", s.listArtifacts)
+	mux.HandleFunc("GET /api/runs/{id}/artifacts/{name}", s.getArtifact)
+
+	// OpenAI 兼容接口
+	mux.HandleFunc("GET /v1/models", s.listModels)
+	mux.HandleFunc("POST /v1/chat/completions", s.chatCompletions)
+	return mux
+}
+
+// SubmitRequest 提交运行的请求体
+type SubmitRequest struct {
+	Pipeline  string          `json:"pipeline"`
+	Message   string          `json:"message"`
+	Overrides chain.Overrides `json:"overrides,omitempty"`
+}
+
+// Run 运行详情，在 chain.Result 的基础上附带请求与时间信息
+type Run struct {
+	chain.Result
+	Message string `json:"message"`
+	// Completed 已完成的步骤
+	Completed []string  `json:"completed_steps"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (s *Server) listPipelines(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, chain.Pipelines())
+}
+
+func (s *Server) submitRun(w http.ResponseWriter, r *http.Request) {
+	var req SubmitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("请求体格式错误: %w", err))
+		return
+	}
+	if req.Pipeline == "" {
+		req.Pipeline = chain.DefaultPipeline
+	}
+	if req.Message == "" {
+		writeError(w, http.StatusBadRequest, errors.New("message 不能为空"))
+		return
+	}
+	if !slices.Contains(chain.Pipelines(), req.Pipeline) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("未知的流水线: %s", req.Pipeline))
+		return
+	}
+	if _, err := req.Overrides.Apply(&chain.Request{}); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	record, err := worker.Submit(r.Context(), s.store, req.Pipeline, req.Message, req.Overrides, s.maxAttempts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if s.worker != nil {
+		s.worker.Notify()
+	}
+
+	writeJSON(w, http.StatusAccepted, s.view(r.Context(), record, nil))
+}
+
+func (s *Server) listRuns(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("limit 必须为正整数"))
+			return
+		}
+		limit = n
+	}
+
+	records, err := s.store.ListRuns(r.Context(), limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	runs := make([]*Run, 0, len(records))
+	for i := range records {
+		// 列表不查询用量，避免逐条访问数据库
+		runs = append(runs, s.view(r.Context(), &records[i], nil))
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+func (s *Server) getRun(w http.ResponseWriter, r *http.Request) {
+	record, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	records, err := s.store.ListUsage(r.Context(), record.RunID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.view(r.Context(), record, records))
+}
+
+func (s *Server) cancelRun(w http.ResponseWriter, r *http.Request) {
+	record, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	// 本进程中运行的任务立即取消，其他进程在下次续租时发现取消请求
+	local := s.worker != nil && s.worker.Cancel(record.RunID)
+	status, err := s.store.CancelJob(r.Context(), record.RunID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	switch {
+	case status == database.JobCancelled:
+		record.Status, record.Error = string(model.StatusCancelled), "排队期间被取消"
+		if err := s.store.SaveRun(r.Context(), record); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if s.notifier != nil {
+			s.notifier.Notify(logger.With(r.Context(), "run_id", record.RunID), record)
+		}
+	case !local && status != database.JobLeased:
+		writeError(w, http.StatusConflict, fmt.Errorf("运行已结束: %s", record.Status))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, s.view(r.Context(), record, nil))
+}
+
+func (s *Server) listArtifacts(w http.ResponseWriter, r *http.Request) {
+	record, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.artifacts(record.RunID))
+}
+
+func (s *Server) getArtifact(w http.ResponseWriter, r *http.Request) {
+	record, ok := s.lookup(w, r)
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		writeError(w, http.StatusBadRequest, errors.New("文件名不合法"))
+		return
+	}
+	path := filepath.Join(s.artifactDir(record.RunID), name)
+	if _, err := os.Stat(path); err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("文件不存在: %s", name))
+		return
+	}
+	http.ServeFile(w, r, path)
+}
+
+// lookup 读取路径中的运行记录，不存在时写入 404
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) (*database.RunRecord, bool) {
+	record, err := s.store.GetRun(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if record == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("运行不存在: %s", r.PathValue("id")))
+		return nil, false
+	}
+	return record, true
+}
+
+// view 将运行记录与用量转换为接口返回的结构
+func (s *Server) view(ctx context.Context, record *database.RunRecord, records []database.UsageRecord) *Run {
+	run := &Run{
+		Result: chain.Result{
+			RunID:     record.RunID,
+			Pipeline:  record.Pipeline,
+			Status:    model.Status(record.Status),
+			Error:     record.Error,
+			Data:      map[string]any{},
+			Steps:     []usage.StepUsage{},
+			Artifacts: s.artifacts(record.RunID),
+		},
+		Message:   record.Message,
+		Completed: record.Steps,
+		CreatedAt: record.CreatedAt,
+		UpdatedAt: record.UpdatedAt,
+	}
+	if run.Completed == nil {
+		run.Completed = []string{}
+	}
+	if len(record.Data) > 0 {
+		if err := json.Unmarshal(record.Data, &run.Data); err != nil {
+			slog.WarnContext(ctx, "运行数据无法解析", "run_id", record.RunID, "error", err)
+		}
+	}
+	for _, u := range records {
+		stats := usage.Stats{
+			Requests:         u.Requests,
+			CachedRequests:   u.CachedRequests,
+			PromptTokens:     u.PromptTokens,
+			CompletionTokens: u.CompletionTokens,
+			Cost:             u.Cost,
+		}
+		run.Steps = append(run.Steps, usage.StepUsage{Step: u.Step, Model: u.Model, Stats: stats})
+		run.Usage = run.Usage.Add(stats)
+	}
+	return run
+}
+
+// artifacts 返回运行生成文件的下载地址
+func (s *Server) artifacts(runID string) []string {
+	entries, err := os.ReadDir(s.artifactDir(runID))
+	if err != nil {
+		return []string{}
+	}
+	links := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			links = append(links, "/api/runs/"+runID+"/artifacts/"+e.Name())
+		}
+	}
+	return links
+}
+
+// artifactDir 返回运行生成文件的目录
+func (s *Server) artifactDir(runID string) string {
+	return filepath.Join(s.artifactsDir, runID)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
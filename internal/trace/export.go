@@ -0,0 +1,199 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Collector 进程内收集器，保存所有已结束的跨度
+type Collector struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// NewCollector 创建进程内收集器
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+func (c *Collector) ExportSpan(span *Span) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.spans = append(c.spans, span)
+}
+
+// Spans 返回全部跨度
+func (c *Collector) Spans() []*Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*Span(nil), c.spans...)
+}
+
+// Trace 返回某个 trace 的全部跨度，按开始时间排序
+func (c *Collector) Trace(traceID string) []*Span {
+	var spans []*Span
+	for _, s := range c.Spans() {
+		if s.TraceID == traceID {
+			spans = append(spans, s)
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start.Before(spans[j].Start) })
+	return spans
+}
+
+// FileExporter 以 OTLP JSON 格式写入文件，每个 trace 的根跨度结束时写入一行
+type FileExporter struct {
+	service string
+
+	mu      sync.Mutex
+	file    *os.File
+	pending map[string][]*Span
+}
+
+// NewFileExporter 创建文件导出器，追加写入
+func NewFileExporter(path, service string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开追踪文件失败: %w", err)
+	}
+	return &FileExporter{service: service, file: f, pending: map[string][]*Span{}}, nil
+}
+
+func (e *FileExporter) ExportSpan(span *Span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.pending[span.TraceID] = append(e.pending[span.TraceID], span)
+	if span.ParentID == "" {
+		e.flush(span.TraceID)
+	}
+}
+
+// Close 写入尚未结束的 trace 并关闭文件
+func (e *FileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for traceID := range e.pending {
+		e.flush(traceID)
+	}
+	return e.file.Close()
+}
+
+func (e *FileExporter) flush(traceID string) {
+	spans := e.pending[traceID]
+	delete(e.pending, traceID)
+
+	data, err := json.Marshal(toOTLP(e.service, spans))
+	if err == nil {
+		_, err = e.file.Write(append(data, '\n'))
+	}
+	if err != nil {
+		slog.Warn("写入追踪文件失败", "trace_id", traceID, "error", err)
+	}
+}
+
+// OTLP JSON 结构，字段命名遵循 OTLP/JSON 规范
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string         `json:"key"`
+		Value map[string]any `json:"value"`
+	}
+)
+
+func toOTLP(service string, spans []*Span) otlpRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		out = append(out, otlpSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentID,
+			Name:              s.Name,
+			Kind:              1, // SPAN_KIND_INTERNAL
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        toKeyValues(s.Attributes),
+			Status:            otlpStatus{Code: int(s.Status), Message: s.Message},
+		})
+		s.mu.Unlock()
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: toKeyValues(map[string]any{"service.name": service})},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "learn/internal/trace"},
+			Spans: out,
+		}},
+	}}}
+}
+
+func toKeyValues(attrs map[string]any) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: toAnyValue(attrs[k])})
+	}
+	return kvs
+}
+
+// toAnyValue 转换为 OTLP AnyValue，整数按规范编码为字符串
+func toAnyValue(v any) map[string]any {
+	switch val := v.(type) {
+	case string:
+		return map[string]any{"stringValue": val}
+	case bool:
+		return map[string]any{"boolValue": val}
+	case int:
+		return map[string]any{"intValue": strconv.Itoa(val)}
+	case int64:
+		return map[string]any{"intValue": strconv.FormatInt(val, 10)}
+	case float64:
+		return map[string]any{"doubleValue": val}
+	case fmt.Stringer:
+		return map[string]any{"stringValue": val.String()}
+	}
+	return map[string]any{"stringValue": fmt.Sprint(v)}
+}
@@ -0,0 +1,125 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Status 跨度状态，取值与 OTLP 一致
+type Status int
+
+const (
+	StatusUnset Status = 0
+	StatusOK    Status = 1
+	StatusError Status = 2
+)
+
+// Span 一段被追踪的操作
+type Span struct {
+	TraceID    string
+	SpanID     string
+	ParentID   string
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Status     Status
+	Message    string
+	Attributes map[string]any
+
+	mu    sync.Mutex
+	ended bool
+}
+
+// Exporter 导出已结束的跨度
+type Exporter interface {
+	ExportSpan(span *Span)
+}
+
+var exporter atomic.Value // exporterHolder
+
+type exporterHolder struct{ Exporter }
+
+// SetExporter 设置全局导出器，为 nil 时关闭追踪
+func SetExporter(e Exporter) {
+	exporter.Store(exporterHolder{e})
+}
+
+func currentExporter() Exporter {
+	h, _ := exporter.Load().(exporterHolder)
+	return h.Exporter
+}
+
+// Enabled 是否已设置导出器
+func Enabled() bool {
+	return currentExporter() != nil
+}
+
+type ctxKey struct{}
+
+// FromContext 返回 ctx 中当前的跨度
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(ctxKey{}).(*Span)
+	return span
+}
+
+// Start 开始一个跨度，ctx 中已有跨度时作为其子跨度
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	span := &Span{
+		SpanID:     newID(8),
+		Name:       name,
+		Start:      time.Now(),
+		Attributes: map[string]any{},
+	}
+	if parent := FromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+	} else {
+		span.TraceID = newID(16)
+	}
+	return context.WithValue(ctx, ctxKey{}, span), span
+}
+
+// Set 设置属性
+func (s *Span) Set(key string, value any) *Span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attributes[key] = value
+	return s
+}
+
+// Finish 结束跨度，err 不为空时标记为错误；重复调用无效
+func (s *Span) Finish(err error) {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	if err != nil {
+		s.Status = StatusError
+		s.Message = err.Error()
+	} else {
+		s.Status = StatusOK
+	}
+	s.mu.Unlock()
+
+	if e := currentExporter(); e != nil {
+		e.ExportSpan(s)
+	}
+}
+
+// Duration 跨度耗时
+func (s *Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+func newID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
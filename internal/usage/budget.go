@@ -0,0 +1,108 @@
+package usage
+
+import (
+	"fmt"
+	"time"
+)
+
+// Budget 预算上限，零值表示对应维度不限制
+type Budget struct {
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	MaxRequests int           `json:"max_requests,omitempty"`
+	MaxWallTime time.Duration `json:"max_wall_time,omitempty"`
+	MaxCost     float64       `json:"max_cost,omitempty"`
+}
+
+// Budgets 一次运行的预算：Run 为整体预算，Step 为每个步骤的默认预算，Steps 按步骤名覆盖
+type Budgets struct {
+	Run   Budget            `json:"run"`
+	Step  Budget            `json:"step"`
+	Steps map[string]Budget `json:"steps,omitempty"`
+}
+
+// ForStep 返回步骤适用的预算
+func (b *Budgets) ForStep(step string) Budget {
+	if budget, ok := b.Steps[step]; ok {
+		return budget
+	}
+	return b.Step
+}
+
+// 预算维度
+const (
+	KindTokens   = "tokens"
+	KindRequests = "requests"
+	KindWallTime = "wall_time"
+	KindCost     = "cost"
+)
+
+// BudgetExceededError 预算超限错误，可通过 errors.As 获取超限的范围与维度
+type BudgetExceededError struct {
+	// Scope 为 run 或 step:<步骤名>
+	Scope string
+	Kind  string
+	Limit float64
+	Used  float64
+}
+
+func (e *BudgetExceededError) Error() string {
+	if e.Kind == KindWallTime {
+		return fmt.Sprintf("%s budget exceeded: %s used %s of %s", e.Scope, e.Kind,
+			time.Duration(e.Used).Round(time.Millisecond), time.Duration(e.Limit))
+	}
+	return fmt.Sprintf("%s budget exceeded: %s used %g of %g", e.Scope, e.Kind, e.Used, e.Limit)
+}
+
+// check 检查用量是否超出预算，nextTokens 为下一次请求预计消耗的 token
+func (b Budget) check(scope string, used Stats, elapsed time.Duration, nextTokens int) error {
+	exceeded := func(kind string, limit, used float64) error {
+		return &BudgetExceededError{Scope: scope, Kind: kind, Limit: limit, Used: used}
+	}
+
+	switch {
+	case b.MaxRequests > 0 && used.Requests+1 > b.MaxRequests:
+		return exceeded(KindRequests, float64(b.MaxRequests), float64(used.Requests))
+	case b.MaxTokens > 0 && used.TotalTokens()+nextTokens > b.MaxTokens:
+		// 按已用量加上下一次请求的预估量计算
+		return exceeded(KindTokens, float64(b.MaxTokens), float64(used.TotalTokens()+nextTokens))
+	case b.MaxCost > 0 && used.Cost >= b.MaxCost:
+		return exceeded(KindCost, b.MaxCost, used.Cost)
+	case b.MaxWallTime > 0 && elapsed >= b.MaxWallTime:
+		return exceeded(KindWallTime, float64(b.MaxWallTime), float64(elapsed))
+	}
+	return nil
+}
+
+// Guard 单个步骤的预算检查，由 Agent 在每次请求前调用
+type Guard struct {
+	step      string
+	budgets   *Budgets
+	tracker   *Tracker
+	runStart  time.Time
+	stepStart time.Time
+}
+
+// NewGuard 创建步骤的预算检查，tracker 为运行的用量汇总（不含当前步骤）
+func NewGuard(step string, budgets *Budgets, tracker *Tracker, runStart time.Time) *Guard {
+	return &Guard{
+		step:      step,
+		budgets:   budgets,
+		tracker:   tracker,
+		runStart:  runStart,
+		stepStart: time.Now(),
+	}
+}
+
+// Check 检查当前步骤与整次运行的预算
+func (g *Guard) Check(stepUsage Stats, nextTokens int) error {
+	now := time.Now()
+	if err := g.budgets.ForStep(g.step).check("step:"+g.step, stepUsage, now.Sub(g.stepStart), nextTokens); err != nil {
+		return err
+	}
+
+	runUsage := stepUsage
+	if g.tracker != nil {
+		runUsage = runUsage.Add(g.tracker.Total())
+	}
+	return g.budgets.Run.check("run", runUsage, now.Sub(g.runStart), nextTokens)
+}
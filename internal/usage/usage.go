@@ -0,0 +1,132 @@
+package usage
+
+import (
+	"strings"
+	"sync"
+
+	"learn/internal/config"
+	"learn/internal/provider"
+)
+
+// Stats 用量统计
+type Stats struct {
+	Requests         int     `json:"requests"`
+	CachedRequests   int     `json:"cached_requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// TotalTokens 总 token 数
+func (s Stats) TotalTokens() int {
+	return s.PromptTokens + s.CompletionTokens
+}
+
+// Add 返回两份统计之和
+func (s Stats) Add(o Stats) Stats {
+	return Stats{
+		Requests:         s.Requests + o.Requests,
+		CachedRequests:   s.CachedRequests + o.CachedRequests,
+		PromptTokens:     s.PromptTokens + o.PromptTokens,
+		CompletionTokens: s.CompletionTokens + o.CompletionTokens,
+		Cost:             s.Cost + o.Cost,
+	}
+}
+
+// FromResponse 计算一次响应的用量与费用，命中缓存的响应不计 token 与费用
+func FromResponse(model string, resp *provider.ChatResponse) Stats {
+	if resp.Cached {
+		return Stats{Requests: 1, CachedRequests: 1}
+	}
+	return Stats{
+		Requests:         1,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		Cost:             Cost(model, resp.Usage.PromptTokens, resp.Usage.CompletionTokens),
+	}
+}
+
+var (
+	pricesMu sync.RWMutex
+	prices   = map[string]config.ModelPrice{}
+)
+
+// SetPrices 设置模型单价表
+func SetPrices(table map[string]config.ModelPrice) {
+	pricesMu.Lock()
+	defer pricesMu.Unlock()
+
+	prices = make(map[string]config.ModelPrice, len(table))
+	for model, price := range table {
+		prices[strings.ToLower(model)] = price
+	}
+}
+
+// Cost 估算费用：优先精确匹配模型名，否则取最长的前缀匹配，未配置单价的模型费用为 0
+func Cost(model string, promptTokens, completionTokens int) float64 {
+	pricesMu.RLock()
+	defer pricesMu.RUnlock()
+
+	model = strings.ToLower(model)
+	price, ok := prices[model]
+	if !ok {
+		best := ""
+		for name, p := range prices {
+			if strings.HasPrefix(model, name) && len(name) > len(best) {
+				best, price = name, p
+			}
+		}
+	}
+	return (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1000
+}
+
+// StepUsage 单个步骤的用量
+type StepUsage struct {
+	Step  string `json:"step"`
+	Model string `json:"model"`
+	Stats
+}
+
+// Tracker 一次运行的用量汇总，并发安全
+type Tracker struct {
+	mu    sync.Mutex
+	steps []StepUsage
+}
+
+// NewTracker 创建用量汇总
+func NewTracker() *Tracker {
+	return &Tracker{}
+}
+
+// Add 累加步骤用量，同一步骤多次调用会合并
+func (t *Tracker) Add(step, model string, stats Stats) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := range t.steps {
+		if t.steps[i].Step == step {
+			t.steps[i].Stats = t.steps[i].Stats.Add(stats)
+			return
+		}
+	}
+	t.steps = append(t.steps, StepUsage{Step: step, Model: model, Stats: stats})
+}
+
+// Steps 按首次记录的顺序返回各步骤用量
+func (t *Tracker) Steps() []StepUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]StepUsage(nil), t.steps...)
+}
+
+// Total 返回整个运行的用量
+func (t *Tracker) Total() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var total Stats
+	for _, s := range t.steps {
+		total = total.Add(s.Stats)
+	}
+	return total
+}
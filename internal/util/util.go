@@ -1,6 +1,9 @@
 package util
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"regexp"
 	"strings"
 )
@@ -8,6 +11,9 @@ import (
 type PromptType struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// ToolCalls 原样回传模型返回的工具调用，保证与各服务商格式一致
+	ToolCalls  json.RawMessage `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
 }
 
 func AppendSystemPrompt(prompt string) PromptType {
@@ -22,19 +28,40 @@ func AppendAssistantPrompt(prompt string) PromptType {
 	return PromptType{Role: "assistant", Content: prompt}
 }
 
+func AppendToolPrompt(content, toolCallID string) PromptType {
+	return PromptType{Role: "tool", Content: content, ToolCallID: toolCallID}
+}
+
+var codeBlockRegex = regexp.MustCompile("```([\\w-]+)?\\n([\\s\\S]*?)```")
+
 func ExtractCodeBlocks(markdown string) []string {
 	codeBlocks := []string{}
-	regex := regexp.MustCompile("```(?:[\\w-]+)?\\n([\\s\\S]*?)```")
-	matches := regex.FindAllStringSubmatch(markdown, -1)
-
-	for _, match := range matches {
-		code := strings.TrimSpace(match[1])
-		codeBlocks = append(codeBlocks, code)
+	for _, block := range ParseCodeBlocks(markdown) {
+		codeBlocks = append(codeBlocks, block.Code)
 	}
 
 	return codeBlocks
 }
 
+// CodeBlock Markdown 代码块
+type CodeBlock struct {
+	// Lang 代码块标注的语言，可为空
+	Lang string
+	Code string
+}
+
+// ParseCodeBlocks 提取 Markdown 中的代码块及其语言
+func ParseCodeBlocks(markdown string) []CodeBlock {
+	var blocks []CodeBlock
+	for _, match := range codeBlockRegex.FindAllStringSubmatch(markdown, -1) {
+		blocks = append(blocks, CodeBlock{
+			Lang: strings.ToLower(match[1]),
+			Code: strings.TrimSpace(match[2]),
+		})
+	}
+	return blocks
+}
+
 func ForEach[T any](slice []T, operation func(T) error) error {
 	for _, item := range slice {
 		if err := operation(item); err != nil {
@@ -43,3 +70,24 @@ func ForEach[T any](slice []T, operation func(T) error) error {
 	}
 	return nil
 }
+
+// NewID 生成 16 字节随机十六进制 ID
+func NewID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// SafeName 将 ID 中不能用于文件名的字符替换为下划线，用作目录名；"." 与 ".." 同样替换，避免指向上级目录
+func SafeName(id string) string {
+	if id == "." || id == ".." {
+		return strings.Repeat("_", len(id))
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		return r
+	}, id)
+}
@@ -0,0 +1,20 @@
+package util
+
+import "testing"
+
+func TestSafeName(t *testing.T) {
+	tests := map[string]string{
+		"line-1":        "line-1",
+		"a/b\\c":        "a_b_c",
+		`q:*?"<>|`:      "q_______",
+		"需求/登录页":        "需求_登录页",
+		"../etc/passwd": ".._etc_passwd",
+		"..":            "__",
+		".":             "_",
+	}
+	for in, want := range tests {
+		if got := SafeName(in); got != want {
+			t.Errorf("SafeName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"learn/internal/config"
+	"learn/internal/database"
+	"learn/internal/logger"
+	"learn/internal/model"
+	"learn/internal/usage"
+	"learn/internal/util"
+)
+
+// 通知事件
+const (
+	EventRunCompleted = "run.completed"
+	EventRunFailed    = "run.failed"
+	EventRunCancelled = "run.cancelled"
+)
+
+// 请求头
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	// HeaderSignature 值为 "sha256=" 加上 HMAC-SHA256(secret, timestamp + "." + body) 的十六进制
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Payload 通知内容
+type Payload struct {
+	// ID 投递 ID，重试时不变，接收方可据此去重
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	RunID     string    `json:"run_id"`
+	Status    string    `json:"status"`
+	Summary   Summary   `json:"summary"`
+	Artifacts []string  `json:"artifacts"`
+	Time      time.Time `json:"time"`
+}
+
+// Summary 运行摘要
+type Summary struct {
+	Pipeline string `json:"pipeline"`
+	// Message 用户需求，超过 200 字时截断
+	Message string      `json:"message"`
+	Steps   []string    `json:"steps"`
+	Error   string      `json:"error,omitempty"`
+	Usage   usage.Stats `json:"usage"`
+	// Duration 从提交到结束的秒数
+	Duration float64 `json:"duration_seconds"`
+}
+
+// Store 投递记录与用量的存储，database.Store 已实现
+type Store interface {
+	SaveDelivery(ctx context.Context, d *database.WebhookDelivery) error
+	ListUsage(ctx context.Context, runID string) ([]database.UsageRecord, error)
+}
+
+// Dispatcher 在运行结束时向配置的地址发送签名的通知，失败时重试并记录每次投递
+type Dispatcher struct {
+	hooks        []config.Webhook
+	store        Store
+	client       *http.Client
+	maxAttempts  int
+	backoff      func(attempt int) time.Duration
+	baseURL      string
+	artifactsDir string
+
+	wg sync.WaitGroup
+}
+
+// Option 定义 with 选项函数类型
+type Option func(*Dispatcher)
+
+// WithStore 设置投递记录的存储，为空时不记录
+func WithStore(store Store) Option {
+	return func(d *Dispatcher) {
+		d.store = store
+	}
+}
+
+// WithClient 设置发送通知的 HTTP 客户端，默认超时 10 秒
+func WithClient(client *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.client = client
+	}
+}
+
+// WithMaxAttempts 设置每次通知最多投递的次数，默认 5
+func WithMaxAttempts(n int) Option {
+	return func(d *Dispatcher) {
+		d.maxAttempts = n
+	}
+}
+
+// WithBackoff 设置重试的等待时间，attempt 从 1 开始，默认 1、2、4、8 秒
+func WithBackoff(backoff func(attempt int) time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.backoff = backoff
+	}
+}
+
+// WithBaseURL 设置 API 服务的对外地址，用于生成下载链接，为空时为相对路径
+func WithBaseURL(baseURL string) Option {
+	return func(d *Dispatcher) {
+		d.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithArtifactsDir 设置生成文件的根目录，默认 artifacts
+func WithArtifactsDir(dir string) Option {
+	return func(d *Dispatcher) {
+		d.artifactsDir = dir
+	}
+}
+
+// New 创建 Dispatcher
+func New(hooks []config.Webhook, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		hooks:        hooks,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		maxAttempts:  5,
+		backoff:      func(attempt int) time.Duration { return time.Second << min(attempt-1, 10) },
+		artifactsDir: "artifacts",
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	d.maxAttempts = max(d.maxAttempts, 1)
+	return d
+}
+
+// Notify 异步通知运行结束，未结束的运行与未订阅该事件的地址会被忽略；日志属性取自 ctx
+func (d *Dispatcher) Notify(ctx context.Context, record *database.RunRecord) {
+	event := eventOf(model.Status(record.Status))
+	if event == "" {
+		return
+	}
+	var hooks []config.Webhook
+	for _, h := range d.hooks {
+		if len(h.Events) == 0 || slices.Contains(h.Events, event) {
+			hooks = append(hooks, h)
+		}
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	payload := d.payload(ctx, event, record)
+	for _, h := range hooks {
+		// 每个地址独立投递与重试
+		p := payload
+		p.ID = util.NewID()
+		body, err := json.Marshal(p)
+		if err != nil {
+			slog.ErrorContext(ctx, "webhook 内容序列化失败", "error", err)
+			return
+		}
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.deliver(ctx, h, p, body)
+		}()
+	}
+}
+
+// Wait 等待进行中的投递（包括重试）完成
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// payload 构造通知内容
+func (d *Dispatcher) payload(ctx context.Context, event string, record *database.RunRecord) Payload {
+	summary := Summary{
+		Pipeline: record.Pipeline,
+		Message:  truncate(record.Message, 200),
+		Steps:    record.Steps,
+		Error:    record.Error,
+		Duration: record.UpdatedAt.Sub(record.CreatedAt).Seconds(),
+	}
+	if summary.Steps == nil {
+		summary.Steps = []string{}
+	}
+	if d.store != nil {
+		records, err := d.store.ListUsage(ctx, record.RunID)
+		if err != nil {
+			slog.WarnContext(ctx, "读取用量失败", "run_id", record.RunID, "error", err)
+		}
+		for _, u := range records {
+			summary.Usage = summary.Usage.Add(usage.Stats{
+				Requests:         u.Requests,
+				CachedRequests:   u.CachedRequests,
+				PromptTokens:     u.PromptTokens,
+				CompletionTokens: u.CompletionTokens,
+				Cost:             u.Cost,
+			})
+		}
+	}
+
+	return Payload{
+		Event:     event,
+		RunID:     record.RunID,
+		Status:    record.Status,
+		Summary:   summary,
+		Artifacts: d.artifacts(record.RunID),
+		Time:      time.Now(),
+	}
+}
+
+// artifacts 返回运行生成文件的下载链接
+func (d *Dispatcher) artifacts(runID string) []string {
+	links := []string{}
+	entries, err := os.ReadDir(filepath.Join(d.artifactsDir, runID))
+	if err != nil {
+		return links
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			links = append(links, d.baseURL+"/api/runs/"+runID+"/artifacts/"+url.PathEscape(e.Name()))
+		}
+	}
+	return links
+}
+
+// deliver 投递一次通知，接收方返回非 2xx 或请求失败时按退避时间重试
+func (d *Dispatcher) deliver(ctx context.Context, h config.Webhook, p Payload, body []byte) {
+	ctx = logger.With(ctx, "url", h.URL, "delivery", p.ID)
+	for attempt := 1; attempt <= d.maxAttempts; attempt++ {
+		record := &database.WebhookDelivery{DeliveryID: p.ID, Attempt: attempt, RunID: p.RunID, Event: p.Event, URL: h.URL}
+		start := time.Now()
+		status, err := d.send(ctx, h, p.Event, p.ID, body)
+		record.StatusCode, record.DurationMs = status, time.Since(start).Milliseconds()
+		if err != nil {
+			record.Error = err.Error()
+		}
+		if d.store != nil {
+			if saveErr := d.store.SaveDelivery(ctx, record); saveErr != nil {
+				slog.ErrorContext(ctx, "保存投递记录失败", "error", saveErr)
+			}
+		}
+		if err == nil {
+			slog.InfoContext(ctx, "webhook 投递成功", "delivery_attempt", attempt)
+			return
+		}
+
+		slog.WarnContext(ctx, "webhook 投递失败", "delivery_attempt", attempt, "error", err)
+		if attempt < d.maxAttempts {
+			time.Sleep(d.backoff(attempt))
+		}
+	}
+	slog.ErrorContext(ctx, "webhook 投递失败，已达最大重试次数")
+}
+
+// send 发送签名的请求，返回接收方的状态码
+func (d *Dispatcher) send(ctx context.Context, h config.Webhook, event, id string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "llm-chain-webhook")
+	req.Header.Set(HeaderEvent, event)
+	req.Header.Set(HeaderDelivery, id)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if h.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(h.Secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("接收方返回 %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign 计算签名，格式为 "sha256=<hex>"
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 校验请求的签名，供接收方使用；maxAge 大于 0 时拒绝过旧的请求以防重放
+func Verify(secret string, header http.Header, body []byte, maxAge time.Duration) bool {
+	timestamp := header.Get(HeaderTimestamp)
+	if maxAge > 0 {
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || time.Since(time.Unix(ts, 0)).Abs() > maxAge {
+			return false
+		}
+	}
+	expected := Sign(secret, timestamp, body)
+	return hmac.Equal([]byte(expected), []byte(header.Get(HeaderSignature)))
+}
+
+// eventOf 返回运行状态对应的事件，未结束时返回空
+func eventOf(status model.Status) string {
+	switch status {
+	case model.StatusCompleted:
+		return EventRunCompleted
+	case model.StatusFailed:
+		return EventRunFailed
+	case model.StatusCancelled:
+		return EventRunCancelled
+	}
+	return ""
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "..."
+}
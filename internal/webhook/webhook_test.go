@@ -0,0 +1,181 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"learn/internal/config"
+	"learn/internal/database"
+	"learn/internal/model"
+)
+
+// received 接收方收到的一次请求
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// newReceiver 启动本地接收方，依次以 statuses 中的状态码响应，用完后返回 200
+func newReceiver(t *testing.T, statuses ...int) (*httptest.Server, func() []received) {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		reqs []received
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		n := len(reqs)
+		reqs = append(reqs, received{header: r.Header.Clone(), body: body})
+		mu.Unlock()
+		if n < len(statuses) {
+			w.WriteHeader(statuses[n])
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []received {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]received(nil), reqs...)
+	}
+}
+
+func noBackoff(int) time.Duration {
+	return 0
+}
+
+func TestDeliverRetriesUntilSuccess(t *testing.T) {
+	ctx := context.Background()
+	srv, requests := newReceiver(t, http.StatusInternalServerError, http.StatusBadGateway)
+	store := database.OpenTest(t)
+	if err := store.SaveUsage(ctx, database.UsageRecord{RunID: "run-1", Step: "Requester", Requests: 2, PromptTokens: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	d := New([]config.Webhook{{URL: srv.URL, Secret: "s3cret", Events: []string{EventRunCompleted}}},
+		WithStore(store), WithBackoff(noBackoff), WithArtifactsDir(t.TempDir()))
+	now := time.Now()
+	d.Notify(ctx, &database.RunRecord{
+		RunID: "run-1", Pipeline: "default", Message: "做一个登录页", Status: string(model.StatusCompleted),
+		Steps: []string{"Requester"}, CreatedAt: now.Add(-time.Minute), UpdatedAt: now,
+	})
+	d.Wait()
+
+	reqs := requests()
+	if len(reqs) != 3 {
+		t.Fatalf("requests = %d, want 3", len(reqs))
+	}
+	delivery := reqs[0].header.Get(HeaderDelivery)
+	for i, r := range reqs {
+		if got := r.header.Get(HeaderDelivery); got == "" || got != delivery {
+			t.Errorf("attempt %d delivery = %q, want %q", i+1, got, delivery)
+		}
+		if got := r.header.Get(HeaderEvent); got != EventRunCompleted {
+			t.Errorf("attempt %d event = %q", i+1, got)
+		}
+		if !Verify("s3cret", r.header, r.body, time.Minute) {
+			t.Errorf("attempt %d signature does not verify", i+1)
+		}
+	}
+
+	var p Payload
+	if err := json.Unmarshal(reqs[2].body, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != delivery || p.RunID != "run-1" || p.Event != EventRunCompleted {
+		t.Errorf("payload = %+v", p)
+	}
+	if p.Summary.Usage.Requests != 2 || p.Summary.Usage.PromptTokens != 100 || p.Summary.Duration != 60 {
+		t.Errorf("summary = %+v", p.Summary)
+	}
+
+	deliveries, err := store.ListDeliveries(ctx, "run-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantStatus := []int{500, 502, 200}
+	if len(deliveries) != len(wantStatus) {
+		t.Fatalf("deliveries = %+v", deliveries)
+	}
+	for i, rec := range deliveries {
+		if rec.DeliveryID != delivery || rec.Attempt != i+1 || rec.StatusCode != wantStatus[i] || rec.URL != srv.URL {
+			t.Errorf("delivery %d = %+v", i, rec)
+		}
+		if failed := wantStatus[i] != 200; failed != (rec.Error != "") {
+			t.Errorf("delivery %d error = %q", i, rec.Error)
+		}
+	}
+}
+
+func TestDeliverGivesUpAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	srv, requests := newReceiver(t, 503, 503, 503)
+	store := database.OpenTest(t)
+
+	d := New([]config.Webhook{{URL: srv.URL}}, WithStore(store), WithBackoff(noBackoff), WithMaxAttempts(2))
+	d.Notify(ctx, &database.RunRecord{RunID: "run-2", Status: string(model.StatusFailed), Error: "boom"})
+	d.Wait()
+
+	reqs := requests()
+	if len(reqs) != 2 {
+		t.Fatalf("requests = %d, want 2", len(reqs))
+	}
+	if reqs[0].header.Get(HeaderSignature) != "" {
+		t.Error("request signed without a secret")
+	}
+	deliveries, err := store.ListDeliveries(ctx, "run-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 || deliveries[1].StatusCode != 503 || deliveries[1].Event != EventRunFailed {
+		t.Errorf("deliveries = %+v", deliveries)
+	}
+}
+
+func TestNotifySkipsUnsubscribedEvents(t *testing.T) {
+	srv, requests := newReceiver(t)
+	d := New([]config.Webhook{{URL: srv.URL, Events: []string{EventRunCompleted}}}, WithBackoff(noBackoff))
+
+	d.Notify(context.Background(), &database.RunRecord{RunID: "run-3", Status: string(model.StatusFailed)})
+	d.Notify(context.Background(), &database.RunRecord{RunID: "run-3", Status: string(model.StatusRunning)})
+	d.Wait()
+
+	if n := len(requests()); n != 0 {
+		t.Errorf("requests = %d, want 0", n)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	header := http.Header{}
+	header.Set(HeaderTimestamp, now)
+	header.Set(HeaderSignature, Sign("s3cret", now, body))
+
+	if !Verify("s3cret", header, body, time.Minute) {
+		t.Error("valid signature rejected")
+	}
+	if Verify("other", header, body, time.Minute) {
+		t.Error("wrong secret accepted")
+	}
+	if Verify("s3cret", header, []byte(`{"id":"2"}`), time.Minute) {
+		t.Error("tampered body accepted")
+	}
+
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	header.Set(HeaderTimestamp, old)
+	header.Set(HeaderSignature, Sign("s3cret", old, body))
+	if Verify("s3cret", header, body, time.Minute) {
+		t.Error("stale timestamp accepted")
+	}
+	if !Verify("s3cret", header, body, 0) {
+		t.Error("maxAge 0 should skip the timestamp check")
+	}
+}
@@ -0,0 +1,487 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"learn/internal/chain"
+	"learn/internal/database"
+	"learn/internal/logger"
+	"learn/internal/model"
+	"learn/internal/usage"
+	"learn/internal/util"
+)
+
+const (
+	// Queue 链条运行使用的队列名
+	Queue = "runs"
+	// DefaultMaxAttempts 任务默认最多执行的次数
+	DefaultMaxAttempts = 3
+)
+
+var (
+	// errCancelRequested 运行被用户取消
+	errCancelRequested = errors.New("运行已被取消")
+	// errShutdown 进程退出，任务归还队列
+	errShutdown = errors.New("进程退出")
+)
+
+// Store 执行任务依赖的存储，database.Store 已实现
+type Store interface {
+	chain.UsageStore
+	chain.RunStore
+	GetRun(ctx context.Context, runID string) (*database.RunRecord, error)
+	LeaseJob(ctx context.Context, queue, owner string, visibility time.Duration) (*database.Job, error)
+	ExtendJob(ctx context.Context, job *database.Job, visibility time.Duration) (bool, error)
+	AckJob(ctx context.Context, job *database.Job) error
+	FailJob(ctx context.Context, job *database.Job, cause string, retryAt time.Time) error
+	ReleaseJob(ctx context.Context, job *database.Job) error
+	DeadLetterExpired(ctx context.Context, queue string) ([]database.Job, error)
+}
+
+// Enqueuer 提交任务依赖的存储
+type Enqueuer interface {
+	chain.RunStore
+	EnqueueJob(ctx context.Context, job *database.Job) error
+}
+
+// Notifier 接收已结束（完成、失败或取消）的运行，webhook.Dispatcher 已实现
+type Notifier interface {
+	Notify(ctx context.Context, record *database.RunRecord)
+}
+
+// Payload 任务内容，请求正文保存在运行记录中
+type Payload struct {
+	Pipeline  string          `json:"pipeline"`
+	Overrides chain.Overrides `json:"overrides,omitempty"`
+}
+
+// Submit 保存待执行的运行记录并加入队列，任务 ID 即运行 ID
+func Submit(ctx context.Context, store Enqueuer, pipeline, message string, overrides chain.Overrides, maxAttempts int) (*database.RunRecord, error) {
+	payload, err := json.Marshal(Payload{Pipeline: pipeline, Overrides: overrides})
+	if err != nil {
+		return nil, err
+	}
+	record := &database.RunRecord{
+		RunID:    util.NewID(),
+		Pipeline: pipeline,
+		Message:  message,
+		Status:   string(model.StatusPending),
+	}
+	if err := store.SaveRun(ctx, record); err != nil {
+		return nil, err
+	}
+	job := &database.Job{ID: record.RunID, Queue: Queue, Payload: payload, MaxAttempts: maxAttempts}
+	if err := store.EnqueueJob(ctx, job); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// Worker 从持久化队列领取任务并执行链条
+// 多个进程可共用同一数据库，租约过期的任务（如进程崩溃）会被其他进程领取并从检查点继续执行
+type Worker struct {
+	store        Store
+	id           string
+	queue        string
+	concurrency  int
+	visibility   time.Duration
+	pollInterval time.Duration
+	backoff      func(attempt int) time.Duration
+	artifactsDir string
+	setup        func(c *chain.Chain)
+	events       func(runID string) func(e chain.Event)
+	notifier     Notifier
+
+	// wake 通知空闲的 Worker 立即领取任务
+	wake chan struct{}
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	// running 运行中的任务，用于本进程内取消
+	running map[string]context.CancelCauseFunc
+}
+
+// Option 定义 with 选项函数类型
+type Option func(*Worker)
+
+// WithID 设置进程标识，记录在任务的 lease_owner 中，默认为主机名与进程号
+func WithID(id string) Option {
+	return func(w *Worker) {
+		w.id = id
+	}
+}
+
+// WithQueue 设置队列名，默认 Queue
+func WithQueue(queue string) Option {
+	return func(w *Worker) {
+		w.queue = queue
+	}
+}
+
+// WithConcurrency 设置并发执行的任务数，默认 2
+func WithConcurrency(n int) Option {
+	return func(w *Worker) {
+		w.concurrency = n
+	}
+}
+
+// WithVisibility 设置租约时长，运行期间每隔三分之一时长续租，默认 30 秒
+func WithVisibility(d time.Duration) Option {
+	return func(w *Worker) {
+		w.visibility = d
+	}
+}
+
+// WithPollInterval 设置队列为空时的轮询间隔，默认 1 秒
+func WithPollInterval(d time.Duration) Option {
+	return func(w *Worker) {
+		w.pollInterval = d
+	}
+}
+
+// WithBackoff 设置失败重试的等待时间，attempt 从 1 开始
+func WithBackoff(backoff func(attempt int) time.Duration) Option {
+	return func(w *Worker) {
+		w.backoff = backoff
+	}
+}
+
+// WithArtifactsDir 设置生成文件的根目录，每次运行写入 <dir>/<run_id>，默认 artifacts
+func WithArtifactsDir(dir string) Option {
+	return func(w *Worker) {
+		w.artifactsDir = dir
+	}
+}
+
+// WithSetup 设置链条初始化函数，用于注入模型服务与预算
+func WithSetup(setup func(c *chain.Chain)) Option {
+	return func(w *Worker) {
+		w.setup = setup
+	}
+}
+
+// WithEvents 设置运行事件的接收者，返回 nil 时不接收该运行的事件
+func WithEvents(events func(runID string) func(e chain.Event)) Option {
+	return func(w *Worker) {
+		w.events = events
+	}
+}
+
+// WithNotifier 设置运行结束的通知，重试中的运行不会通知
+func WithNotifier(n Notifier) Option {
+	return func(w *Worker) {
+		w.notifier = n
+	}
+}
+
+// New 创建 Worker
+func New(store Store, opts ...Option) *Worker {
+	host, _ := os.Hostname()
+	w := &Worker{
+		store:        store,
+		id:           fmt.Sprintf("%s-%d", host, os.Getpid()),
+		queue:        Queue,
+		concurrency:  2,
+		visibility:   30 * time.Second,
+		pollInterval: time.Second,
+		backoff:      Backoff,
+		artifactsDir: "artifacts",
+		wake:         make(chan struct{}, 1),
+		running:      make(map[string]context.CancelCauseFunc),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.concurrency = max(w.concurrency, 1)
+	return w
+}
+
+// Backoff 默认的重试等待：10 秒起指数增长，最长 5 分钟，带 ±20% 抖动
+func Backoff(attempt int) time.Duration {
+	d := 10 * time.Second << min(max(attempt-1, 0), 5)
+	d = min(d, 5*time.Minute)
+	return time.Duration(float64(d) * (0.8 + 0.4*rand.Float64()))
+}
+
+// Run 持续领取并执行任务，直到 ctx 取消
+// 退出时取消运行中的任务并将其归还队列，返回前等待这些任务保存进度
+func (w *Worker) Run(ctx context.Context) error {
+	slog.InfoContext(ctx, "Worker 已启动", "worker", w.id, "queue", w.queue, "concurrency", w.concurrency)
+	slots := make(chan struct{}, w.concurrency)
+	defer w.wg.Wait()
+
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+
+		job, err := w.store.LeaseJob(ctx, w.queue, w.id, w.visibility)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "领取任务失败", "error", err)
+		}
+		if job == nil {
+			<-slots
+			w.sweep(ctx)
+			select {
+			case <-time.After(w.pollInterval):
+				continue
+			case <-w.wake:
+				continue
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			defer func() { <-slots }()
+			w.process(ctx, job)
+		}()
+	}
+}
+
+// Notify 通知 Worker 有新任务，同一进程内提交任务后调用可省去轮询等待
+func (w *Worker) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Cancel 取消本进程中运行的任务，任务不在本进程运行时返回 false
+func (w *Worker) Cancel(runID string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	cancel, ok := w.running[runID]
+	if ok {
+		cancel(errCancelRequested)
+	}
+	return ok
+}
+
+// sweep 将租约过期且无法重试的任务移入死信，并标记运行失败
+func (w *Worker) sweep(ctx context.Context) {
+	jobs, err := w.store.DeadLetterExpired(ctx, w.queue)
+	if err != nil && ctx.Err() == nil {
+		slog.ErrorContext(ctx, "清理过期任务失败", "error", err)
+	}
+	for _, job := range jobs {
+		slog.WarnContext(ctx, "任务租约过期，已移入死信", "run_id", job.ID, "attempts", job.Attempts)
+		record, err := w.store.GetRun(ctx, job.ID)
+		if err != nil || record == nil {
+			continue
+		}
+		w.saveStatus(ctx, record, model.StatusFailed, job.LastError)
+		w.notify(ctx, record)
+	}
+}
+
+// process 执行一个任务，根据结果确认、重试、移入死信或归还队列
+func (w *Worker) process(parent context.Context, job *database.Job) {
+	ctx, cancel := context.WithCancelCause(logger.With(parent, "run_id", job.ID, "attempt", job.Attempts))
+	defer cancel(nil)
+	w.mu.Lock()
+	w.running[job.ID] = cancel
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.running, job.ID)
+		w.mu.Unlock()
+	}()
+
+	stopHeartbeat := w.heartbeat(ctx, job, cancel)
+	result, err := w.execute(ctx, job)
+	stopHeartbeat()
+
+	// 状态写入不随任务取消
+	cause := context.Cause(ctx)
+	ctx = context.WithoutCancel(ctx)
+	switch {
+	case errors.Is(cause, database.ErrLeaseLost):
+		slog.WarnContext(ctx, "任务租约已失效，放弃结果")
+		return
+	case parent.Err() != nil:
+		if err := w.store.ReleaseJob(ctx, job); err != nil {
+			slog.ErrorContext(ctx, "归还任务失败", "error", err)
+		}
+		w.publishEnd(job.ID, model.StatusCancelled, errShutdown.Error())
+		return
+	}
+
+	if err != nil {
+		// 运行无法开始（如流水线不存在），重试无意义
+		slog.ErrorContext(ctx, "运行无法开始", "error", err)
+		w.fail(ctx, job, err.Error(), false)
+		w.publishEnd(job.ID, model.StatusFailed, err.Error())
+		return
+	}
+
+	switch result.Status {
+	case model.StatusFailed:
+		var budgetErr *usage.BudgetExceededError
+		retry := !errors.As(result.Err, &budgetErr) && job.Attempts < job.MaxAttempts
+		w.fail(ctx, job, result.Error, retry)
+		status := model.StatusFailed
+		if retry {
+			status = model.StatusPending
+		}
+		w.publishEnd(job.ID, status, result.Error)
+	default:
+		// 完成与取消都不再重试
+		if err := w.store.AckJob(ctx, job); err != nil {
+			slog.ErrorContext(ctx, "确认任务失败", "error", err)
+			return
+		}
+		w.publishEnd(job.ID, result.Status, result.Error)
+		if record, err := w.store.GetRun(ctx, job.ID); err == nil && record != nil {
+			w.notify(ctx, record)
+		}
+	}
+}
+
+// execute 按任务内容执行链条，运行记录已从检查点恢复；返回错误表示运行未能开始
+func (w *Worker) execute(ctx context.Context, job *database.Job) (*chain.Result, error) {
+	record, err := w.store.GetRun(ctx, job.ID)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, fmt.Errorf("运行不存在: %s", job.ID)
+	}
+	if record.Status == string(model.StatusCompleted) {
+		// 上次执行已保存结果但未来得及确认
+		return &chain.Result{RunID: record.RunID, Pipeline: record.Pipeline, Status: model.StatusCompleted}, nil
+	}
+	var payload Payload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("任务内容格式错误: %w", err)
+	}
+
+	ch, err := chain.NewPipeline(payload.Pipeline)
+	if err != nil {
+		return nil, err
+	}
+	if w.setup != nil {
+		w.setup(ch)
+	}
+	ch.SetStore(w.store)
+
+	request, err := chain.ResumeRequest(record)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := payload.Overrides.Apply(request)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	request.ArtifactDir = filepath.Join(w.artifactsDir, record.RunID)
+
+	// run-end 由 process 在确定任务去向后发送，重试中的运行不应被订阅者视为结束
+	if w.events != nil {
+		if publish := w.events(record.RunID); publish != nil {
+			request.OnEvent = func(e chain.Event) {
+				if e.Type != chain.EventRunEnd {
+					publish(e)
+				}
+			}
+		}
+	}
+
+	slog.InfoContext(ctx, "开始执行任务", "pipeline", payload.Pipeline, "resume_from", len(record.Steps))
+	return ch.HandleRequest(request.SetContext(ctx)), nil
+}
+
+// heartbeat 定期续租并检查取消请求，租约失效时取消运行
+func (w *Worker) heartbeat(ctx context.Context, job *database.Job, cancel context.CancelCauseFunc) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(max(w.visibility/3, 100*time.Millisecond))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				cancelRequested, err := w.store.ExtendJob(ctx, job, w.visibility)
+				switch {
+				case errors.Is(err, database.ErrLeaseLost):
+					cancel(err)
+					return
+				case err != nil:
+					slog.WarnContext(ctx, "续租失败", "error", err)
+				case cancelRequested:
+					cancel(errCancelRequested)
+				}
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// fail 记录任务失败；需要重试时运行恢复为待执行，否则移入死信并标记运行失败
+func (w *Worker) fail(ctx context.Context, job *database.Job, cause string, retry bool) {
+	var retryAt time.Time
+	if retry {
+		retryAt = time.Now().Add(w.backoff(job.Attempts))
+	}
+	if err := w.store.FailJob(ctx, job, cause, retryAt); err != nil {
+		slog.ErrorContext(ctx, "记录任务失败出错", "error", err)
+		return
+	}
+
+	record, err := w.store.GetRun(ctx, job.ID)
+	if err != nil || record == nil {
+		return
+	}
+	if retry {
+		slog.WarnContext(ctx, "运行失败，稍后重试", "error", cause, "retry_at", retryAt)
+		w.saveStatus(ctx, record, model.StatusPending, cause)
+		return
+	}
+	slog.ErrorContext(ctx, "运行失败，任务已移入死信", "error", cause)
+	w.saveStatus(ctx, record, model.StatusFailed, cause)
+	w.notify(ctx, record)
+}
+
+func (w *Worker) notify(ctx context.Context, record *database.RunRecord) {
+	if w.notifier != nil {
+		w.notifier.Notify(ctx, record)
+	}
+}
+
+func (w *Worker) saveStatus(ctx context.Context, record *database.RunRecord, status model.Status, cause string) {
+	record.Status, record.Error = string(status), cause
+	if err := w.store.SaveRun(ctx, record); err != nil {
+		slog.ErrorContext(ctx, "保存运行记录失败", "error", err)
+	}
+}
+
+// publishEnd 向事件接收者发送 run-end
+func (w *Worker) publishEnd(runID string, status model.Status, cause string) {
+	if w.events == nil {
+		return
+	}
+	publish := w.events(runID)
+	if publish == nil {
+		return
+	}
+	publish(chain.Event{Type: chain.EventRunEnd, RunID: runID, Status: status, Error: cause, Time: time.Now()})
+}
@@ -0,0 +1,204 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"learn/internal/chain"
+	"learn/internal/database"
+	"learn/internal/model"
+	"learn/internal/provider"
+)
+
+// recorder 记录收到通知的运行
+type recorder struct {
+	mu      sync.Mutex
+	records []database.RunRecord
+}
+
+func (r *recorder) Notify(_ context.Context, record *database.RunRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, *record)
+}
+
+func (r *recorder) statuses() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var statuses []string
+	for _, record := range r.records {
+		statuses = append(statuses, record.Status)
+	}
+	return statuses
+}
+
+// newTestWorker 使用模拟的模型服务创建 Worker，并提交一个只做需求分析的运行
+func newTestWorker(t *testing.T, mock *provider.Mock, maxAttempts int, opts ...Option) (*Worker, database.Store, *recorder, string) {
+	t.Helper()
+	store := database.OpenTest(t)
+	notifier := &recorder{}
+	opts = append([]Option{
+		WithID("test"),
+		WithArtifactsDir(t.TempDir()),
+		WithSetup(func(c *chain.Chain) { c.SetProvider(mock) }),
+		WithNotifier(notifier),
+		WithBackoff(func(int) time.Duration { return 0 }),
+		WithPollInterval(10 * time.Millisecond),
+	}, opts...)
+
+	record, err := Submit(context.Background(), store, "analyze", "做一个登录页", chain.Overrides{}, maxAttempts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(store, opts...), store, notifier, record.RunID
+}
+
+// lease 以 owner 的身份领取任务
+func lease(t *testing.T, store database.Store, owner string) *database.Job {
+	t.Helper()
+	job, err := store.LeaseJob(context.Background(), Queue, owner, time.Minute)
+	if err != nil || job == nil {
+		t.Fatalf("lease: job = %v, err = %v", job, err)
+	}
+	return job
+}
+
+func getJob(t *testing.T, store database.Store, id string) *database.Job {
+	t.Helper()
+	job, err := store.GetJob(context.Background(), id)
+	if err != nil || job == nil {
+		t.Fatalf("get job: job = %v, err = %v", job, err)
+	}
+	return job
+}
+
+func getRun(t *testing.T, store database.Store, id string) *database.RunRecord {
+	t.Helper()
+	record, err := store.GetRun(context.Background(), id)
+	if err != nil || record == nil {
+		t.Fatalf("get run: record = %v, err = %v", record, err)
+	}
+	return record
+}
+
+func TestProcessAcksCompletedRun(t *testing.T) {
+	mock := provider.NewMock().Reply("登录页需求")
+	w, store, notifier, runID := newTestWorker(t, mock, 3)
+
+	w.process(context.Background(), lease(t, store, "test"))
+
+	if job := getJob(t, store, runID); job.Status != database.JobDone || job.Attempts != 1 {
+		t.Errorf("job status = %s, attempts = %d", job.Status, job.Attempts)
+	}
+	if record := getRun(t, store, runID); record.Status != string(model.StatusCompleted) {
+		t.Errorf("run status = %s", record.Status)
+	}
+	if got := notifier.statuses(); len(got) != 1 || got[0] != string(model.StatusCompleted) {
+		t.Errorf("notified = %v", got)
+	}
+}
+
+func TestProcessRetriesThenDeadLetters(t *testing.T) {
+	// 400 不会被 Agent 重试，运行直接失败
+	mock := provider.NewMock(provider.MockResponse{StatusCode: 400}, provider.MockResponse{StatusCode: 400})
+	var backoffs []int
+	w, store, notifier, runID := newTestWorker(t, mock, 2, WithBackoff(func(attempt int) time.Duration {
+		backoffs = append(backoffs, attempt)
+		return 0
+	}))
+
+	w.process(context.Background(), lease(t, store, "test"))
+	job := getJob(t, store, runID)
+	if job.Status != database.JobQueued || job.Attempts != 1 || job.LastError == "" {
+		t.Fatalf("after first failure: status = %s, attempts = %d, last error = %q", job.Status, job.Attempts, job.LastError)
+	}
+	if record := getRun(t, store, runID); record.Status != string(model.StatusPending) {
+		t.Errorf("run status = %s, want pending while retrying", record.Status)
+	}
+	if len(notifier.statuses()) != 0 {
+		t.Errorf("retrying run notified: %v", notifier.statuses())
+	}
+
+	w.process(context.Background(), lease(t, store, "test"))
+	if job := getJob(t, store, runID); job.Status != database.JobDead || job.Attempts != 2 {
+		t.Errorf("after last attempt: status = %s, attempts = %d", job.Status, job.Attempts)
+	}
+	if record := getRun(t, store, runID); record.Status != string(model.StatusFailed) {
+		t.Errorf("run status = %s", record.Status)
+	}
+	if got := notifier.statuses(); len(got) != 1 || got[0] != string(model.StatusFailed) {
+		t.Errorf("notified = %v", got)
+	}
+	if len(backoffs) != 1 || backoffs[0] != 1 {
+		t.Errorf("backoff attempts = %v, want [1]", backoffs)
+	}
+}
+
+func TestProcessDiscardsResultAfterLeaseLost(t *testing.T) {
+	mock := provider.NewMock(provider.MockResponse{Content: "太慢了", Delay: 5 * time.Second})
+	w, store, notifier, runID := newTestWorker(t, mock, 3, WithVisibility(100*time.Millisecond))
+
+	// 租约过期后被其他进程领取，续租时发现租约失效
+	job := lease(t, store, "test")
+	if err := store.ReleaseJob(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	lease(t, store, "other")
+
+	start := time.Now()
+	w.process(context.Background(), job)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("run not cancelled after losing the lease, took %s", elapsed)
+	}
+
+	got := getJob(t, store, runID)
+	if got.Status != database.JobLeased || got.LeaseOwner != "other" || got.Attempts != 1 {
+		t.Errorf("job = %s owned by %s, attempts = %d; want untouched lease of other", got.Status, got.LeaseOwner, got.Attempts)
+	}
+	if len(notifier.statuses()) != 0 {
+		t.Errorf("discarded run notified: %v", notifier.statuses())
+	}
+}
+
+func TestShutdownReleasesJob(t *testing.T) {
+	mock := provider.NewMock(provider.MockResponse{Content: "太慢了", Delay: 5 * time.Second})
+	var mu sync.Mutex
+	var ends []chain.Event
+	w, store, _, runID := newTestWorker(t, mock, 3, WithEvents(func(string) func(chain.Event) {
+		return func(e chain.Event) {
+			if e.Type == chain.EventRunEnd {
+				mu.Lock()
+				ends = append(ends, e)
+				mu.Unlock()
+			}
+		}
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.Run(ctx) }()
+	for deadline := time.Now().Add(2 * time.Second); len(mock.Calls()) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("job not started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after shutdown")
+	}
+
+	// 归还的任务不消耗执行次数，可立即被领取
+	if job := getJob(t, store, runID); job.Status != database.JobQueued || job.Attempts != 0 {
+		t.Errorf("job status = %s, attempts = %d", job.Status, job.Attempts)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ends) != 1 || ends[0].Status != model.StatusCancelled {
+		t.Errorf("run-end events = %+v", ends)
+	}
+}
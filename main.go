@@ -1,39 +1,122 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
 
-	"learn/internal/chain"
 	"learn/internal/config"
+	"learn/internal/model"
+	"learn/internal/usage"
 )
 
+// 退出码
+const (
+	exitOK        = 0
+	exitFailed    = 1   // 运行失败或执行出错
+	exitUsage     = 2   // 命令行参数错误
+	exitBudget    = 3   // 预算超限
+	exitCancelled = 130 // 被中断
+)
+
+// command 子命令
+type command struct {
+	summary string
+	run     func(ctx context.Context, args []string) int
+}
+
+var commands = map[string]command{
+	"run":        {"执行一次流水线", runCmd},
+	"batch":      {"批量执行 JSONL 文件中的请求", batchCmd},
+	"serve":      {"启动 HTTP API 服务", serveCmd},
+	"worker":     {"从任务队列领取并执行运行", workerCmd},
+	"jobs":       {"查看任务队列或重试死信任务 (list|retry)", jobsCmd},
+	"models":     {"查看或拉取本地模型 (list|show|pull)", modelsCmd},
+	"chat":       {"与指定角色交互式对话", chatCmd},
+	"runs":       {"查看或恢复已保存的运行 (list|show|resume)", runsCmd},
+	"config":     {"输出生效的配置", configCmd},
+	"secrets":    {"管理加密密钥文件 (list|set|rm)", secretsCmd},
+	"experiment": {"对比两组提示词或模型的输出 (run|list|show)", experimentCmd},
+}
+
 func main() {
-	// 初始化配置
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		log.Fatalf("初始化配置失败: %v", err)
+	flags := flag.NewFlagSet("llm-chain", flag.ContinueOnError)
+	configFile := flags.String("config", "", "配置文件路径，默认在当前目录查找 config.yaml")
+	flags.Usage = printUsage
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		os.Exit(exitUsage)
+	}
+	if *configFile != "" {
+		config.SetConfigFile(*configFile)
+	}
+
+	args := flags.Args()
+	if len(args) == 0 {
+		printUsage()
+		os.Exit(exitUsage)
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "未知命令: %s\n\n", args[0])
+		printUsage()
+		os.Exit(exitUsage)
 	}
-	log.Printf("应用启动配置: %+v", cfg)
 
-	ch := chain.NewChain()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := cmd.run(ctx, args[1:])
+	stop()
+	os.Exit(code)
+}
 
-	// 添加处理类
-	ch.AddHandler(chain.NewRequester()).
-		AddHandler(chain.NewThinker()).
-		AddHandler(chain.NewTaskPublisher()).
-		AddHandler(chain.NewTaskExecutor()).
-		AddHandler(chain.NewTaskCollector())
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "用法: llm-chain [-config file] <command> [args]")
+	fmt.Fprintln(os.Stderr, "\n命令:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(os.Stderr, "\n使用 llm-chain <command> -h 查看命令参数")
+}
 
-	// 创建请求
-	request := &chain.Request{
-		Message: "写一个学校官网的主页",
-		Data:    make(map[string]any),
+// exitCode 将运行状态转换为退出码
+func exitCode(status model.Status, err error) int {
+	var budgetErr *usage.BudgetExceededError
+	switch {
+	case status == model.StatusCompleted:
+		return exitOK
+	case status == model.StatusCancelled, errors.Is(err, context.Canceled):
+		return exitCancelled
+	case errors.As(err, &budgetErr):
+		return exitBudget
 	}
+	return exitFailed
+}
 
-	// 处理请求
-	result := ch.HandleRequest(request)
+// printJSON 以缩进的 JSON 输出到标准输出
+func printJSON(v any) int {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
 
-	// 输出结果
-	fmt.Println("处理结果:", result.Data)
+// fail 输出错误并返回退出码
+func fail(err error) int {
+	fmt.Fprintln(os.Stderr, "错误:", err)
+	if errors.Is(err, context.Canceled) {
+		return exitCancelled
+	}
+	return exitFailed
 }
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+
+	"learn/internal/config"
+	"learn/internal/provider"
+)
+
+// newProvider 按配置创建模型服务：每个命名服务各自限流，store 不为空且开启缓存时在限流之前加上响应缓存，
+// 路由组合多个服务，模型名为别名时改写为实际模型并交给对应的服务或路由
+func newProvider(cfg *config.Config, store provider.CacheStore) (provider.Provider, error) {
+	configs := cfg.ProviderConfigs()
+	built := make(map[string]provider.Provider, len(configs))
+	for name, pc := range configs {
+		p, err := buildProvider(name, pc)
+		if err != nil {
+			return nil, err
+		}
+		built[name] = p
+	}
+	cacheOpts, err := cacheOptions(cfg, built)
+	if err != nil {
+		return nil, err
+	}
+
+	providers := make(map[string]provider.Provider, len(built)+len(cfg.Routers))
+	for name, p := range built {
+		var limited provider.Provider = provider.NewLimited(p, limitsOf(configs[name]))
+		if cfg.Cache.Enabled && store != nil {
+			limited = provider.NewCached(limited, store, cacheOpts...)
+		}
+		providers[name] = limited
+	}
+	routers := make(map[string]provider.Provider, len(cfg.Routers))
+	for name, rc := range cfg.Routers {
+		r, err := buildRouter(name, rc, providers)
+		if err != nil {
+			return nil, err
+		}
+		routers[name] = r
+	}
+	for name, r := range routers {
+		providers[name] = r
+	}
+
+	aliases := make(map[string]provider.Alias, len(cfg.Models))
+	for name, m := range cfg.Models {
+		aliases[name] = provider.Alias{Provider: providers[m.Provider], Model: m.Model}
+	}
+	return provider.NewAliases("models", providers[cfg.DefaultProvider()], aliases), nil
+}
+
+// buildProvider 创建单个模型服务
+func buildProvider(name string, pc config.ProviderConfig) (provider.Provider, error) {
+	var timeout time.Duration
+	if pc.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(pc.Timeout); err != nil {
+			return nil, fmt.Errorf("providers.%s.timeout 格式错误: %w", name, err)
+		}
+	}
+	tlsConfig, err := newTLSConfig(pc.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("providers.%s.tls: %w", name, err)
+	}
+
+	switch pc.Type {
+	case "ollama":
+		p := provider.NewOllama(name, pc.BaseURL).SetHeaders(pc.Headers)
+		if timeout > 0 {
+			p.SetTimeout(timeout)
+		}
+		if tlsConfig != nil {
+			p.SetTLSConfig(tlsConfig)
+		}
+		return p, nil
+	case "openai":
+		p := provider.NewOpenAI(name, pc.BaseURL, pc.APIKey).SetHeaders(pc.Headers)
+		if pc.Path != "" {
+			p.SetPath(pc.Path)
+		}
+		if timeout > 0 {
+			p.SetTimeout(timeout)
+		}
+		if tlsConfig != nil {
+			p.SetTLSConfig(tlsConfig)
+		}
+		return p, nil
+	}
+	return nil, fmt.Errorf("providers.%s: 不支持的服务类型: %s", name, pc.Type)
+}
+
+// cacheOptions 按配置返回响应缓存的选项，语义缓存使用 ollama 服务计算向量
+func cacheOptions(cfg *config.Config, built map[string]provider.Provider) ([]provider.CacheOption, error) {
+	c := cfg.Cache
+	if !c.Enabled {
+		return nil, nil
+	}
+	opts := []provider.CacheOption{provider.WithForceCache(c.Force)}
+	if c.TTL != "" {
+		ttl, err := time.ParseDuration(c.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("cache.ttl 格式错误: %w", err)
+		}
+		opts = append(opts, provider.WithTTL(ttl))
+	}
+	if c.Semantic.Model != "" {
+		name := c.EmbedProvider(cfg)
+		ollama, ok := built[name].(*provider.Ollama)
+		if !ok {
+			return nil, fmt.Errorf("cache.semantic.provider 必须为 ollama 服务: %s", name)
+		}
+		opts = append(opts, provider.WithSemantic(ollama.Embedder(c.Semantic.Model), c.Semantic.Threshold))
+	}
+	return opts, nil
+}
+
+// limitsOf 返回服务的限流配置，未配置的项使用 provider.DefaultLimits
+func limitsOf(pc config.ProviderConfig) provider.Limits {
+	limits := provider.DefaultLimits
+	if pc.RPS != 0 {
+		limits.RequestsPerSecond = pc.RPS
+	}
+	if pc.Burst != 0 {
+		limits.Burst = pc.Burst
+	}
+	if pc.TPM != 0 {
+		limits.TokensPerMinute = pc.TPM
+	}
+	if pc.MaxInFlight != 0 {
+		limits.MaxInFlight = pc.MaxInFlight
+	}
+	return limits
+}
+
+// buildRouter 创建路由，成员与规则引用已创建的服务
+func buildRouter(name string, rc config.RouterConfig, providers map[string]provider.Provider) (*provider.Router, error) {
+	maxFailures, cooldown := 3, 30*time.Second
+	if rc.MaxFailures > 0 {
+		maxFailures = rc.MaxFailures
+	}
+	if rc.Cooldown != "" {
+		var err error
+		if cooldown, err = time.ParseDuration(rc.Cooldown); err != nil {
+			return nil, fmt.Errorf("routers.%s.cooldown 格式错误: %w", name, err)
+		}
+	}
+	opts := []provider.RouterOption{provider.WithEjection(maxFailures, cooldown)}
+	if rc.Strategy == "roundRobin" {
+		opts = append(opts, provider.WithStrategy(provider.StrategyRoundRobin))
+	}
+	for i, rule := range rc.Rules {
+		target, ok := providers[rule.Provider]
+		if !ok {
+			return nil, fmt.Errorf("routers.%s.rules[%d] 引用了不存在的服务: %s", name, i, rule.Provider)
+		}
+		if rule.ModelPrefix != "" {
+			opts = append(opts, provider.WithRule(provider.ModelPrefixRule(rule.ModelPrefix, target)))
+		} else {
+			opts = append(opts, provider.WithRule(provider.PromptSizeRule(rule.MinPromptTokens, target)))
+		}
+	}
+	for i, m := range rc.Members {
+		p, ok := providers[m.Provider]
+		if !ok {
+			return nil, fmt.Errorf("routers.%s.members[%d] 引用了不存在的服务: %s", name, i, m.Provider)
+		}
+		opts = append(opts, provider.WithMember(p, m.Weight))
+	}
+	return provider.NewRouter(name, opts...), nil
+}
+
+// newTLSConfig 按配置创建 TLS 配置，未配置任何项时返回 nil
+func newTLSConfig(tc config.TLSConfig) (*tls.Config, error) {
+	if tc == (config.TLSConfig{}) {
+		return nil, nil
+	}
+	c := &tls.Config{ServerName: tc.ServerName, InsecureSkipVerify: tc.InsecureSkipVerify}
+	if tc.CAFile != "" {
+		pem, err := os.ReadFile(tc.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 CA 证书失败: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA 证书格式错误: %s", tc.CAFile)
+		}
+		c.RootCAs = pool
+	}
+	if tc.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取客户端证书失败: %w", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+// sameProviders 两份配置的模型服务部分是否相同
+func sameProviders(a, b *config.Config) bool {
+	return reflect.DeepEqual(a.ProviderConfigs(), b.ProviderConfigs()) &&
+		reflect.DeepEqual(a.Routers, b.Routers) &&
+		reflect.DeepEqual(a.Cache, b.Cache) &&
+		reflect.DeepEqual(a.Models, b.Models) &&
+		a.DefaultProvider() == b.DefaultProvider()
+}
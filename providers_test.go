@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"learn/internal/config"
+	"learn/internal/database"
+	"learn/internal/provider"
+	"learn/internal/util"
+)
+
+// openAIServer 返回固定内容的 OpenAI 兼容服务，status 不为 200 时返回错误；calls 不为空时记录请求次数
+func openAIServer(t *testing.T, status int, content string, calls ...*atomic.Int32) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, c := range calls {
+			c.Add(1)
+		}
+		if status != http.StatusOK {
+			http.Error(w, "unavailable", status)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"role": "assistant", "content": content}}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestNewProviderRouters(t *testing.T) {
+	cfg := &config.Config{
+		ApiBaseUrl: "http://127.0.0.1:11434",
+		Providers: map[string]config.ProviderConfig{
+			"down":  {Type: "openai", BaseURL: openAIServer(t, http.StatusServiceUnavailable, "")},
+			"local": {Type: "openai", BaseURL: openAIServer(t, http.StatusOK, "local")},
+			"gpt":   {Type: "openai", BaseURL: openAIServer(t, http.StatusOK, "gpt")},
+		},
+		Routers: map[string]config.RouterConfig{
+			"main": {
+				Members: []config.RouterMember{{Provider: "down"}, {Provider: "local"}},
+				Rules:   []config.RouteRule{{ModelPrefix: "gpt-", Provider: "gpt"}},
+			},
+		},
+		Provider: "main",
+		Models:   map[string]config.ModelAlias{"fast": {Provider: "main", Model: "qwen"}},
+	}
+	p, err := newProvider(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for model, want := range map[string]string{"qwen": "local", "fast": "local", "gpt-4o": "gpt"} {
+		resp, err := p.Chat(context.Background(), &provider.ChatRequest{Model: model})
+		if err != nil || resp.Content != want {
+			t.Errorf("%s: resp = %+v, err = %v, want %q", model, resp, err, want)
+		}
+	}
+}
+
+func TestLimitsOf(t *testing.T) {
+	cases := []struct {
+		pc   config.ProviderConfig
+		want provider.Limits
+	}{
+		{config.ProviderConfig{}, provider.DefaultLimits},
+		{
+			config.ProviderConfig{RPS: 5, TPM: 60000},
+			provider.Limits{RequestsPerSecond: 5, Burst: 10, TokensPerMinute: 60000, MaxInFlight: 4},
+		},
+		{
+			config.ProviderConfig{RPS: -1, MaxInFlight: -1, Burst: 2},
+			provider.Limits{RequestsPerSecond: -1, Burst: 2, MaxInFlight: -1},
+		},
+	}
+	for _, c := range cases {
+		if got := limitsOf(c.pc); got != c.want {
+			t.Errorf("limitsOf(%+v) = %+v, want %+v", c.pc, got, c.want)
+		}
+	}
+}
+
+func TestNewProviderCache(t *testing.T) {
+	ctx := context.Background()
+	store := database.OpenTest(t)
+
+	var calls atomic.Int32
+	cfg := &config.Config{
+		Providers: map[string]config.ProviderConfig{
+			"default": {Type: "openai", BaseURL: openAIServer(t, http.StatusOK, "答案", &calls)},
+		},
+		Cache: config.CacheConfig{Enabled: true, TTL: "1h"},
+	}
+	p, err := newProvider(cfg, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(temperature any) *provider.ChatRequest {
+		req := &provider.ChatRequest{Model: "m", Messages: []util.PromptType{util.AppendUserPrompt("做一个登录页")}}
+		if temperature != nil {
+			req.Options = map[string]any{"temperature": temperature}
+		}
+		return req
+	}
+	for _, req := range []*provider.ChatRequest{request(0.0), request(0.0), request(nil), request(nil)} {
+		if _, err := p.Chat(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 第二个 temperature 为 0 的请求命中缓存，未设置 temperature 的请求不缓存
+	if calls.Load() != 3 {
+		t.Errorf("server calls = %d, want 3", calls.Load())
+	}
+}